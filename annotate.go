@@ -0,0 +1,171 @@
+package fastimage
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Response headers set by AnnotateImages.
+const (
+	HeaderImageType   = "X-Image-Type"
+	HeaderImageWidth  = "X-Image-Width"
+	HeaderImageHeight = "X-Image-Height"
+)
+
+// AnnotateOptions controls AnnotateImagesWithOptions.
+type AnnotateOptions struct {
+	// MaxBytes is the number of body bytes held back while detecting the image.
+	// Responses whose image info is not found within it are sent unannotated.
+	// Zero or negative uses 256 KB.
+	MaxBytes int
+	// OnInfo, when set, is called with the request and the detected info of each
+	// annotated response before its headers are written, for logging or for
+	// passing the dimensions on to templates.
+	OnInfo func(r *http.Request, info Info)
+}
+
+// AnnotateImages returns a handler that serves next and adds X-Image-Type,
+// X-Image-Width and X-Image-Height headers to its image responses, using default
+// options. See AnnotateImagesWithOptions.
+func AnnotateImages(next http.Handler) http.Handler {
+	return AnnotateImagesWithOptions(next, AnnotateOptions{})
+}
+
+// AnnotateImagesWithOptions returns a handler that serves next and adds
+// X-Image-Type, X-Image-Width and X-Image-Height headers to its image responses.
+// Only 200 responses without a Content-Encoding whose Content-Type is image/* or
+// unset are considered. The body is not buffered: the status line and headers are
+// held back, along with the first body bytes, only until detection succeeds or
+// MaxBytes have been written, and the body then streams through unchanged.
+func AnnotateImagesWithOptions(next http.Handler, options AnnotateOptions) http.Handler {
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = 256 << 10
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		aw := &annotatingWriter{ResponseWriter: w, req: r, options: options}
+		defer aw.finish()
+		next.ServeHTTP(aw, r)
+	})
+}
+
+// annotatingWriter holds back the status and the first body bytes of a response
+// until the image info is known.
+type annotatingWriter struct {
+	http.ResponseWriter
+	req     *http.Request
+	options AnnotateOptions
+
+	status    int    // status passed to WriteHeader, 0 before the handler set one
+	buffering bool   // the status is held back while detecting
+	buf       []byte // body bytes held back while detecting
+	done      bool   // the status was written and writes pass through
+}
+
+func (w *annotatingWriter) WriteHeader(code int) {
+	if w.done {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status != 0 {
+		// A superfluous call while the status is held back.
+		return
+	}
+	if code >= 100 && code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+	h := w.Header()
+	contentType := h.Get("Content-Type")
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" &&
+		(contentType == "" || strings.HasPrefix(strings.ToLower(contentType), "image/")) {
+		w.buffering = true
+		return
+	}
+	w.done = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *annotatingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.done {
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	info := GetInfo(w.buf)
+	if (info.Type != Unknown && info.Width != 0 && info.Height != 0) || len(w.buf) >= w.options.MaxBytes {
+		if err := w.flushHeld(info); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flushHeld writes the held back status, annotated when info is known, and body.
+func (w *annotatingWriter) flushHeld(info Info) error {
+	w.done = true
+	if info.Type != Unknown && info.Width != 0 && info.Height != 0 {
+		if w.options.OnInfo != nil {
+			w.options.OnInfo(w.req, info)
+		}
+		h := w.Header()
+		h.Set(HeaderImageType, info.Type.String())
+		h.Set(HeaderImageWidth, strconv.FormatUint(uint64(info.Width), 10))
+		h.Set(HeaderImageHeight, strconv.FormatUint(uint64(info.Height), 10))
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", info.Type.Mime())
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish sends whatever is still held back once the handler returned.
+func (w *annotatingWriter) finish() {
+	if w.buffering && !w.done {
+		w.flushHeld(GetInfo(w.buf))
+	}
+}
+
+// Flush sends the held back response, unannotated if detection has not succeeded
+// yet, since a handler that flushes wants its bytes on the wire.
+func (w *annotatingWriter) Flush() {
+	if w.buffering && !w.done {
+		if err := w.flushHeld(GetInfo(w.buf)); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers such as WebSocket upgrades take over the connection.
+func (w *annotatingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("fastimage: response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *annotatingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
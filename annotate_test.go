@@ -0,0 +1,65 @@
+package fastimage
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAnnotateImages(t *testing.T) {
+	data, err := os.ReadFile("testdata/letter_T.jpg")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	var seen Info
+	handler := AnnotateImagesWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/letter_T.jpg":
+			// Write in small pieces, as a proxy copying the upstream body would.
+			w.Header().Set("Content-Type", "image/jpeg")
+			for i := 0; i < len(data); i += 100 {
+				w.Write(data[i:min(i+100, len(data))])
+			}
+		case "/served.jpg":
+			http.ServeContent(w, r, "served.jpg", time.Time{}, bytes.NewReader(data))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		case "/missing.jpg":
+			http.NotFound(w, r)
+		}
+	}), AnnotateOptions{OnInfo: func(r *http.Request, info Info) { seen = info }})
+
+	cases := []struct {
+		Path string
+		Info Info
+	}{
+		{"/letter_T.jpg", Info{JPEG, 52, 54}},
+		{"/served.jpg", Info{JPEG, 52, 54}},
+		{"/page.html", Info{}},
+		{"/missing.jpg", Info{}},
+	}
+	for _, c := range cases {
+		seen = Info{}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.Path, nil))
+
+		h := rec.Result().Header
+		var got Info
+		if h.Get(HeaderImageType) != "" {
+			got = GetInfo(rec.Body.Bytes())
+			if h.Get(HeaderImageType) != got.Type.String() || h.Get(HeaderImageWidth) != "52" || h.Get(HeaderImageHeight) != "54" {
+				t.Errorf("%s: unexpected headers: %v", c.Path, h)
+			}
+		}
+		if got != c.Info || seen != c.Info {
+			t.Errorf("%s: annotated with %+v, OnInfo saw %+v, want %+v", c.Path, got, seen, c.Info)
+		}
+		if c.Info.Type != Unknown && !bytes.Equal(rec.Body.Bytes(), data) {
+			t.Errorf("%s: body was altered", c.Path)
+		}
+	}
+}
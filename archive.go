@@ -0,0 +1,96 @@
+package fastimage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"iter"
+	"os"
+	"path"
+)
+
+// ScanArchive probes the members of the zip or tar archive at name without
+// extracting it, yielding a result per regular file with Path set to its name in the
+// archive. Tar archives may be gzip-compressed. Zip members are probed concurrently
+// like ScanFS; tar members are read in order, one header at a time, since a tar
+// stream cannot be read out of order. An archive that cannot be opened, or a tar
+// stream that breaks off, is yielded as a result with Path set to name and Err set.
+func ScanArchive(ctx context.Context, name string, options ScanOptions) iter.Seq[ScanResult] {
+	return func(yield func(ScanResult) bool) {
+		f, err := os.Open(name)
+		if err != nil {
+			yield(ScanResult{Path: name, Err: err})
+			return
+		}
+		defer f.Close()
+		head := make([]byte, 4)
+		n, _ := io.ReadFull(f, head)
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			yield(ScanResult{Path: name, Err: err})
+			return
+		}
+
+		if bytes.HasPrefix(head[:n], []byte("PK\x03\x04")) || bytes.HasPrefix(head[:n], []byte("PK\x05\x06")) {
+			fi, err := f.Stat()
+			if err != nil {
+				yield(ScanResult{Path: name, Err: err})
+				return
+			}
+			zr, err := zip.NewReader(f, fi.Size())
+			if err != nil {
+				yield(ScanResult{Path: name, Err: err})
+				return
+			}
+			for r := range ScanFS(ctx, zr, options) {
+				if !yield(r) {
+					return
+				}
+			}
+			return
+		}
+
+		var r io.Reader = bufio.NewReader(f)
+		if bytes.HasPrefix(head[:n], []byte{0x1f, 0x8b}) {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				yield(ScanResult{Path: name, Err: err})
+				return
+			}
+			defer gz.Close()
+			r = gz
+		}
+		scanTar(ctx, name, tar.NewReader(r), options, yield)
+	}
+}
+
+// scanTar yields the results of the regular members of tr, read in order.
+func scanTar(ctx context.Context, name string, tr *tar.Reader, options ScanOptions, yield func(ScanResult) bool) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			yield(ScanResult{Path: name, Err: err})
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		r := ScanResult{Path: path.Clean(hdr.Name), Size: hdr.Size}
+		r.Info, r.Err = GetInfoReader(tr)
+		if r.Err == nil && r.Type == Unknown && options.SkipUnknown {
+			continue
+		}
+		if !yield(r) {
+			return
+		}
+	}
+}
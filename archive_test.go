@@ -0,0 +1,138 @@
+package fastimage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// archiveTestFiles are the members of the archives built by TestScanArchive.
+var archiveTestFiles = []struct {
+	name string
+	file string
+}{
+	{"a.gif", "testdata/test.gif"},
+	{"photos/b.png", "testdata/pass-1_s.png"},
+	{"photos/notes.txt", ""},
+}
+
+func writeTestZip(t *testing.T, name string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, m := range archiveTestFiles {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(archiveTestData(t, m.file))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTar(t *testing.T, name string, compress bool) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if compress {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	tw.WriteHeader(&tar.Header{Name: "photos/", Typeflag: tar.TypeDir, Mode: 0o755})
+	for _, m := range archiveTestFiles {
+		data := archiveTestData(t, m.file)
+		tw.WriteHeader(&tar.Header{Name: m.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(data))})
+		tw.Write(data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func archiveTestData(t *testing.T, file string) []byte {
+	t.Helper()
+	if file == "" {
+		return []byte("not an image")
+	}
+	return mustReadFile(t, file)
+}
+
+func TestScanArchive(t *testing.T) {
+	dir := t.TempDir()
+	archives := map[string]func(string){
+		"images.zip":    func(name string) { writeTestZip(t, name) },
+		"images.tar":    func(name string) { writeTestTar(t, name, false) },
+		"images.tar.gz": func(name string) { writeTestTar(t, name, true) },
+	}
+	want := map[string]Info{
+		"a.gif":            {GIF, 60, 40},
+		"photos/b.png":     {PNG, 90, 60},
+		"photos/notes.txt": {},
+	}
+	for archive, write := range archives {
+		name := filepath.Join(dir, archive)
+		write(name)
+
+		got := make(map[string]ScanResult)
+		for r := range ScanArchive(context.Background(), name, ScanOptions{}) {
+			if r.Err != nil {
+				t.Fatalf("%s: scan %s: %v", archive, r.Path, r.Err)
+			}
+			got[r.Path] = r
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d results, want %d: %+v", archive, len(got), len(want), got)
+		}
+		for path, info := range want {
+			if got[path].Info != info || got[path].Size == 0 {
+				t.Errorf("%s: %s = %+v, want %+v", archive, path, got[path], info)
+			}
+		}
+
+		var n int
+		for r := range ScanArchive(context.Background(), name, ScanOptions{SkipUnknown: true}) {
+			if r.Type == Unknown {
+				t.Errorf("%s: SkipUnknown yielded %+v", archive, r)
+			}
+			n++
+		}
+		if n != 2 {
+			t.Errorf("%s: SkipUnknown yielded %d results, want 2", archive, n)
+		}
+	}
+}
+
+func TestScanArchiveErrors(t *testing.T) {
+	var results []ScanResult
+	for r := range ScanArchive(context.Background(), "testdata/missing.zip", ScanOptions{}) {
+		results = append(results, r)
+	}
+	if len(results) != 1 || !os.IsNotExist(results[0].Err) {
+		t.Fatalf("unexpected results for a missing archive: %+v", results)
+	}
+
+	results = nil
+	for r := range ScanArchive(context.Background(), "testdata/test.gif", ScanOptions{}) {
+		results = append(results, r)
+	}
+	if len(results) != 1 || results[0].Err == nil || results[0].Path != "testdata/test.gif" {
+		t.Fatalf("unexpected results for a file that is not an archive: %+v", results)
+	}
+}
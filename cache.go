@@ -0,0 +1,268 @@
+package fastimage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores HTTP probe results keyed by URL. Responses marked
+// Cache-Control: no-store are never stored.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the entry stored for url, fresh or stale.
+	Get(url string) (*CacheEntry, bool)
+	// Put stores entry for url, replacing any previous entry.
+	Put(url string, entry *CacheEntry)
+}
+
+// CacheEntry is a cached HTTP probe result.
+type CacheEntry struct {
+	Info Info `json:"info"`
+	// ImageURL is the probed image URL when it differs from the cache key.
+	ImageURL string `json:"image_url,omitempty"`
+	// ContentEncoding is the decoded Content-Encoding of the image response.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	// ContentLength is the size of the image file, or 0 when unknown.
+	ContentLength int64 `json:"content_length,omitempty"`
+	// ETag and LastModified are the validators of the probed response.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// Prefix holds the leading bytes of the image that were downloaded.
+	Prefix []byte `json:"prefix,omitempty"`
+	// FullBody reports that Prefix is the whole image, which makes the content hash
+	// of cache hits one of the full body.
+	FullBody bool `json:"full_body,omitempty"`
+	// StoredAt is the time the entry was stored.
+	StoredAt time.Time `json:"stored_at"`
+	// Expires is the time the entry becomes stale, taken from the response's
+	// Cache-Control max-age or Expires header. A zero value lets the cache decide,
+	// and entries that still have a zero Expires never become stale.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// prefixSize returns the size of the file Prefix starts, for hashing it, or -1 when
+// it is not known to be the whole file.
+func (e *CacheEntry) prefixSize() int64 {
+	if e.FullBody {
+		return int64(len(e.Prefix))
+	}
+	return -1
+}
+
+func (e *CacheEntry) fresh(now time.Time) bool {
+	return e.Expires.IsZero() || now.Before(e.Expires)
+}
+
+func (e *CacheEntry) httpImageInfo(rawURL string) HTTPImageInfo {
+	return HTTPImageInfo{
+		URL:             rawURL,
+		ImageURL:        e.ImageURL,
+		ContentEncoding: e.ContentEncoding,
+		ContentLength:   e.ContentLength,
+		FromCache:       true,
+		Info:            e.Info,
+	}
+}
+
+// cachePolicy reports whether a response may be stored and when it becomes stale,
+// following its Cache-Control and Expires headers. A zero expires means the response
+// carries no freshness information and the cache decides.
+func cachePolicy(h http.Header, now time.Time) (expires time.Time, store bool) {
+	maxAge := -1
+	noCache := false
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			switch strings.ToLower(name) {
+			case "no-store":
+				return time.Time{}, false
+			case "no-cache":
+				noCache = true
+			case "max-age":
+				if n, err := strconv.Atoi(strings.Trim(arg, `"`)); err == nil && n >= 0 {
+					maxAge = n
+				}
+			}
+		}
+	}
+
+	switch {
+	case noCache:
+		return now, true
+	case maxAge >= 0:
+		if age, err := strconv.Atoi(h.Get("Age")); err == nil && age > 0 {
+			maxAge -= min(age, maxAge)
+		}
+		return now.Add(time.Duration(maxAge) * time.Second), true
+	}
+	if value := h.Get("Expires"); value != "" {
+		t, err := http.ParseTime(value)
+		if err != nil {
+			// Invalid dates, such as "0", mean already expired.
+			return now, true
+		}
+		return t, true
+	}
+	return time.Time{}, true
+}
+
+// FileCache is a Cache that keeps one JSON file per URL in a directory, so entries
+// survive process restarts. Entries become stale when the response's Cache-Control
+// or Expires says so, or after the TTL when the response did not say, and the least
+// recently used entries are evicted once the directory exceeds its size limit.
+type FileCache struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+
+	mu   sync.Mutex
+	size int64
+}
+
+// NewFileCache opens or creates a file cache in dir. ttl is the lifetime of entries
+// whose responses carry no freshness information; a ttl <= 0 keeps them fresh forever.
+// A maxBytes <= 0 disables size eviction.
+func NewFileCache(dir string, ttl time.Duration, maxBytes int64) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &FileCache{dir: dir, ttl: ttl, maxBytes: maxBytes}
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		c.size += f.size
+	}
+	return c, nil
+}
+
+// Get returns the entry stored for url and marks it as recently used.
+func (c *FileCache) Get(url string) (*CacheEntry, bool) {
+	path := c.path(url)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return &entry, true
+}
+
+// Put stores entry for url. Write errors are ignored; the entry is simply not cached.
+func (c *FileCache) Put(url string, entry *CacheEntry) {
+	stored := *entry
+	if stored.StoredAt.IsZero() {
+		stored.StoredAt = time.Now()
+	}
+	if stored.Expires.IsZero() && c.ttl > 0 {
+		stored.Expires = stored.StoredAt.Add(c.ttl)
+	}
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return
+	}
+
+	path := c.path(url)
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var previous int64
+	if fi, err := os.Stat(path); err == nil {
+		previous = fi.Size()
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	c.size += int64(len(data)) - previous
+	if c.maxBytes > 0 && c.size > c.maxBytes {
+		c.evict()
+	}
+}
+
+// evict removes the least recently used entries until the cache is 10% below its
+// size limit. c.mu must be held.
+func (c *FileCache) evict() {
+	files, err := c.files()
+	if err != nil {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	c.size = 0
+	for _, f := range files {
+		c.size += f.size
+	}
+	target := c.maxBytes - c.maxBytes/10
+	for _, f := range files {
+		if c.size <= target {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		c.size -= f.size
+	}
+}
+
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *FileCache) files() ([]cacheFile, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]cacheFile, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cacheFile{
+			path:    filepath.Join(c.dir, e.Name()),
+			size:    fi.Size(),
+			modTime: fi.ModTime(),
+		})
+	}
+	return files, nil
+}
+
+func (c *FileCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
@@ -0,0 +1,204 @@
+package fastimage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileCache(dir, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("new file cache: %v", err)
+	}
+
+	if _, ok := cache.Get("https://example.com/a.png"); ok {
+		t.Fatalf("unexpected hit in empty cache")
+	}
+	cache.Put("https://example.com/a.png", &CacheEntry{Info: Info{PNG, 10, 20}, ETag: `"a"`, Prefix: []byte("prefix")})
+
+	reopened, err := NewFileCache(dir, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("reopen file cache: %v", err)
+	}
+	entry, ok := reopened.Get("https://example.com/a.png")
+	if !ok {
+		t.Fatalf("missing entry after reopening cache")
+	}
+	if entry.Info != (Info{PNG, 10, 20}) || entry.ETag != `"a"` || string(entry.Prefix) != "prefix" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	if got := entry.Expires.Sub(entry.StoredAt); got != time.Hour {
+		t.Fatalf("unexpected entry lifetime: got %v want %v", got, time.Hour)
+	}
+}
+
+func TestFileCacheEviction(t *testing.T) {
+	cache, err := NewFileCache(t.TempDir(), 0, 1024)
+	if err != nil {
+		t.Fatalf("new file cache: %v", err)
+	}
+
+	prefix := bytes.Repeat([]byte{'x'}, 200)
+	urls := []string{"https://example.com/1", "https://example.com/2", "https://example.com/3", "https://example.com/4"}
+	for i, u := range urls {
+		cache.Put(u, &CacheEntry{Info: Info{GIF, 1, 1}, Prefix: prefix, StoredAt: time.Unix(int64(i), 0)})
+		old := time.Now().Add(time.Duration(i-len(urls)) * time.Minute)
+		_ = os.Chtimes(cache.path(u), old, old)
+	}
+
+	if _, ok := cache.Get(urls[0]); ok {
+		t.Fatalf("least recently used entry was not evicted")
+	}
+	if _, ok := cache.Get(urls[len(urls)-1]); !ok {
+		t.Fatalf("most recent entry was evicted")
+	}
+	if cache.size > 1024 {
+		t.Fatalf("cache exceeds its limit: %d bytes", cache.size)
+	}
+}
+
+func TestGetHTTPImageDataWithCache(t *testing.T) {
+	data, err := os.ReadFile("testdata/letter_T.jpg")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	var requests, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "letter_T.jpg", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	cache, err := NewFileCache(t.TempDir(), time.Hour, 0)
+	if err != nil {
+		t.Fatalf("new file cache: %v", err)
+	}
+	urls := []string{server.URL + "/letter_T.jpg"}
+	options := GetHTTPImageOptions{Cache: cache}
+
+	first := GetHTTPImageDataWithOptions(context.Background(), urls, options)
+	if first[0].Error != nil || first[0].FromCache || first[0].Info != (Info{JPEG, 52, 54}) {
+		t.Fatalf("unexpected first result: %+v err=%v", first[0].HTTPImageInfo, first[0].Error)
+	}
+
+	second := GetHTTPImageDataWithOptions(context.Background(), urls, options)
+	if second[0].Error != nil || !second[0].FromCache || second[0].Info != (Info{JPEG, 52, 54}) {
+		t.Fatalf("unexpected cached result: %+v err=%v", second[0].HTTPImageInfo, second[0].Error)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("fresh cache entry was refetched: %d requests", got)
+	}
+
+	entry, _ := cache.Get(urls[0])
+	entry.Expires = time.Now().Add(-time.Minute)
+	cache.Put(urls[0], entry)
+
+	third := GetHTTPImageDataWithOptions(context.Background(), urls, options)
+	if third[0].Error != nil || !third[0].FromCache || third[0].Info != (Info{JPEG, 52, 54}) {
+		t.Fatalf("unexpected revalidated result: %+v err=%v", third[0].HTTPImageInfo, third[0].Error)
+	}
+	if got := notModified.Load(); got != 1 {
+		t.Fatalf("stale entry was not revalidated: %d conditional requests", got)
+	}
+	if entry, _ := cache.Get(urls[0]); !entry.fresh(time.Now()) {
+		t.Fatalf("revalidated entry is still stale: %+v", entry)
+	}
+}
+
+func TestGetHTTPImageDataCacheContentHash(t *testing.T) {
+	server := newTestImageServer(t, true)
+	defer server.Close()
+	cache, err := NewFileCache(t.TempDir(), time.Hour, 0)
+	if err != nil {
+		t.Fatalf("new file cache: %v", err)
+	}
+	// The small GIF is downloaded whole, the PNG only in part.
+	urls := []string{server.URL + "/test.gif", server.URL + "/pass-1_s.png"}
+	options := GetHTTPImageOptions{Cache: cache, ContentHash: sha256.New}
+
+	first := GetHTTPImageDataWithOptions(context.Background(), urls, options)
+	second := GetHTTPImageDataWithOptions(context.Background(), urls, options)
+	for i := range urls {
+		probed, cached := first[i].HTTPImageInfo, second[i].HTTPImageInfo
+		if !cached.FromCache || cached.ContentHash != probed.ContentHash || cached.HashedBytes != probed.HashedBytes || cached.HashedFullBody != probed.HashedFullBody {
+			t.Errorf("%s: cached result %+v differs from probed %+v", urls[i], cached, probed)
+		}
+	}
+	if !second[0].HashedFullBody || second[1].HashedFullBody {
+		t.Errorf("unexpected full body flags: %v, %v", second[0].HashedFullBody, second[1].HashedFullBody)
+	}
+}
+
+func TestCachePolicy(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		Header  http.Header
+		Expires time.Time
+		Store   bool
+	}{
+		{http.Header{}, time.Time{}, true},
+		{http.Header{"Cache-Control": {"public, max-age=600"}}, now.Add(10 * time.Minute), true},
+		{http.Header{"Cache-Control": {"max-age=600"}, "Age": {"100"}}, now.Add(500 * time.Second), true},
+		{http.Header{"Cache-Control": {"max-age=600, no-cache"}}, now, true},
+		{http.Header{"Cache-Control": {"private", "no-store"}}, time.Time{}, false},
+		{http.Header{"Expires": {"Wed, 03 Jan 2024 03:04:05 GMT"}}, now.Add(24 * time.Hour), true},
+		{http.Header{"Expires": {"0"}}, now, true},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"Wed, 03 Jan 2024 03:04:05 GMT"}}, now.Add(time.Minute), true},
+	}
+	for _, c := range cases {
+		expires, store := cachePolicy(c.Header, now)
+		if !expires.Equal(c.Expires) || store != c.Store {
+			t.Errorf("cache policy for %v: got %v %v want %v %v", c.Header, expires, store, c.Expires, c.Store)
+		}
+	}
+}
+
+func TestGetHTTPImageDataCacheControl(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/no-store.gif":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/max-age.gif":
+			w.Header().Set("Cache-Control", "max-age=3600")
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	cache, err := NewFileCache(t.TempDir(), time.Nanosecond, 0)
+	if err != nil {
+		t.Fatalf("new file cache: %v", err)
+	}
+	urls := []string{server.URL + "/no-store.gif", server.URL + "/max-age.gif"}
+	options := GetHTTPImageOptions{Cache: cache}
+	GetHTTPImageDataWithOptions(context.Background(), urls, options)
+	results := GetHTTPImageDataWithOptions(context.Background(), urls, options)
+
+	if results[0].FromCache {
+		t.Fatalf("no-store response was cached")
+	}
+	if !results[1].FromCache {
+		t.Fatalf("max-age response was not served from cache despite a shorter TTL")
+	}
+	if got := requests.Load(); got != 3 {
+		t.Fatalf("unexpected request count: got %d want 3", got)
+	}
+}
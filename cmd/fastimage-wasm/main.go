@@ -0,0 +1,76 @@
+//go:build js && wasm
+
+// Command fastimage-wasm exposes the detector to JavaScript when built for js/wasm:
+//
+//	GOOS=js GOARCH=wasm go build -o fastimage.wasm ./cmd/fastimage-wasm
+//
+// Once the module runs under wasm_exec.js, a global fastimage object provides
+// getInfo(Uint8Array), which returns {type, mime, width, height} for the given
+// bytes, and probeURL(url), which returns a Promise of the same object for a URL
+// probed with range requests. Unknown formats have an empty type. getInfo returns
+// an Error for invalid arguments, and probeURL rejects with one when the URL cannot
+// be probed.
+package main
+
+import (
+	"context"
+	"syscall/js"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func main() {
+	js.Global().Set("fastimage", js.ValueOf(map[string]any{
+		"getInfo":  js.FuncOf(getInfo),
+		"probeURL": js.FuncOf(probeURL),
+	}))
+	// Keep the exported functions alive.
+	select {}
+}
+
+// infoValue converts info to the object handed to JavaScript.
+func infoValue(info fastimage.Info) js.Value {
+	return js.ValueOf(map[string]any{
+		"type":   info.Type.String(),
+		"mime":   info.Type.Mime(),
+		"width":  int(info.Width),
+		"height": int(info.Height),
+	})
+}
+
+func getInfo(this js.Value, args []js.Value) any {
+	// CopyBytesToGo panics on anything but a Uint8Array.
+	if len(args) < 1 || !args[0].InstanceOf(js.Global().Get("Uint8Array")) {
+		return jsError("getInfo: want a Uint8Array")
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+	return infoValue(fastimage.GetInfo(data))
+}
+
+func probeURL(this js.Value, args []js.Value) any {
+	if len(args) < 1 || args[0].Type() != js.TypeString {
+		return js.Global().Get("Promise").Call("reject", jsError("probeURL: want a URL string"))
+	}
+	rawURL := args[0].String()
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, promise []js.Value) any {
+		resolve, reject := promise[0], promise[1]
+		go func() {
+			defer executor.Release()
+			// Blocking calls must not run on the JavaScript event loop goroutine.
+			result := fastimage.GetHTTPImageInfo(context.Background(), []string{rawURL})[0]
+			if result.Error != nil {
+				reject.Invoke(jsError(result.Error.Error()))
+				return
+			}
+			resolve.Invoke(infoValue(result.Info))
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
+
+func jsError(message string) js.Value {
+	return js.Global().Get("Error").New(message)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// Exit codes. When inputs fail in different ways the highest of the per-input codes,
+// exitFailure to exitNetwork, wins, so a run with both unknown formats and network
+// errors exits with exitNetwork. exitNoMatch only replaces exitOK, and exitTimeout
+// replaces any of them.
+const (
+	exitOK            = 0
+	exitFailure       = 1 // any failure without a more specific code
+	exitUsage         = 2 // invalid flags or arguments
+	exitUnknownFormat = 3 // an input is not a recognized image
+	exitNotFound      = 4 // a file, glob or URL (404, 410) does not exist
+	exitNetwork       = 5 // a URL could not be fetched
+	exitNoMatch       = 6 // the type filter excluded every input
+	exitTimeout       = 7 // the -timeout deadline passed before every input was probed
+)
+
+// exitCodeFor classifies the outcome of probing one input.
+func exitCodeFor(r result) int {
+	err := r.Err
+	if err == nil {
+		if r.Info.Type == fastimage.Unknown {
+			return exitUnknownFormat
+		}
+		return exitOK
+	}
+
+	var statusErr *fastimage.HTTPStatusError
+	var retryErr *fastimage.RetryAfterError
+	var insufficient *fastimage.InsufficientBytesError
+	var urlErr *url.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitNetwork
+	case errors.Is(err, fs.ErrNotExist):
+		return exitNotFound
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone {
+			return exitNotFound
+		}
+		return exitNetwork
+	case errors.As(err, &insufficient), errors.Is(err, io.ErrUnexpectedEOF):
+		return exitUnknownFormat
+	case errors.As(err, &retryErr), errors.As(err, &urlErr), errors.As(err, &netErr):
+		return exitNetwork
+	}
+	return exitFailure
+}
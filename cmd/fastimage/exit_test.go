@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"testing"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	cases := []struct {
+		Result result
+		Code   int
+	}{
+		{result{Info: fastimage.Info{Type: fastimage.PNG, Width: 1, Height: 1}}, exitOK},
+		{result{}, exitUnknownFormat},
+		{result{Err: &fastimage.ProbeError{Err: &fastimage.InsufficientBytesError{Got: 10, Min: 80}}}, exitUnknownFormat},
+		{result{Err: &fs.PathError{Op: "open", Path: "a.png", Err: fs.ErrNotExist}}, exitNotFound},
+		{result{Err: &fastimage.ProbeError{Err: &fastimage.HTTPStatusError{StatusCode: 404}}}, exitNotFound},
+		{result{Err: &fastimage.ProbeError{Err: &fastimage.HTTPStatusError{StatusCode: 502}}}, exitNetwork},
+		{result{Err: &fastimage.ProbeError{Err: &url.Error{Op: "Get", Err: errors.New("connection refused")}}}, exitNetwork},
+		{result{Err: fs.ErrPermission}, exitFailure},
+	}
+	for _, c := range cases {
+		if got := exitCodeFor(c.Result); got != c.Code {
+			t.Errorf("exitCodeFor(%v) = %d, want %d", fmt.Sprint(c.Result.Err), got, c.Code)
+		}
+	}
+}
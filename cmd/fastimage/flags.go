@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// headerFlag collects repeated -H "Name: value" flags.
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var lines []string
+	for name, values := range h {
+		for _, value := range values {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	return strings.Join(lines, ", ")
+}
+
+func (h headerFlag) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("want \"Name: value\", got %q", value)
+	}
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	h[name] = append(h[name], strings.TrimSpace(v))
+	return nil
+}
+
+// httpFlags are the flags that configure URL probing, shared by the probe and serve
+// commands.
+type httpFlags struct {
+	concurrency   *int
+	perOrigin     *int
+	retries       *int
+	backoff       *time.Duration
+	rpsPerOrigin  *float64
+	respectRobots *bool
+	rangeSizes    *string
+	perURLTimeout *time.Duration
+	header        headerFlag
+	userAgent     *string
+	cacheDir      *string
+	cacheTTL      *time.Duration
+}
+
+func newHTTPFlags(fs *flag.FlagSet) *httpFlags {
+	f := &httpFlags{header: make(headerFlag)}
+	f.concurrency = fs.Int("concurrency", fastimage.MAX_CONCURRENT_CONNECTIONS_GLOBAL_DEFAULT, "number of files probed at once, and the global limit of concurrent HTTP requests")
+	f.perOrigin = fs.Int("per-origin", fastimage.CONCURRENT_REQUESTS_FOR_REUSABLE_CONNECTIONS_DEFAULT, "concurrent HTTP requests per origin")
+	f.retries = fs.Int("retries", 0, "retries after 429 or 503 responses with Retry-After (default 1, negative disables)")
+	f.backoff = fs.Duration("backoff", 0, "also retry transport errors and 429, 5xx responses, waiting `duration` and doubling it each retry")
+	f.rpsPerOrigin = fs.Float64("rps-per-origin", 0, "at most this many HTTP requests per second to each origin")
+	f.respectRobots = fs.Bool("respect-robots", false, "skip URLs disallowed by robots.txt and honor its Crawl-delay")
+	f.rangeSizes = fs.String("range-sizes", "", "comma-separated prefix `sizes` requested from URLs, such as 1k,16k,256k")
+	f.perURLTimeout = fs.Duration("per-url-timeout", 0, "give up on a single URL after this `duration`")
+	fs.Var(f.header, "H", "add a `header` such as \"Authorization: Bearer t\" to URL requests; may be repeated")
+	f.userAgent = fs.String("user-agent", "", "User-Agent sent with URL requests")
+	f.cacheDir = fs.String("cache", "", "keep URL results in `dir` and revalidate them instead of refetching on later runs")
+	f.cacheTTL = fs.Duration("cache-ttl", 24*time.Hour, "with -cache, how long results without caching headers stay fresh (0 means forever)")
+	return f
+}
+
+// options returns the HTTP options selected by the flags.
+func (f *httpFlags) options() (fastimage.GetHTTPImageOptions, error) {
+	var sizes []int64
+	if *f.rangeSizes != "" {
+		var err error
+		if sizes, err = parseByteSizes(*f.rangeSizes); err != nil {
+			return fastimage.GetHTTPImageOptions{}, fmt.Errorf("-range-sizes: %w", err)
+		}
+	}
+	header := http.Header(f.header).Clone()
+	if *f.userAgent != "" {
+		header.Set("User-Agent", *f.userAgent)
+	}
+	var cache fastimage.Cache
+	if *f.cacheDir != "" {
+		fileCache, err := fastimage.NewFileCache(*f.cacheDir, *f.cacheTTL, 0)
+		if err != nil {
+			return fastimage.GetHTTPImageOptions{}, fmt.Errorf("-cache: %w", err)
+		}
+		cache = fileCache
+	}
+	return fastimage.GetHTTPImageOptions{
+		ConcurrentRequestsReusable:    *f.perOrigin,
+		ConcurrentRequestsNonReusable: min(*f.perOrigin, fastimage.CONCURRENT_REQUESTS_FOR_NON_REUSABLE_CONNECTIONS_DEFAULT),
+		MaxConcurrentConnections:      max(*f.concurrency, 1),
+		Header:                        header,
+		Timeout:                       *f.perURLTimeout,
+		Retries:                       *f.retries,
+		Backoff:                       *f.backoff,
+		RequestsPerSecondPerOrigin:    *f.rpsPerOrigin,
+		RespectRobots:                 *f.respectRobots,
+		RangeSizes:                    sizes,
+		Cache:                         cache,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func TestHTTPFlagsOptions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := newHTTPFlags(fs)
+	args := []string{
+		"-retries", "3", "-backoff", "250ms", "-rps-per-origin", "2.5", "-respect-robots",
+		"-cache", dir, "-cache-ttl", "1h", "-user-agent", "audit/1.0",
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	options, err := f.options()
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	if options.Retries != 3 || options.Backoff != 250*time.Millisecond || options.RequestsPerSecondPerOrigin != 2.5 || !options.RespectRobots {
+		t.Fatalf("unexpected retry and rate options: %+v", options)
+	}
+	if options.Header.Get("User-Agent") != "audit/1.0" {
+		t.Fatalf("unexpected headers: %v", options.Header)
+	}
+	if _, ok := options.Cache.(*fastimage.FileCache); !ok {
+		t.Fatalf("-cache did not set a file cache: %T", options.Cache)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// hasGlobMeta reports whether name contains glob metacharacters.
+func hasGlobMeta(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// expandGlob calls fn for every file matching pattern, in lexical order, and returns
+// the first error fn returns. Unreadable directories count as not matching. Besides the
+// path.Match syntax, a "**" path element matches any number of directories, so
+// "assets/**/*.png" finds PNG files at any depth below assets. Backslashes are
+// accepted as separators on Windows, where shells leave patterns unexpanded.
+func expandGlob(pattern string, fn func(name string) error) error {
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+	i := 0
+	for i < len(elems)-1 && !hasGlobMeta(elems[i]) {
+		i++
+	}
+	root := strings.Join(elems[:i], "/")
+	switch {
+	case i == 0:
+		root = "."
+	case root == "":
+		root = "/"
+	}
+	elems = elems[i:]
+
+	return filepath.WalkDir(filepath.FromSlash(root), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(root), name)
+		if err != nil || rel == "." {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			if !matchPrefix(elems, parts) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !matchGlob(elems, parts) {
+			return nil
+		}
+		return fn(name)
+	})
+}
+
+// matchGlob reports whether the path elements parts match the pattern elements.
+func matchGlob(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(parts); skip++ {
+				if matchGlob(pattern[1:], parts[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// matchPrefix reports whether the directory parts can lead to a match, so that
+// directories that cannot are not walked.
+func matchPrefix(pattern, parts []string) bool {
+	for i, part := range parts {
+		if i >= len(pattern) {
+			return false
+		}
+		if pattern[i] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[i], part); !ok {
+			return false
+		}
+	}
+	return len(parts) < len(pattern)
+}
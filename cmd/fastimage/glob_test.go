@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		Pattern string
+		Path    string
+		Match   bool
+	}{
+		{"*.png", "a.png", true},
+		{"*.png", "dir/a.png", false},
+		{"**/*.png", "a.png", true},
+		{"**/*.png", "dir/sub/a.png", true},
+		{"dir/**/*.png", "dir/a.png", true},
+		{"dir/**/*.png", "other/a.png", false},
+		{"dir/**", "dir/sub/a.jpg", true},
+		{"dir/*/a.?pg", "dir/sub/a.jpg", true},
+		{"dir/*/a.?pg", "dir/sub/deeper/a.jpg", false},
+		{"[ab].gif", "c.gif", false},
+	}
+	for _, c := range cases {
+		got := matchGlob(strings.Split(c.Pattern, "/"), strings.Split(c.Path, "/"))
+		if got != c.Match {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.Pattern, c.Path, got, c.Match)
+		}
+	}
+}
+
+func TestExpandGlob(t *testing.T) {
+	var names []string
+	err := expandGlob("../../testdata/**/*.gif", func(name string) error {
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expand glob: %v", err)
+	}
+	want := []string{"../../testdata/animated.gif", "../../testdata/pak38.gif", "../../testdata/test.gif"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("unexpected matches: got %v want %v", names, want)
+	}
+
+	matched := false
+	err = expandGlob("../../missing/*.png", func(string) error {
+		matched = true
+		return nil
+	})
+	if err != nil || matched {
+		t.Fatalf("unexpected result for a missing directory: matched=%v err=%v", matched, err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inputSource lists the inputs named on the command line. An argument of "-" reads
+// names separated by sep, a newline or NUL, from stdin, or image bytes when
+// stdinImage is set. listFile, when set, names a file to read more names from. Lists
+// are streamed, so they may be arbitrarily long.
+type inputSource struct {
+	args       []string
+	listFile   string
+	sep        byte
+	stdin      io.Reader
+	stdinImage bool
+}
+
+func newInputSource(args []string, listFile string, sep byte, stdin io.Reader, stdinImage bool) *inputSource {
+	return &inputSource{args: args, listFile: listFile, sep: sep, stdin: stdin, stdinImage: stdinImage}
+}
+
+// forEach calls name for every named input and image for image bytes read from stdin.
+func (s *inputSource) forEach(name func(string) error, image func(io.Reader) error) error {
+	if s.listFile != "" {
+		f, err := os.Open(s.listFile)
+		if err != nil {
+			return err
+		}
+		err = forEachRecord(f, s.sep, name)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, arg := range s.args {
+		var err error
+		switch {
+		case arg == "-" && s.stdinImage:
+			err = image(s.stdin)
+		case arg == "-":
+			err = forEachRecord(s.stdin, s.sep, name)
+		default:
+			err = name(arg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachRecord calls fn for every non-empty record of r terminated by sep. With a
+// newline separator, a trailing carriage return is dropped as well.
+func forEachRecord(r io.Reader, sep byte, fn func(name string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for scanner.Scan() {
+		name := scanner.Text()
+		if sep == '\n' {
+			name = strings.TrimRight(name, "\r")
+		}
+		if name == "" {
+			continue
+		}
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// walkDir calls fn for every regular file below dir, in lexical order. Errors reading
+// a directory are passed to fn in place of a file so that they are reported like any
+// other failed input.
+func walkDir(dir string, fn func(name string, err error) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(path, err)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return fn(path, nil)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestForEachRecord(t *testing.T) {
+	cases := []struct {
+		Input string
+		Sep   byte
+		Names []string
+	}{
+		{"a.png\nb c.jpg\r\n\nd.gif", '\n', []string{"a.png", "b c.jpg", "d.gif"}},
+		{"a.png\x00new\nline.jpg\x00\x00", 0, []string{"a.png", "new\nline.jpg"}},
+	}
+	for _, c := range cases {
+		var names []string
+		err := forEachRecord(strings.NewReader(c.Input), c.Sep, func(name string) error {
+			names = append(names, name)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("read %q: %v", c.Input, err)
+		}
+		if strings.Join(names, "|") != strings.Join(c.Names, "|") {
+			t.Errorf("records of %q: got %q want %q", c.Input, names, c.Names)
+		}
+	}
+}
+
+func TestInputSourceStdinImage(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/test.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	gif := string(data)
+	cases := []struct {
+		Args       []string
+		Stdin      string
+		StdinImage bool
+		Names      []string
+		Images     []string
+	}{
+		{[]string{"-"}, gif, true, nil, []string{gif}},
+		{[]string{"-"}, "a.gif\nb.gif\n", false, []string{"a.gif", "b.gif"}, nil},
+		// Only the flag decides, not what stdin holds.
+		{[]string{"-"}, "a.gif\n", true, nil, []string{"a.gif\n"}},
+		{[]string{"-"}, "GIF89a.gif\n", false, []string{"GIF89a.gif"}, nil},
+		{[]string{"a.gif"}, gif, true, []string{"a.gif"}, nil},
+	}
+	for _, c := range cases {
+		var names, images []string
+		s := newInputSource(c.Args, "", '\n', strings.NewReader(c.Stdin), c.StdinImage)
+		err := s.forEach(func(name string) error {
+			names = append(names, name)
+			return nil
+		}, func(r io.Reader) error {
+			b, err := io.ReadAll(r)
+			images = append(images, string(b))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("args %q: %v", c.Args, err)
+		}
+		if !slices.Equal(names, c.Names) || !slices.Equal(images, c.Images) {
+			t.Errorf("args %q, stdin %.10q, image %v: got names %q and %d images, want %q and %d", c.Args, c.Stdin, c.StdinImage, names, len(images), c.Names, len(c.Images))
+		}
+	}
+}
@@ -1,60 +1,210 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
-	"net/url"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/kotylevskiy/fastimage"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("usage: %s <file>\n", filepath.Base(os.Args[0]))
-		return
+	os.Exit(run())
+}
+
+func run() int {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			return runServe(os.Args[2:])
+		case "verify":
+			return runVerify(os.Args[2:])
+		}
 	}
 
-	name := os.Args[1]
-	info, err := getInfo(name)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "read error: %+v", err)
-		os.Exit(1)
+	jsonFlag := flag.Bool("json", false, "print results as JSON, one object per line")
+	jsonArray := flag.Bool("json-array", false, "print results as a single JSON array")
+	outputFile := flag.String("output", "", "append results as JSON Lines to `file` instead of printing them, skipping inputs it already holds a result without an error for")
+	inputFile := flag.String("input", "", "read newline-separated files and URLs from `file`")
+	stdinImage := flag.Bool("stdin-image", false, "read image bytes rather than a list of files and URLs from stdin for the - argument")
+	var recursive bool
+	flag.BoolVar(&recursive, "r", false, "probe every file below directory arguments")
+	flag.BoolVar(&recursive, "recursive", false, "same as -r")
+	all := flag.Bool("all", false, "with -r, also report files that are not images")
+	typeList := flag.String("type", "", "only report images of these comma-separated `types`, such as jpeg,png")
+	timeout := flag.Duration("timeout", 0, "give up on the whole run after this `duration`")
+	var null bool
+	flag.BoolVar(&null, "0", false, "read NUL-separated input lists and end text output records with NUL")
+	flag.BoolVar(&null, "null", false, "same as -0")
+	failFast := flag.Bool("fail-fast", false, "stop at the first input that fails, cancelling probes in flight")
+	sortBy := flag.String("sort", "", "print results sorted by `field`: width, height, pixels, type or size, with :desc for descending order")
+	sidecar := flag.Bool("sidecar", false, "write each image file's result as JSON to a .json file next to it")
+	indexFile := flag.String("index", "", "write the image results to `file`, an HTML gallery for .html names and a JSON array otherwise")
+	summarize := flag.Bool("summary", false, "print counts per format and dimension statistics on stderr at the end")
+	var meta bool
+	flag.BoolVar(&meta, "meta", false, "also print orientation, DPI, alpha, animation and bit depth read from image headers")
+	flag.BoolVar(&meta, "exif", false, "same as -meta")
+	verbose := flag.Bool("v", false, "print bytes fetched, requests, retries and elapsed time per input and for the run on stderr")
+	httpFlags := newHTTPFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %[1]s [flags] <file or URL | ->...\n       %[1]s serve [flags]\n       %[1]s verify [flags] <manifest.json>\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
 	}
-	if info.Type == fastimage.Unknown {
-		os.Exit(1)
+	flag.Parse()
+
+	if flag.NArg() < 1 && *inputFile == "" {
+		flag.Usage()
+		return exitUsage
 	}
 
-	fmt.Printf("%s %s %d %d\n", info.Type, info.Type.Mime(), info.Width, info.Height)
-}
+	var types map[fastimage.Type]bool
+	if *typeList != "" {
+		var err error
+		if types, err = parseTypes(*typeList); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitUsage
+		}
+	}
 
-func getInfo(name string) (fastimage.Info, error) {
-	if isHTTPURL(name) {
-		resp, err := http.Get(name)
+	sep, eol := byte('\n'), "\n"
+	if null {
+		sep, eol = 0, "\x00"
+	}
+
+	options, err := httpFlags.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	inputs := newInputSource(flag.Args(), *inputFile, sep, os.Stdin, *stdinImage)
+	single := flag.NArg() == 1 && (flag.Arg(0) != "-" || *stdinImage) && !hasGlobMeta(flag.Arg(0)) && *inputFile == "" && !recursive
+	var out output = &textOutput{w: os.Stdout, errw: os.Stderr, prefix: !single, meta: meta, eol: eol}
+	var done map[string]bool
+	switch {
+	case *outputFile != "":
+		if *jsonArray {
+			fmt.Fprintln(os.Stderr, "error: -output writes JSON Lines and cannot be combined with -json-array")
+			return exitUsage
+		}
+		if *sortBy != "" {
+			fmt.Fprintln(os.Stderr, "error: -output appends results as they come and cannot be combined with -sort")
+			return exitUsage
+		}
+		f, resumed, err := openResumable(*outputFile)
 		if err != nil {
-			return fastimage.Info{}, err
+			fmt.Fprintf(os.Stderr, "error: -output: %v\n", err)
+			return exitFailure
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return fastimage.Info{}, fmt.Errorf("unexpected status %s", resp.Status)
+		defer f.Close()
+		out, done = newJSONOutput(f, false, meta), resumed
+	case *jsonFlag || *jsonArray:
+		out = newJSONOutput(os.Stdout, *jsonArray, meta)
+	}
+	if *sidecar {
+		out = &sidecarOutput{next: out, meta: meta}
+	}
+	if *indexFile != "" {
+		out = &indexOutput{next: out, name: *indexFile, meta: meta}
+	}
+	if *sortBy != "" {
+		sorted, err := newSortOutput(out, *sortBy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -sort: %v\n", err)
+			return exitUsage
 		}
-		return fastimage.GetInfoReader(resp.Body)
+		out = sorted
 	}
 
-	file, err := os.Open(name)
-	if err != nil {
-		return fastimage.Info{}, err
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
 	}
-	defer file.Close()
 
-	return fastimage.GetInfoReader(file)
-}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-func isHTTPURL(value string) bool {
-	parsed, err := url.Parse(value)
+	p := &prober{
+		ctx:         ctx,
+		cancel:      cancel,
+		failFast:    *failFast,
+		out:         out,
+		concurrency: max(*httpFlags.concurrency, 1),
+		types:       types,
+		meta:        meta,
+		done:        done,
+		stats:       runStats{started: time.Now()},
+		options:     options,
+	}
+	probe := func(name string, skipUnknown bool) error {
+		return p.add(job{name: name, skipUnknown: skipUnknown})
+	}
+	if *verbose {
+		p.verbose = os.Stderr
+	}
+	if *summarize {
+		p.summary = newSummary()
+	}
+	probeStdin := func(r io.Reader) error {
+		return p.add(job{name: "-", r: r})
+	}
+	err = inputs.forEach(func(name string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if recursive && !isHTTPURL(name) {
+			if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+				return walkDir(name, func(path string, err error) error {
+					if err != nil {
+						return p.add(job{name: path, err: err})
+					}
+					return probe(path, !*all)
+				})
+			}
+		}
+		if hasGlobMeta(name) && !isHTTPURL(name) {
+			if _, err := os.Lstat(name); err != nil {
+				matched := false
+				err := expandGlob(name, func(path string) error {
+					matched = true
+					return probe(path, false)
+				})
+				if err != nil || matched {
+					return err
+				}
+				return p.add(job{name: name, err: &fs.PathError{Op: "glob", Path: name, Err: fs.ErrNotExist}})
+			}
+		}
+		return probe(name, false)
+	}, probeStdin)
+	if err == nil || p.aborted.Load() {
+		err = p.flush()
+	}
 	if err != nil {
-		return false
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		out.close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return exitTimeout
+		}
+		return exitFailure
+	}
+	if err := out.close(); err != nil {
+		fmt.Fprintf(os.Stderr, "write error: %v\n", err)
+		return exitFailure
+	}
+	if *verbose {
+		p.stats.writeSummary(os.Stderr)
+	}
+	if p.summary != nil {
+		p.summary.writeTo(os.Stderr)
 	}
-	return parsed.Scheme == "http" || parsed.Scheme == "https"
+	return p.exitCode()
 }
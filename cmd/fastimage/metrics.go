@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the probe duration histogram.
+var latencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// maxMetricOrigins is the number of origins that get their own probe duration
+// series. Probes of further origins are counted under "other", which keeps the
+// series of a server probing arbitrary URLs bounded. Series are never reassigned, as
+// counters moving from one series to another would break rate queries.
+const maxMetricOrigins = 100
+
+// outcomeNames label probe outcomes by their exit code class.
+var outcomeNames = map[int]string{
+	exitOK:            "ok",
+	exitFailure:       "error",
+	exitUnknownFormat: "unknown_format",
+	exitNotFound:      "not_found",
+	exitNetwork:       "network_error",
+}
+
+// metrics collects serve mode counters and writes them in the Prometheus text
+// exposition format.
+type metrics struct {
+	mu       sync.Mutex
+	probes   map[string]uint64 // by outcome
+	requests uint64
+	bytes    uint64
+	latency  map[string]*histogram // by origin, up to maxMetricOrigins and "other"
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{probes: make(map[string]uint64), latency: make(map[string]*histogram)}
+}
+
+// observe records the outcome of probing r.
+func (m *metrics) observe(r result) {
+	outcome, ok := outcomeNames[exitCodeFor(r)]
+	if !ok {
+		outcome = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probes[outcome]++
+	m.requests += uint64(r.Stats.Requests)
+	m.bytes += uint64(max(r.Stats.BytesFetched, 0))
+
+	origin := "-"
+	if u, err := url.Parse(r.Input); err == nil && u.Host != "" {
+		origin = u.Scheme + "://" + u.Host
+	}
+	h := m.latency[origin]
+	if h == nil && len(m.latency) >= maxMetricOrigins {
+		origin = "other"
+		h = m.latency[origin]
+	}
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[origin] = h
+	}
+	seconds := r.Stats.Elapsed.Seconds()
+	if i, _ := slices.BinarySearch(latencyBuckets, seconds); i < len(latencyBuckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// writeTo writes the metrics to w.
+func (m *metrics) writeTo(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP fastimage_probes_total Probed inputs by outcome.\n")
+	b.WriteString("# TYPE fastimage_probes_total counter\n")
+	for _, outcome := range sortedKeys(m.probes) {
+		fmt.Fprintf(&b, "fastimage_probes_total{outcome=%q} %d\n", outcome, m.probes[outcome])
+	}
+	b.WriteString("# HELP fastimage_http_requests_total HTTP requests sent to image origins.\n")
+	b.WriteString("# TYPE fastimage_http_requests_total counter\n")
+	fmt.Fprintf(&b, "fastimage_http_requests_total %d\n", m.requests)
+	b.WriteString("# HELP fastimage_bytes_fetched_total Response body bytes read from image origins.\n")
+	b.WriteString("# TYPE fastimage_bytes_fetched_total counter\n")
+	fmt.Fprintf(&b, "fastimage_bytes_fetched_total %d\n", m.bytes)
+	b.WriteString("# HELP fastimage_probe_duration_seconds Time to probe an input, by origin.\n")
+	b.WriteString("# TYPE fastimage_probe_duration_seconds histogram\n")
+	for _, origin := range sortedKeys(m.latency) {
+		h := m.latency[origin]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "fastimage_probe_duration_seconds_bucket{origin=%q,le=\"%g\"} %d\n", origin, le, cumulative)
+		}
+		fmt.Fprintf(&b, "fastimage_probe_duration_seconds_bucket{origin=%q,le=\"+Inf\"} %d\n", origin, h.count)
+		fmt.Fprintf(&b, "fastimage_probe_duration_seconds_sum{origin=%q} %g\n", origin, h.sum)
+		fmt.Fprintf(&b, "fastimage_probe_duration_seconds_count{origin=%q} %d\n", origin, h.count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// result is the outcome of probing one input.
+type result struct {
+	Input string
+	Info  fastimage.Info
+	Stats fastimage.ProbeStats
+	Size  int64                   // file or URL content size in bytes, 0 when unknown
+	Meta  *fastimage.ExtendedInfo // header metadata, read for files with -meta, nil for URLs
+	Err   error
+}
+
+// jsonResult is the JSON form of a result.
+type jsonResult struct {
+	Input  string `json:"input"`
+	Type   string `json:"type,omitempty"`
+	Mime   string `json:"mime,omitempty"`
+	Width  uint32 `json:"width,omitempty"`
+	Height uint32 `json:"height,omitempty"`
+	Error  string `json:"error,omitempty"`
+	*jsonMeta
+}
+
+// jsonMeta is the header metadata added to JSON results with -meta.
+type jsonMeta struct {
+	Orientation int     `json:"orientation"`
+	DPIX        float64 `json:"dpi_x"`
+	DPIY        float64 `json:"dpi_y"`
+	Alpha       bool    `json:"alpha"`
+	Animated    bool    `json:"animated"`
+	BitDepth    int     `json:"bit_depth"`
+}
+
+func newJSONResult(r result) jsonResult {
+	out := jsonResult{Input: r.Input}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+		return out
+	}
+	if r.Info.Type != fastimage.Unknown {
+		out.Type = r.Info.Type.String()
+		out.Mime = r.Info.Type.Mime()
+		out.Width = r.Info.Width
+		out.Height = r.Info.Height
+	}
+	return out
+}
+
+// addMeta adds the header metadata of r to an image result that has it.
+func (j *jsonResult) addMeta(r result) {
+	if j.Type == "" || r.Meta == nil {
+		return
+	}
+	m := r.Meta
+	j.jsonMeta = &jsonMeta{m.Orientation, m.DPIX, m.DPIY, m.Alpha, m.Animated, m.BitDepth}
+}
+
+// output writes results in the format selected on the command line.
+type output interface {
+	write(r result) error
+	close() error
+}
+
+// textOutput prints "type mime width height" lines and reports errors on stderr.
+// With prefix set, each line starts with the input name so that results of several
+// inputs can be told apart. With meta set, header metadata follows as key=value
+// columns for inputs that have it. Lines end with eol, "\n" unless NUL-separated records were requested.
+type textOutput struct {
+	w, errw io.Writer
+	prefix  bool
+	meta    bool
+	eol     string
+}
+
+func (o *textOutput) write(r result) error {
+	name := ""
+	if o.prefix {
+		name = r.Input + ": "
+	}
+	if r.Err != nil {
+		_, err := fmt.Fprintf(o.errw, "%sread error: %+v\n", name, r.Err)
+		return err
+	}
+	if r.Info.Type == fastimage.Unknown {
+		if !o.prefix {
+			return nil
+		}
+		_, err := fmt.Fprintf(o.errw, "%sunknown image format\n", name)
+		return err
+	}
+	meta := ""
+	if o.meta && r.Meta != nil {
+		m := r.Meta
+		meta = fmt.Sprintf(" orientation=%d dpi=%gx%g alpha=%t animated=%t depth=%d", m.Orientation, m.DPIX, m.DPIY, m.Alpha, m.Animated, m.BitDepth)
+	}
+	_, err := fmt.Fprintf(o.w, "%s%s %s %d %d%s%s", name, r.Info.Type, r.Info.Type.Mime(), r.Info.Width, r.Info.Height, meta, o.eol)
+	return err
+}
+
+func (o *textOutput) close() error {
+	return nil
+}
+
+// jsonOutput prints one JSON object per line, or a single array when array is set.
+// With meta set, image results include their header metadata.
+type jsonOutput struct {
+	enc     *json.Encoder
+	w       io.Writer
+	array   bool
+	meta    bool
+	written int
+}
+
+func newJSONOutput(w io.Writer, array, meta bool) *jsonOutput {
+	return &jsonOutput{enc: json.NewEncoder(w), w: w, array: array, meta: meta}
+}
+
+func (o *jsonOutput) write(r result) error {
+	out := newJSONResult(r)
+	if o.meta {
+		out.addMeta(r)
+	}
+	if o.array {
+		sep := ",\n"
+		if o.written == 0 {
+			sep = "[\n"
+		}
+		if _, err := io.WriteString(o.w, sep); err != nil {
+			return err
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		o.written++
+		_, err = o.w.Write(data)
+		return err
+	}
+	o.written++
+	return o.enc.Encode(out)
+}
+
+func (o *jsonOutput) close() error {
+	if !o.array {
+		return nil
+	}
+	end := "\n]\n"
+	if o.written == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(o.w, end)
+	return err
+}
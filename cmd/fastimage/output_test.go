@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func TestOutputMeta(t *testing.T) {
+	meta := fastimage.ExtendedInfo{Info: fastimage.Info{Type: fastimage.JPEG, Width: 52, Height: 54}, Orientation: 6, DPIX: 72, DPIY: 72, BitDepth: 8}
+	r := result{Input: "a.jpg", Info: meta.Info, Meta: &meta}
+
+	cases := []struct {
+		Output func(w *bytes.Buffer) output
+		Want   string
+	}{
+		{
+			func(w *bytes.Buffer) output { return &textOutput{w: w, errw: w, eol: "\n"} },
+			"jpeg image/jpeg 52 54\n",
+		},
+		{
+			func(w *bytes.Buffer) output { return &textOutput{w: w, errw: w, meta: true, eol: "\n"} },
+			"jpeg image/jpeg 52 54 orientation=6 dpi=72x72 alpha=false animated=false depth=8\n",
+		},
+		{
+			func(w *bytes.Buffer) output { return newJSONOutput(w, false, false) },
+			`{"input":"a.jpg","type":"jpeg","mime":"image/jpeg","width":52,"height":54}` + "\n",
+		},
+		{
+			func(w *bytes.Buffer) output { return newJSONOutput(w, false, true) },
+			`{"input":"a.jpg","type":"jpeg","mime":"image/jpeg","width":52,"height":54,"orientation":6,"dpi_x":72,"dpi_y":72,"alpha":false,"animated":false,"bit_depth":8}` + "\n",
+		},
+	}
+	for i, c := range cases {
+		var buf bytes.Buffer
+		out := c.Output(&buf)
+		if err := out.write(r); err != nil {
+			t.Fatalf("case %d: write: %v", i, err)
+		}
+		if err := out.close(); err != nil {
+			t.Fatalf("case %d: close: %v", i, err)
+		}
+		if got := buf.String(); got != c.Want {
+			t.Errorf("case %d: got %q want %q", i, got, c.Want)
+		}
+	}
+}
+
+func TestOutputMetaUnread(t *testing.T) {
+	r := result{Input: "https://example.com/a.jpg", Info: fastimage.Info{Type: fastimage.JPEG, Width: 52, Height: 54}}
+
+	var buf bytes.Buffer
+	text := &textOutput{w: &buf, errw: &buf, meta: true, eol: "\n"}
+	if err := text.write(r); err != nil {
+		t.Fatalf("text write: %v", err)
+	}
+	json := newJSONOutput(&buf, false, true)
+	if err := json.write(r); err != nil {
+		t.Fatalf("json write: %v", err)
+	}
+	want := "jpeg image/jpeg 52 54\n" + `{"input":"https://example.com/a.jpg","type":"jpeg","mime":"image/jpeg","width":52,"height":54}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
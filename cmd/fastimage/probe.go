@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// chunkSize is the number of inputs probed together. Results are written in input
+// order once the whole chunk is done, which keeps memory bounded for long lists.
+const chunkSize = 1024
+
+// job is one input waiting to be probed. A job with err set is reported as failed
+// without probing, a job with r set is probed from r rather than by name, and
+// skipUnknown drops the result when the input is not an image.
+type job struct {
+	name        string
+	r           io.Reader
+	skipUnknown bool
+	err         error
+}
+
+// prober probes inputs in chunks: files on a pool of concurrency workers and URLs
+// as one fastimage HTTP batch per chunk. When types is set, only images of those
+// types are written and the run exits with exitNoMatch unless at least one matched.
+type prober struct {
+	ctx         context.Context
+	out         output
+	concurrency int
+	options     fastimage.GetHTTPImageOptions
+	types       map[fastimage.Type]bool
+	meta        bool            // reads header metadata of files with -meta
+	done        map[string]bool // inputs already in the -output file, not probed again
+	verbose     io.Writer       // receives per-input accounting with -v
+	summary     *summary        // aggregates results with -summary
+	failFast    bool
+	cancel      context.CancelFunc // cancels ctx to abort the run with failFast
+
+	aborted atomic.Bool
+
+	jobs    []job
+	code    int
+	matched bool
+	stats   runStats
+}
+
+// add queues j and probes the queued inputs once a chunk is full. Inputs listed in
+// done are skipped.
+func (p *prober) add(j job) error {
+	if j.r == nil && j.err == nil && p.done[j.name] {
+		return nil
+	}
+	p.jobs = append(p.jobs, j)
+	if len(p.jobs) < chunkSize {
+		return nil
+	}
+	return p.flush()
+}
+
+// flush probes the queued inputs and writes their results.
+func (p *prober) flush() error {
+	jobs := p.jobs
+	p.jobs = p.jobs[:0]
+	results := make([]result, len(jobs))
+
+	var urls []string
+	var urlIndexes []int
+	files := make(chan int)
+	var wg sync.WaitGroup
+	for range p.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range files {
+				if err := p.ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				var info fastimage.ExtendedInfo
+				info, results[i].Stats, results[i].Err = getFileInfo(jobs[i].name, p.meta)
+				p.setInfo(&results[i], info)
+				if fi, err := os.Stat(jobs[i].name); err == nil {
+					results[i].Size = fi.Size()
+				}
+				p.check(jobs[i], results[i])
+			}
+		}()
+	}
+	for i, j := range jobs {
+		results[i].Input = j.name
+		switch {
+		case j.err != nil:
+			results[i].Err = j.err
+			p.check(j, results[i])
+		case j.r != nil:
+			var info fastimage.ExtendedInfo
+			info, results[i].Stats, results[i].Err = readInfo(j.r, p.meta)
+			p.setInfo(&results[i], info)
+			p.check(j, results[i])
+		case isHTTPURL(j.name):
+			urls = append(urls, j.name)
+			urlIndexes = append(urlIndexes, i)
+		default:
+			files <- i
+		}
+	}
+	close(files)
+	if len(urls) > 0 {
+		batch := fastimage.StartHTTPImageBatch(p.ctx, urls, p.options)
+		for k := range batch.Completed() {
+			r, i := batch.Result(k), urlIndexes[k]
+			results[i].Info, results[i].Stats, results[i].Err = r.Info, r.Stats, r.Error
+			results[i].Size = r.ContentLength
+			p.check(jobs[i], results[i])
+		}
+	}
+	wg.Wait()
+
+	for i, r := range results {
+		if p.aborted.Load() && errors.Is(r.Err, context.Canceled) {
+			// Cancelled by the failure that aborted the run.
+			continue
+		}
+		if r.Err == nil && r.Info.Type == fastimage.Unknown && jobs[i].skipUnknown {
+			continue
+		}
+		if r.Err == nil && p.types != nil {
+			if !p.types[r.Info.Type] {
+				continue
+			}
+			p.matched = true
+		}
+		p.code = max(p.code, exitCodeFor(r))
+		if err := p.out.write(r); err != nil {
+			return err
+		}
+		if err := p.stats.add(p.verbose, r); err != nil {
+			return err
+		}
+		if p.summary != nil {
+			p.summary.add(r)
+		}
+	}
+	return nil
+}
+
+// check aborts the run when failFast is set and r failed.
+func (p *prober) check(j job, r result) {
+	if !p.failFast || (r.Err == nil && (r.Info.Type != fastimage.Unknown || j.skipUnknown)) {
+		return
+	}
+	if p.aborted.CompareAndSwap(false, true) {
+		p.cancel()
+	}
+}
+
+// exitCode returns the exit status of the run.
+func (p *prober) exitCode() int {
+	if errors.Is(p.ctx.Err(), context.DeadlineExceeded) {
+		return exitTimeout
+	}
+	if p.types != nil && !p.matched && p.code == exitOK {
+		return exitNoMatch
+	}
+	return p.code
+}
+
+// setInfo sets the image of r to info, and its header metadata too with -meta.
+func (p *prober) setInfo(r *result, info fastimage.ExtendedInfo) {
+	r.Info = info.Info
+	if p.meta {
+		r.Meta = &info
+	}
+}
+
+func getFileInfo(name string, meta bool) (fastimage.ExtendedInfo, fastimage.ProbeStats, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return fastimage.ExtendedInfo{}, fastimage.ProbeStats{}, err
+	}
+	defer file.Close()
+
+	return readInfo(file, meta)
+}
+
+// readInfo detects the image read from r and accounts for the bytes it consumed.
+// With meta set, it also reads the header metadata, which may take more bytes.
+func readInfo(r io.Reader, meta bool) (fastimage.ExtendedInfo, fastimage.ProbeStats, error) {
+	started := time.Now()
+	cr := &countingReader{r: r}
+	var info fastimage.ExtendedInfo
+	var err error
+	if meta {
+		info, err = fastimage.GetExtendedInfoReader(cr)
+	} else {
+		info.Info, err = fastimage.GetInfoReader(cr)
+	}
+	stats := fastimage.ProbeStats{Attempts: 1, BytesFetched: cr.n, Elapsed: time.Since(started)}
+	return info, stats, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func isHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return parsed.Scheme == "http" || parsed.Scheme == "https"
+}
+
+// parseTypes parses a comma-separated list of type names such as "jpeg,png".
+func parseTypes(value string) (map[fastimage.Type]bool, error) {
+	aliases := map[string]fastimage.Type{"jpg": fastimage.JPEG, "tif": fastimage.TIFF}
+	for t := fastimage.Type(1); t.String() != ""; t++ {
+		aliases[t.String()] = t
+	}
+	types := make(map[fastimage.Type]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		t, ok := aliases[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown image type %q", name)
+		}
+		types[t] = true
+	}
+	return types, nil
+}
+
+// parseByteSizes parses a comma-separated list of byte counts with optional k or m
+// suffixes, such as "1k,16k,256k".
+func parseByteSizes(value string) ([]int64, error) {
+	var sizes []int64
+	for _, field := range strings.Split(value, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		unit := int64(1)
+		switch {
+		case strings.HasSuffix(field, "k"):
+			unit, field = 1<<10, strings.TrimSuffix(field, "k")
+		case strings.HasSuffix(field, "m"):
+			unit, field = 1<<20, strings.TrimSuffix(field, "m")
+		}
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid size %q", field)
+		}
+		sizes = append(sizes, n*unit)
+	}
+	return sizes, nil
+}
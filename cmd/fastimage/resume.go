@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// openResumable opens name for appending JSON Lines results and returns the inputs
+// it already holds a successful result for. Failed inputs are left out so that they
+// are probed again; the record of the retry is appended and supersedes the failure,
+// as the last record of an input is the one that counts. A trailing partial record, left behind by a run
+// that was interrupted while writing, is cut off so that appending starts on a fresh
+// line. Files holding anything but JSON Lines records are refused and left as they
+// are.
+func openResumable(name string) (*os.File, map[string]bool, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	done := make(map[string]bool)
+	var end int64 // offset just past the last complete line
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 && line[0] != '{' {
+				f.Close()
+				return nil, nil, fmt.Errorf("%s does not hold JSON Lines results", name)
+			}
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		end += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record struct {
+			Input *string          `json:"input"`
+			Error *json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("%s does not hold JSON Lines results: line %q", name, bytes.TrimSpace(line))
+		}
+		switch {
+		case record.Input == nil:
+		case record.Error == nil:
+			done[*record.Input] = true
+		default:
+			delete(done, *record.Input)
+		}
+	}
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, done, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenResumable(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "results.ndjson")
+	existing := `{"input":"a.png","type":"png","mime":"image/png","width":1,"height":1}
+{"input":"https://example.com/b.gif","error":"fastimage: unexpected HTTP status 404 Not Found"}
+{"input":"c.jp`
+	if err := os.WriteFile(name, []byte(existing), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	f, done, err := openResumable(name)
+	if err != nil {
+		t.Fatalf("open resumable: %v", err)
+	}
+	if len(done) != 1 || !done["a.png"] {
+		t.Fatalf("unexpected inputs: %v", done)
+	}
+	if _, err := f.WriteString(`{"input":"c.jpg"}` + "\n"); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	f.Close()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	want := existing[:len(existing)-len(`{"input":"c.jp`)] + `{"input":"c.jpg"}` + "\n"
+	if string(data) != want {
+		t.Fatalf("partial line was not replaced:\n%s", data)
+	}
+}
+
+func TestOpenResumableRefusesOtherFormats(t *testing.T) {
+	for _, existing := range []string{
+		"png image/png 1 1\n",
+		"[\n{\"input\":\"a.png\"}\n]\n",
+		"a.png: png image/png 1 1",
+	} {
+		name := filepath.Join(t.TempDir(), "results.txt")
+		if err := os.WriteFile(name, []byte(existing), 0o644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+		if f, _, err := openResumable(name); err == nil {
+			f.Close()
+			t.Errorf("%q: expected an error", existing)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read file: %v", err)
+		}
+		if string(data) != existing {
+			t.Errorf("%q: file was changed to %q", existing, data)
+		}
+	}
+}
+
+func TestOpenResumableRetriesFailures(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "results.ndjson")
+	existing := `{"input":"a.png","error":"open a.png: permission denied"}
+{"input":"b.gif","error":"fastimage: unexpected HTTP status 503 Service Unavailable"}
+{"input":"b.gif","type":"gif","mime":"image/gif","width":1,"height":1}
+{"input":"c.jpg","type":"jpeg","mime":"image/jpeg","width":1,"height":1}
+{"input":"c.jpg","error":"open c.jpg: no such file or directory"}
+`
+	if err := os.WriteFile(name, []byte(existing), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	f, done, err := openResumable(name)
+	if err != nil {
+		t.Fatalf("open resumable: %v", err)
+	}
+	f.Close()
+	if len(done) != 1 || !done["b.gif"] {
+		t.Fatalf("unexpected inputs: %v", done)
+	}
+}
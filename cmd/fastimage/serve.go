@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// maxServeURLs bounds the number of URLs a single request may ask to probe.
+const maxServeURLs = 1000
+
+// maxServeImageBytes bounds the image bytes a request may post. Detection stops
+// once the dimensions are known, so only bodies it cannot make sense of are read
+// that far.
+const maxServeImageBytes = 32 << 20
+
+// runServe runs "fastimage serve", an HTTP service exposing the prober.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", ":8080", "`address` to listen on")
+	httpFlags := newHTTPFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s serve [flags]\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	options, err := httpFlags.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           newServer(options).routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "listening on %s\n", *listen)
+
+	select {
+	case err := <-errc:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// server answers probe requests with JSON results.
+type server struct {
+	options fastimage.GetHTTPImageOptions
+	metrics *metrics
+}
+
+func newServer(options fastimage.GetHTTPImageOptions) *server {
+	return &server{options: options, metrics: newMetrics()}
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /probe", s.handleProbeURLs)
+	mux.HandleFunc("POST /probe", s.handleProbePost)
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = s.metrics.writeTo(w)
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	return mux
+}
+
+// handleProbeURLs probes the url query parameters, which may be repeated.
+func (s *server) handleProbeURLs(w http.ResponseWriter, r *http.Request) {
+	s.probeURLs(w, r, r.URL.Query()["url"])
+}
+
+// handleProbePost probes a JSON {"urls": [...]} object, a text/plain list with one
+// URL per line, or, for any other content type, the image bytes in the body.
+func (s *server) handleProbePost(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var req struct {
+			URLs []string `json:"urls"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4<<20)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+			return
+		}
+		s.probeURLs(w, r, req.URLs)
+	case "text/plain":
+		var urls []string
+		err := forEachRecord(io.LimitReader(r.Body, 4<<20), '\n', func(name string) error {
+			urls = append(urls, strings.TrimSpace(name))
+			return nil
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.probeURLs(w, r, urls)
+	default:
+		info, stats, err := readInfo(http.MaxBytesReader(w, r.Body, maxServeImageBytes), false)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("at most %d image bytes may be posted", maxErr.Limit))
+			return
+		}
+		res := result{Input: "-", Info: info.Info, Stats: stats, Err: err}
+		s.metrics.observe(res)
+		writeJSON(w, http.StatusOK, []jsonResult{newJSONResult(res)})
+	}
+}
+
+func (s *server) probeURLs(w http.ResponseWriter, r *http.Request, urls []string) {
+	switch {
+	case len(urls) == 0:
+		writeJSONError(w, http.StatusBadRequest, errors.New("no URLs to probe"))
+		return
+	case len(urls) > maxServeURLs:
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("at most %d URLs may be probed per request", maxServeURLs))
+		return
+	}
+	results := fastimage.GetHTTPImageDataWithOptions(r.Context(), urls, s.options)
+	out := make([]jsonResult, len(results))
+	for i, res := range results {
+		r := result{Input: res.URL, Info: res.Info, Stats: res.Stats, Err: res.Error}
+		s.metrics.observe(r)
+		out[i] = newJSONResult(r)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func TestServerProbe(t *testing.T) {
+	images := httptest.NewServer(http.FileServer(http.Dir("../../testdata")))
+	defer images.Close()
+	bmp, err := os.ReadFile("../../testdata/xterm.bmp")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+
+	srv := httptest.NewServer(newServer(fastimage.GetHTTPImageOptions{}).routes())
+	defer srv.Close()
+
+	cases := []struct {
+		Name        string
+		Method      string
+		Path        string
+		ContentType string
+		Body        []byte
+		Status      int
+		Results     []jsonResult
+	}{
+		{
+			Name:    "query",
+			Method:  http.MethodGet,
+			Path:    "/probe?url=" + url.QueryEscape(images.URL+"/test.gif"),
+			Status:  http.StatusOK,
+			Results: []jsonResult{{Input: images.URL + "/test.gif", Type: "gif", Mime: "image/gif", Width: 60, Height: 40}},
+		},
+		{
+			Name:        "json",
+			Method:      http.MethodPost,
+			Path:        "/probe",
+			ContentType: "application/json",
+			Body:        []byte(`{"urls": ["` + images.URL + `/pak38.gif"]}`),
+			Status:      http.StatusOK,
+			Results:     []jsonResult{{Input: images.URL + "/pak38.gif", Type: "gif", Mime: "image/gif", Width: 333, Height: 194}},
+		},
+		{
+			Name:        "text",
+			Method:      http.MethodPost,
+			Path:        "/probe",
+			ContentType: "text/plain",
+			Body:        []byte(images.URL + "/xterm.bmp\n"),
+			Status:      http.StatusOK,
+			Results:     []jsonResult{{Input: images.URL + "/xterm.bmp", Type: "bmp", Mime: "image/bmp", Width: 64, Height: 38}},
+		},
+		{
+			Name:        "bytes",
+			Method:      http.MethodPost,
+			Path:        "/probe",
+			ContentType: "image/bmp",
+			Body:        bmp,
+			Status:      http.StatusOK,
+			Results:     []jsonResult{{Input: "-", Type: "bmp", Mime: "image/bmp", Width: 64, Height: 38}},
+		},
+		{
+			Name:   "no urls",
+			Method: http.MethodGet,
+			Path:   "/probe",
+			Status: http.StatusBadRequest,
+		},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.Method, srv.URL+c.Path, bytes.NewReader(c.Body))
+		if err != nil {
+			t.Fatalf("%s: new request: %v", c.Name, err)
+		}
+		if c.ContentType != "" {
+			req.Header.Set("Content-Type", c.ContentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request: %v", c.Name, err)
+		}
+		var results []jsonResult
+		if c.Status == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&results)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.Status || err != nil {
+			t.Fatalf("%s: unexpected response: status %d, decode error %v", c.Name, resp.StatusCode, err)
+		}
+		if len(results) != len(c.Results) {
+			t.Fatalf("%s: unexpected results: %+v", c.Name, results)
+		}
+		for i := range results {
+			if results[i] != c.Results[i] {
+				t.Errorf("%s: got %+v want %+v", c.Name, results[i], c.Results[i])
+			}
+		}
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	images := httptest.NewServer(http.FileServer(http.Dir("../../testdata")))
+	defer images.Close()
+	srv := httptest.NewServer(newServer(fastimage.GetHTTPImageOptions{}).routes())
+	defer srv.Close()
+
+	for _, name := range []string{"test.gif", "missing.gif"} {
+		resp, err := http.Get(srv.URL + "/probe?url=" + url.QueryEscape(images.URL+"/"+name))
+		if err != nil {
+			t.Fatalf("probe: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	var body bytes.Buffer
+	_, _ = body.ReadFrom(resp.Body)
+	for _, want := range []string{
+		`fastimage_probes_total{outcome="ok"} 1`,
+		`fastimage_probes_total{outcome="not_found"} 1`,
+		`fastimage_http_requests_total 2`,
+		`fastimage_probe_duration_seconds_bucket{origin="` + images.URL + `",le="+Inf"} 2`,
+		`fastimage_probe_duration_seconds_count{origin="` + images.URL + `"} 2`,
+	} {
+		if !strings.Contains(body.String(), want) {
+			t.Errorf("metrics lack %q:\n%s", want, body.String())
+		}
+	}
+}
+
+func TestMetricsOriginLimit(t *testing.T) {
+	m := newMetrics()
+	for i := range maxMetricOrigins + 10 {
+		m.observe(result{Input: fmt.Sprintf("https://host%d.example/a.png", i)})
+	}
+	if len(m.latency) != maxMetricOrigins+1 || m.latency["other"].count != 10 {
+		t.Fatalf("got %d origin series with %+v under other", len(m.latency), m.latency["other"])
+	}
+	m.observe(result{Input: "https://host0.example/b.png"})
+	if m.latency["https://host0.example"].count != 2 {
+		t.Errorf("known origin was not counted on its own series")
+	}
+}
+
+func TestServerRejectsLargeBatches(t *testing.T) {
+	srv := httptest.NewServer(newServer(fastimage.GetHTTPImageOptions{}).routes())
+	defer srv.Close()
+
+	body := strings.Repeat("http://example.com/a.png\n", maxServeURLs+1)
+	resp, err := http.Post(srv.URL+"/probe", "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+}
+
+func TestServerRejectsLargeImages(t *testing.T) {
+	srv := httptest.NewServer(newServer(fastimage.GetHTTPImageOptions{}).routes())
+	defer srv.Close()
+
+	// Bytes no format recognizes are read to the end, up to the limit.
+	body := io.LimitReader(zeroReader{}, maxServeImageBytes+1)
+	resp, err := http.Post(srv.URL+"/probe", "application/octet-stream", body)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// isImageFile reports whether r is a successfully probed local image file.
+func isImageFile(r result) bool {
+	return r.Err == nil && r.Info.Type != fastimage.Unknown && r.Input != "-" && !isHTTPURL(r.Input)
+}
+
+// sidecarOutput writes the result of each image file as JSON to a sidecar file next
+// to it, named after the file with ".json" appended, and passes every result on to
+// next.
+type sidecarOutput struct {
+	next output
+	meta bool
+}
+
+func (o *sidecarOutput) write(r result) error {
+	if isImageFile(r) {
+		out := newJSONResult(r)
+		out.Input = filepath.Base(r.Input)
+		if o.meta {
+			out.addMeta(r)
+		}
+		data, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(r.Input+".json", append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("sidecar: %w", err)
+		}
+	}
+	return o.next.write(r)
+}
+
+func (o *sidecarOutput) close() error {
+	return o.next.close()
+}
+
+// indexOutput collects image results and writes them to the index file name when
+// closed: an HTML gallery when name ends in .html or .htm, and otherwise a JSON array
+// in the -json-array shape. File inputs are made relative to the directory of the
+// index, so the index can be published next to the images. Every result is also
+// passed on to next.
+type indexOutput struct {
+	next    output
+	name    string
+	meta    bool
+	entries []jsonResult
+}
+
+func (o *indexOutput) write(r result) error {
+	if r.Err == nil && r.Info.Type != fastimage.Unknown {
+		out := newJSONResult(r)
+		if o.meta {
+			out.addMeta(r)
+		}
+		if isImageFile(r) {
+			out.Input = o.relative(r.Input)
+		}
+		o.entries = append(o.entries, out)
+	}
+	return o.next.write(r)
+}
+
+// relative returns path relative to the directory of the index, with forward
+// slashes, or path unchanged when it cannot be made relative.
+func (o *indexOutput) relative(path string) string {
+	dir, err := filepath.Abs(filepath.Dir(o.name))
+	if err != nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (o *indexOutput) close() error {
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(o.name)) {
+	case ".html", ".htm":
+		if err := galleryTemplate.Execute(&buf, o.entries); err != nil {
+			return err
+		}
+	default:
+		entries := o.entries
+		if entries == nil {
+			entries = []jsonResult{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if err := os.WriteFile(o.name, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	return o.next.close()
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Images</title>
+<style>
+body { font-family: sans-serif; display: flex; flex-wrap: wrap; gap: 1em; }
+figure { margin: 0; }
+img { max-width: 240px; height: auto; }
+figcaption { font-size: small; }
+</style>
+</head>
+<body>
+{{range .}}<figure>
+<img src="{{.Input}}" width="{{.Width}}" height="{{.Height}}" loading="lazy" alt="">
+<figcaption>{{.Input}} ({{.Type}}, {{.Width}}&times;{{.Height}})</figcaption>
+</figure>
+{{end}}</body>
+</html>
+`))
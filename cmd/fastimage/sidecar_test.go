@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func TestSidecarAndIndexOutput(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "img", "a.png")
+	if err := os.MkdirAll(filepath.Dir(image), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	results := []result{
+		{Input: image, Info: fastimage.Info{Type: fastimage.PNG, Width: 10, Height: 20}},
+		{Input: "https://example.com/b.gif", Info: fastimage.Info{Type: fastimage.GIF, Width: 1, Height: 2}},
+		{Input: filepath.Join(dir, "notes.txt")},
+	}
+
+	var collected collectOutput
+	jsonIndex := filepath.Join(dir, "index.json")
+	htmlIndex := filepath.Join(dir, "index.html")
+	var out output = &sidecarOutput{next: &collected}
+	out = &indexOutput{next: out, name: jsonIndex}
+	out = &indexOutput{next: out, name: htmlIndex}
+	for _, r := range results {
+		if err := out.write(r); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := out.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if len(collected.inputs) != len(results) {
+		t.Fatalf("results were not passed on: %+v", collected)
+	}
+
+	var sidecar jsonResult
+	data, err := os.ReadFile(image + ".json")
+	if err != nil {
+		t.Fatalf("read sidecar: %v", err)
+	}
+	if err := json.Unmarshal(data, &sidecar); err != nil || sidecar.Input != "a.png" || sidecar.Width != 10 {
+		t.Fatalf("unexpected sidecar %s: %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt.json")); err == nil {
+		t.Fatalf("sidecar written for a file that is not an image")
+	}
+
+	var index []jsonResult
+	data, err = os.ReadFile(jsonIndex)
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("decode index: %v", err)
+	}
+	if len(index) != 2 || index[0].Input != "img/a.png" || index[1].Input != "https://example.com/b.gif" {
+		t.Fatalf("unexpected index: %+v", index)
+	}
+
+	data, err = os.ReadFile(htmlIndex)
+	if err != nil {
+		t.Fatalf("read gallery: %v", err)
+	}
+	if !strings.Contains(string(data), `<img src="img/a.png" width="10" height="20"`) {
+		t.Fatalf("unexpected gallery:\n%s", data)
+	}
+}
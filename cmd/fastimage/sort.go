@@ -0,0 +1,74 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// sortKeys compare results by the fields -sort accepts.
+var sortKeys = map[string]func(a, b result) int{
+	"width":  func(a, b result) int { return cmp.Compare(a.Info.Width, b.Info.Width) },
+	"height": func(a, b result) int { return cmp.Compare(a.Info.Height, b.Info.Height) },
+	"pixels": func(a, b result) int {
+		return cmp.Compare(uint64(a.Info.Width)*uint64(a.Info.Height), uint64(b.Info.Width)*uint64(b.Info.Height))
+	},
+	"type": func(a, b result) int { return cmp.Compare(a.Info.Type.String(), b.Info.Type.String()) },
+	"size": func(a, b result) int { return cmp.Compare(a.Size, b.Size) },
+}
+
+// sortOutput buffers every result and writes them to next sorted when closed.
+// Failed inputs and unknown formats keep their input order after the images.
+type sortOutput struct {
+	next    output
+	compare func(a, b result) int
+	results []result
+}
+
+// newSortOutput parses a -sort value such as "pixels" or "width:desc".
+func newSortOutput(next output, value string) (*sortOutput, error) {
+	field, order, _ := strings.Cut(value, ":")
+	compare, ok := sortKeys[strings.ToLower(field)]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", field)
+	}
+	switch strings.ToLower(order) {
+	case "", "asc":
+	case "desc":
+		asc := compare
+		compare = func(a, b result) int { return asc(b, a) }
+	default:
+		return nil, fmt.Errorf("unknown sort order %q", order)
+	}
+	return &sortOutput{next: next, compare: compare}, nil
+}
+
+func (o *sortOutput) write(r result) error {
+	o.results = append(o.results, r)
+	return nil
+}
+
+func (o *sortOutput) close() error {
+	slices.SortStableFunc(o.results, func(a, b result) int {
+		aImage := a.Err == nil && a.Info.Type != fastimage.Unknown
+		bImage := b.Err == nil && b.Info.Type != fastimage.Unknown
+		switch {
+		case aImage && bImage:
+			return o.compare(a, b)
+		case aImage:
+			return -1
+		case bImage:
+			return 1
+		}
+		return 0
+	})
+	for _, r := range o.results {
+		if err := o.next.write(r); err != nil {
+			return err
+		}
+	}
+	return o.next.close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// collectOutput records the inputs of the results written to it.
+type collectOutput struct {
+	inputs []string
+}
+
+func (o *collectOutput) write(r result) error {
+	o.inputs = append(o.inputs, r.Input)
+	return nil
+}
+
+func (o *collectOutput) close() error {
+	return nil
+}
+
+func TestSortOutput(t *testing.T) {
+	results := []result{
+		{Input: "small.png", Info: fastimage.Info{Type: fastimage.PNG, Width: 10, Height: 10}, Size: 300},
+		{Input: "broken.jpg", Err: errors.New("boom")},
+		{Input: "wide.gif", Info: fastimage.Info{Type: fastimage.GIF, Width: 400, Height: 10}, Size: 100},
+		{Input: "notes.txt"},
+		{Input: "big.jpg", Info: fastimage.Info{Type: fastimage.JPEG, Width: 100, Height: 100}, Size: 200},
+	}
+	cases := []struct {
+		Sort   string
+		Inputs string
+	}{
+		{"pixels", "small.png wide.gif big.jpg broken.jpg notes.txt"},
+		{"pixels:desc", "big.jpg wide.gif small.png broken.jpg notes.txt"},
+		{"width:desc", "wide.gif big.jpg small.png broken.jpg notes.txt"},
+		{"type", "wide.gif big.jpg small.png broken.jpg notes.txt"},
+		{"size", "wide.gif big.jpg small.png broken.jpg notes.txt"},
+	}
+	for _, c := range cases {
+		collect := &collectOutput{}
+		out, err := newSortOutput(collect, c.Sort)
+		if err != nil {
+			t.Fatalf("new sort output %q: %v", c.Sort, err)
+		}
+		for _, r := range results {
+			_ = out.write(r)
+		}
+		if err := out.close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if got := strings.Join(collect.inputs, " "); got != c.Inputs {
+			t.Errorf("sort %q: got %s want %s", c.Sort, got, c.Inputs)
+		}
+	}
+
+	for _, value := range []string{"depth", "width:up"} {
+		if _, err := newSortOutput(&collectOutput{}, value); err == nil {
+			t.Errorf("expected an error for -sort %q", value)
+		}
+	}
+}
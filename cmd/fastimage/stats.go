@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// runStats totals the accounting of a run for -v.
+type runStats struct {
+	started  time.Time
+	inputs   int
+	failed   int
+	requests int
+	retries  int
+	bytes    int64
+}
+
+// add counts r and, when w is not nil, writes its accounting to w.
+func (s *runStats) add(w io.Writer, r result) error {
+	s.inputs++
+	if exitCodeFor(r) != exitOK {
+		s.failed++
+	}
+	retries := max(r.Stats.Attempts-1, 0)
+	s.requests += r.Stats.Requests
+	s.retries += retries
+	s.bytes += r.Stats.BytesFetched
+	if w == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "%s: %d bytes, %d requests, %d retries, %v\n",
+		r.Input, r.Stats.BytesFetched, r.Stats.Requests, retries, r.Stats.Elapsed.Round(time.Microsecond))
+	return err
+}
+
+// writeSummary writes the totals of the run to w.
+func (s *runStats) writeSummary(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%d inputs, %d failed, %d bytes, %d requests, %d retries in %v\n",
+		s.inputs, s.failed, s.bytes, s.requests, s.retries, time.Since(s.started).Round(time.Millisecond))
+	return err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// summary aggregates results for -summary.
+type summary struct {
+	byType  map[fastimage.Type]int
+	unknown int
+	failed  int
+
+	images         int
+	minW, maxW     uint32
+	minH, maxH     uint32
+	sumW, sumH     float64
+	totalMegapixel float64
+}
+
+func newSummary() *summary {
+	return &summary{byType: make(map[fastimage.Type]int)}
+}
+
+func (s *summary) add(r result) {
+	switch {
+	case r.Err != nil:
+		s.failed++
+		return
+	case r.Info.Type == fastimage.Unknown:
+		s.unknown++
+		return
+	}
+	s.byType[r.Info.Type]++
+	w, h := r.Info.Width, r.Info.Height
+	if s.images == 0 {
+		s.minW, s.maxW, s.minH, s.maxH = w, w, h, h
+	}
+	s.images++
+	s.minW, s.maxW = min(s.minW, w), max(s.maxW, w)
+	s.minH, s.maxH = min(s.minH, h), max(s.maxH, h)
+	s.sumW += float64(w)
+	s.sumH += float64(h)
+	s.totalMegapixel += float64(w) * float64(h) / 1e6
+}
+
+// writeTo writes the summary as an aligned table.
+func (s *summary) writeTo(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	types := make([]fastimage.Type, 0, len(s.byType))
+	for t := range s.byType {
+		types = append(types, t)
+	}
+	slices.SortFunc(types, func(a, b fastimage.Type) int {
+		if s.byType[a] != s.byType[b] {
+			return s.byType[b] - s.byType[a]
+		}
+		return int(a) - int(b)
+	})
+	for _, t := range types {
+		fmt.Fprintf(tw, "%s\t%d\n", t, s.byType[t])
+	}
+	fmt.Fprintf(tw, "unknown\t%d\n", s.unknown)
+	fmt.Fprintf(tw, "failed\t%d\n", s.failed)
+	if s.images > 0 {
+		n := float64(s.images)
+		fmt.Fprintf(tw, "width\tmin %d\tmax %d\tmean %.1f\n", s.minW, s.maxW, s.sumW/n)
+		fmt.Fprintf(tw, "height\tmin %d\tmax %d\tmean %.1f\n", s.minH, s.maxH, s.sumH/n)
+	}
+	fmt.Fprintf(tw, "total\t%d images\t%.2f megapixels\n", s.images, s.totalMegapixel)
+	return tw.Flush()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func TestSummary(t *testing.T) {
+	s := newSummary()
+	s.add(result{Info: fastimage.Info{Type: fastimage.PNG, Width: 100, Height: 50}})
+	s.add(result{Info: fastimage.Info{Type: fastimage.JPEG, Width: 2000, Height: 1000}})
+	s.add(result{Info: fastimage.Info{Type: fastimage.PNG, Width: 300, Height: 150}})
+	s.add(result{})
+	s.add(result{Err: errors.New("boom")})
+
+	var b strings.Builder
+	if err := s.writeTo(&b); err != nil {
+		t.Fatalf("write summary: %v", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+	want := []string{
+		"png 2",
+		"jpeg 1",
+		"unknown 1",
+		"failed 1",
+		"width min 100 max 2000 mean 800.0",
+		"height min 50 max 1000 mean 400.0",
+		"total 3 images 2.05 megapixels",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected summary:\n%s", b.String())
+	}
+}
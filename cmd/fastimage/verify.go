@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestEntry is an expected result. It has the shape of the -json output, so a
+// manifest can be created with "fastimage -json-array". Empty fields are not checked.
+type manifestEntry struct {
+	Input  string `json:"input"`
+	Type   string `json:"type,omitempty"`
+	Width  uint32 `json:"width,omitempty"`
+	Height uint32 `json:"height,omitempty"`
+}
+
+// runVerify runs "fastimage verify", which checks inputs against a manifest.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	httpFlags := newHTTPFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s verify [flags] <manifest.json>\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	options, err := httpFlags.options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	entries, err := readManifest(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	out := &verifyOutput{w: os.Stdout, expected: make(map[string]manifestEntry, len(entries))}
+	p := &prober{
+		ctx:         context.Background(),
+		out:         out,
+		concurrency: max(*httpFlags.concurrency, 1),
+		options:     options,
+		stats:       runStats{started: time.Now()},
+	}
+	for _, e := range entries {
+		out.expected[e.Input] = e
+		if err := p.add(job{name: e.Input}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitFailure
+		}
+	}
+	if err := p.flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(os.Stderr, "%d entries, %d mismatched\n", len(entries), out.mismatched)
+	if out.mismatched > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// readManifest reads a JSON array of entries or JSON Lines with one entry per line.
+// Every entry must name a different input.
+func readManifest(name string) ([]manifestEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	dec := json.NewDecoder(r)
+	var entries []manifestEntry
+	if first, err := peekNonSpace(r); err == nil && first == '[' {
+		if err := dec.Decode(&entries); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	} else {
+		for {
+			var e manifestEntry
+			err := dec.Decode(&e)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			entries = append(entries, e)
+		}
+	}
+	// Results are matched to entries by input, so a repeated input would be checked
+	// against only one of its entries.
+	seen := make(map[string]int, len(entries))
+	for i, e := range entries {
+		if e.Input == "" {
+			return nil, fmt.Errorf("%s: entry %d has no input", name, i+1)
+		}
+		if j, ok := seen[e.Input]; ok {
+			return nil, fmt.Errorf("%s: entry %d repeats the input %q of entry %d", name, i+1, e.Input, j+1)
+		}
+		seen[e.Input] = i
+	}
+	return entries, nil
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// verifyOutput compares results with their manifest entries and prints mismatches.
+type verifyOutput struct {
+	w          io.Writer
+	expected   map[string]manifestEntry
+	mismatched int
+}
+
+func (o *verifyOutput) write(r result) error {
+	problems := mismatches(o.expected[r.Input], r)
+	if len(problems) == 0 {
+		return nil
+	}
+	o.mismatched++
+	_, err := fmt.Fprintf(o.w, "%s: %s\n", r.Input, strings.Join(problems, ", "))
+	return err
+}
+
+func (o *verifyOutput) close() error {
+	return nil
+}
+
+// mismatches describes how r differs from the expected entry e.
+func mismatches(e manifestEntry, r result) []string {
+	if r.Err != nil {
+		return []string{r.Err.Error()}
+	}
+	got := newJSONResult(r)
+	var problems []string
+	if e.Type != "" && !strings.EqualFold(got.Type, e.Type) {
+		problems = append(problems, fmt.Sprintf("type %s, want %s", orUnknown(got.Type), e.Type))
+	}
+	if e.Width != 0 && got.Width != e.Width {
+		problems = append(problems, fmt.Sprintf("width %d, want %d", got.Width, e.Width))
+	}
+	if e.Height != 0 && got.Height != e.Height {
+		problems = append(problems, fmt.Sprintf("height %d, want %d", got.Height, e.Height))
+	}
+	return problems
+}
+
+func orUnknown(t string) string {
+	if t == "" {
+		return "unknown"
+	}
+	return t
+}
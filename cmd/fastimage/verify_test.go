@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		Name string
+		Data string
+	}{
+		{"array.json", `[{"input":"a.png","type":"png","width":1,"height":2},{"input":"b.gif"}]`},
+		{"lines.json", "{\"input\":\"a.png\",\"type\":\"png\",\"width\":1,\"height\":2}\n{\"input\":\"b.gif\"}\n"},
+	}
+	for _, c := range cases {
+		name := filepath.Join(dir, c.Name)
+		if err := os.WriteFile(name, []byte(c.Data), 0o644); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+		entries, err := readManifest(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", c.Name, err)
+		}
+		want := []manifestEntry{{Input: "a.png", Type: "png", Width: 1, Height: 2}, {Input: "b.gif"}}
+		if len(entries) != len(want) || entries[0] != want[0] || entries[1] != want[1] {
+			t.Fatalf("unexpected entries for %s: %+v", c.Name, entries)
+		}
+	}
+
+	name := filepath.Join(dir, "repeated.json")
+	if err := os.WriteFile(name, []byte(`[{"input":"a.png"},{"input":"b.gif"},{"input":"a.png","width":3}]`), 0o644); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	if _, err := readManifest(name); err == nil || !strings.Contains(err.Error(), `entry 3 repeats the input "a.png" of entry 1`) {
+		t.Fatalf("read repeated inputs: got error %v", err)
+	}
+}
+
+func TestMismatches(t *testing.T) {
+	png := fastimage.Info{Type: fastimage.PNG, Width: 320, Height: 50}
+	cases := []struct {
+		Entry    manifestEntry
+		Result   result
+		Problems string
+	}{
+		{manifestEntry{Type: "png", Width: 320, Height: 50}, result{Info: png}, ""},
+		{manifestEntry{Type: "PNG"}, result{Info: png}, ""},
+		{manifestEntry{Width: 640}, result{Info: png}, "width 320, want 640"},
+		{manifestEntry{Type: "jpeg", Height: 60}, result{Info: png}, "type png, want jpeg, height 50, want 60"},
+		{manifestEntry{Type: "png"}, result{}, "type unknown, want png"},
+		{manifestEntry{}, result{Err: errors.New("boom")}, "boom"},
+	}
+	for _, c := range cases {
+		if got := strings.Join(mismatches(c.Entry, c.Result), ", "); got != c.Problems {
+			t.Errorf("mismatches(%+v, %+v) = %q, want %q", c.Entry, c.Result.Info, got, c.Problems)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+//go:build cgo
+
+// Command libfastimage exposes the detector to C and to languages with a C foreign
+// function interface when built as a shared library:
+//
+//	go build -buildmode=c-shared -o libfastimage.so ./cmd/libfastimage
+//
+// The build also writes libfastimage.h, which declares:
+//
+//	int fastimage_get_info(unsigned char* buf, size_t length, fastimage_info* out);
+//	int fastimage_probe_url(char* url, int timeout_ms, fastimage_info* out, char* err, size_t err_len);
+//
+// fastimage_get_info detects the image in the length bytes at buf and returns 1
+// when its type was found, 0 otherwise. fastimage_probe_url probes url with range
+// requests, bounded by timeout_ms when it is positive, and returns 0 on success or
+// -1 with a NUL-terminated message in err, truncated to err_len bytes. Both fill
+// out, whose strings are NUL-terminated and empty for unknown formats, and neither
+// keeps any pointer it was given. The python and ruby directories hold thin
+// wrappers around the library.
+package main
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+
+typedef struct {
+	int type;
+	char type_name[16];
+	char mime[64];
+	uint32_t width;
+	uint32_t height;
+} fastimage_info;
+*/
+import "C"
+
+import (
+	"context"
+	"time"
+	"unsafe"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func main() {}
+
+//export fastimage_get_info
+func fastimage_get_info(buf *C.uchar, length C.size_t, out *C.fastimage_info) C.int {
+	var p []byte
+	if buf != nil && length > 0 {
+		// GetInfo does not keep p, so the caller's memory is read in place.
+		p = unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(length))
+	}
+	info := fastimage.GetInfo(p)
+	fillInfo(out, info)
+	if info.Type == fastimage.Unknown {
+		return 0
+	}
+	return 1
+}
+
+//export fastimage_probe_url
+func fastimage_probe_url(url *C.char, timeout_ms C.int, out *C.fastimage_info, err *C.char, err_len C.size_t) C.int {
+	ctx := context.Background()
+	if timeout_ms > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout_ms)*time.Millisecond)
+		defer cancel()
+	}
+	result := fastimage.GetHTTPImageInfo(ctx, []string{C.GoString(url)})[0]
+	fillInfo(out, result.Info)
+	if result.Error != nil {
+		if err != nil && err_len > 0 {
+			copyString(unsafe.Slice(err, int(err_len)), result.Error.Error())
+		}
+		return -1
+	}
+	return 0
+}
+
+// fillInfo copies info into out, when out is not NULL.
+func fillInfo(out *C.fastimage_info, info fastimage.Info) {
+	if out == nil {
+		return
+	}
+	out._type = C.int(info.Type)
+	copyString(out.type_name[:], info.Type.String())
+	copyString(out.mime[:], info.Type.Mime())
+	out.width = C.uint32_t(info.Width)
+	out.height = C.uint32_t(info.Height)
+}
+
+// copyString copies s into dst as a NUL-terminated string, truncated to fit.
+func copyString(dst []C.char, s string) {
+	n := min(len(s), len(dst)-1)
+	for i := range n {
+		dst[i] = C.char(s[i])
+	}
+	dst[n] = 0
+}
@@ -0,0 +1,74 @@
+"""Thin ctypes wrapper around libfastimage, the c-shared build of fastimage.
+
+Build the library with
+
+    go build -buildmode=c-shared -o libfastimage.so ./cmd/libfastimage
+
+and point FASTIMAGE_LIB at it, or keep it next to this file.
+"""
+
+import ctypes
+import os
+from collections import namedtuple
+
+Info = namedtuple("Info", ["type", "mime", "width", "height"])
+
+
+class _Info(ctypes.Structure):
+    _fields_ = [
+        ("type", ctypes.c_int),
+        ("type_name", ctypes.c_char * 16),
+        ("mime", ctypes.c_char * 64),
+        ("width", ctypes.c_uint32),
+        ("height", ctypes.c_uint32),
+    ]
+
+    def to_info(self):
+        return Info(
+            self.type_name.decode(),
+            self.mime.decode(),
+            self.width,
+            self.height,
+        )
+
+
+def _load():
+    path = os.environ.get("FASTIMAGE_LIB")
+    if not path:
+        name = {"nt": "libfastimage.dll"}.get(os.name, "libfastimage.so")
+        path = os.path.join(os.path.dirname(os.path.abspath(__file__)), name)
+    lib = ctypes.CDLL(path)
+    lib.fastimage_get_info.argtypes = [ctypes.c_char_p, ctypes.c_size_t, ctypes.POINTER(_Info)]
+    lib.fastimage_get_info.restype = ctypes.c_int
+    lib.fastimage_probe_url.argtypes = [
+        ctypes.c_char_p,
+        ctypes.c_int,
+        ctypes.POINTER(_Info),
+        ctypes.c_char_p,
+        ctypes.c_size_t,
+    ]
+    lib.fastimage_probe_url.restype = ctypes.c_int
+    return lib
+
+
+_lib = _load()
+
+
+def get_info(data):
+    """Return the Info of the image in data, with an empty type when unknown."""
+    out = _Info()
+    _lib.fastimage_get_info(bytes(data), len(data), ctypes.byref(out))
+    return out.to_info()
+
+
+def probe_url(url, timeout=None):
+    """Probe url with range requests and return its Info.
+
+    timeout is in seconds. Raises OSError when the URL cannot be probed.
+    """
+    out = _Info()
+    err = ctypes.create_string_buffer(512)
+    timeout_ms = int(timeout * 1000) if timeout else 0
+    if _lib.fastimage_probe_url(url.encode(), timeout_ms, ctypes.byref(out), err, len(err)) != 0:
+        raise OSError(err.value.decode(errors="replace"))
+    return out.to_info()
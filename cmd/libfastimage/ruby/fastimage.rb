@@ -0,0 +1,60 @@
+# Thin Fiddle wrapper around libfastimage, the c-shared build of fastimage.
+#
+# Build the library with
+#
+#   go build -buildmode=c-shared -o libfastimage.so ./cmd/libfastimage
+#
+# and point FASTIMAGE_LIB at it, or keep it next to this file.
+
+require 'fiddle'
+require 'fiddle/import'
+
+module FastImage
+  Info = Struct.new(:type, :mime, :width, :height)
+
+  module Lib
+    extend Fiddle::Importer
+
+    dlload ENV.fetch('FASTIMAGE_LIB') { File.join(__dir__, 'libfastimage.so') }
+
+    typealias 'size_t', 'unsigned long'
+    CInfo = struct [
+      'int type',
+      'char type_name[16]',
+      'char mime[64]',
+      'unsigned int width',
+      'unsigned int height'
+    ]
+
+    extern 'int fastimage_get_info(unsigned char*, size_t, void*)'
+    extern 'int fastimage_probe_url(char*, int, void*, char*, size_t)'
+  end
+
+  # Returns the Info of the image in data, with an empty type when unknown.
+  def self.get_info(data)
+    out = Lib::CInfo.malloc(Fiddle::RUBY_FREE)
+    Lib.fastimage_get_info(data, data.bytesize, out)
+    to_info(out)
+  end
+
+  # Probes url with range requests and returns its Info. timeout is in seconds.
+  # Raises IOError when the URL cannot be probed.
+  def self.probe_url(url, timeout: nil)
+    out = Lib::CInfo.malloc(Fiddle::RUBY_FREE)
+    err = "\0" * 512
+    timeout_ms = timeout ? (timeout * 1000).to_i : 0
+    raise IOError, err.unpack1('Z*') if Lib.fastimage_probe_url(url, timeout_ms, out, err, err.bytesize) != 0
+
+    to_info(out)
+  end
+
+  def self.to_info(out)
+    Info.new(c_string(out.type_name), c_string(out.mime), out.width, out.height)
+  end
+  private_class_method :to_info
+
+  def self.c_string(chars)
+    chars.pack('c*').unpack1('Z*')
+  end
+  private_class_method :c_string
+end
@@ -0,0 +1,74 @@
+package fastimage
+
+import (
+	"bytes"
+	"image"
+	stdgif "image/gif"
+	stdjpeg "image/jpeg"
+	stdpng "image/png"
+	"io"
+	"sync"
+)
+
+// DecodeFunc decodes an image, with the signature of image.Decode minus the format
+// name, as exposed by the standard and golang.org/x/image decoder packages.
+type DecodeFunc func(r io.Reader) (image.Image, error)
+
+var decoders = struct {
+	sync.RWMutex
+	m map[Type]DecodeFunc
+}{m: map[Type]DecodeFunc{
+	GIF:  stdgif.Decode,
+	JPEG: stdjpeg.Decode,
+	PNG:  stdpng.Decode,
+	APNG: stdpng.Decode,  // the first frame
+	MPO:  stdjpeg.Decode, // the first image
+}}
+
+// decoderPackages names the packages providing decoders for types the standard
+// library cannot decode.
+var decoderPackages = map[Type]string{
+	BMP:  "golang.org/x/image/bmp",
+	TIFF: "golang.org/x/image/tiff",
+	WEBP: "golang.org/x/image/webp",
+}
+
+// RegisterDecoder makes decode the decoder returned by Decoder for t, replacing any
+// previous one. GIF, JPEG and PNG, and APNG and MPO as their first image, are
+// registered with the standard library decoders; other formats need one
+// registered, for example:
+//
+//	fastimage.RegisterDecoder(fastimage.WEBP, webp.Decode)
+func RegisterDecoder(t Type, decode DecodeFunc) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	decoders.m[t] = decode
+}
+
+// Decoder returns the decoder for images of type t, or a *MissingDecoderError
+// naming the package that provides one when none is registered.
+func Decoder(t Type) (DecodeFunc, error) {
+	decoders.RLock()
+	decode := decoders.m[t]
+	decoders.RUnlock()
+	if decode == nil {
+		return nil, &MissingDecoderError{Type: t, Package: decoderPackages[t]}
+	}
+	return decode, nil
+}
+
+// Decode probes the image read from r and decodes it with the decoder for its type.
+// The probed info is returned even when no decoder is registered for the type.
+func Decode(r io.Reader) (image.Image, Info, error) {
+	var head bytes.Buffer
+	info, err := GetInfoReader(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, info, err
+	}
+	decode, err := Decoder(info.Type)
+	if err != nil {
+		return nil, info, err
+	}
+	img, err := decode(io.MultiReader(&head, r))
+	return img, info, err
+}
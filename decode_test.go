@@ -0,0 +1,86 @@
+package fastimage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	for _, c := range []struct {
+		file string
+		info Info
+	}{
+		{"animated.gif", Info{GIF, 16, 12}},
+		{"pass-1_s.png", Info{PNG, 90, 60}},
+		{"blink.png", Info{APNG, 24, 16}},
+		{"stereo.mpo", Info{MPO, 64, 48}},
+	} {
+		f, err := os.Open("testdata/" + c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, info, err := Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Decode(%s): %v", c.file, err)
+		}
+		if info != c.info {
+			t.Errorf("Decode(%s) info = %+v, want %+v", c.file, info, c.info)
+		}
+		if b := img.Bounds(); b.Dx() != int(c.info.Width) || b.Dy() != int(c.info.Height) {
+			t.Errorf("Decode(%s) bounds = %v, want %dx%d", c.file, b, c.info.Width, c.info.Height)
+		}
+	}
+}
+
+func TestDecoderMissing(t *testing.T) {
+	data, err := os.ReadFile("testdata/bexjdic.tif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, info, err := Decode(bytes.NewReader(data))
+	var missing *MissingDecoderError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Decode(tiff) error = %v, want *MissingDecoderError", err)
+	}
+	if info.Type != TIFF || missing.Type != TIFF || missing.Package != "golang.org/x/image/tiff" {
+		t.Fatalf("unexpected info %+v and error %+v", info, missing)
+	}
+	if !strings.Contains(err.Error(), "golang.org/x/image/tiff") {
+		t.Fatalf("error does not name the package: %v", err)
+	}
+
+	if _, err := Decoder(Unknown); err == nil {
+		t.Fatal("Decoder(Unknown) returned a decoder")
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	decoders.Lock()
+	saved, had := decoders.m[XBM]
+	decoders.Unlock()
+	t.Cleanup(func() {
+		decoders.Lock()
+		defer decoders.Unlock()
+		if had {
+			decoders.m[XBM] = saved
+		} else {
+			delete(decoders.m, XBM)
+		}
+	})
+
+	want := image.NewGray(image.Rect(0, 0, 1, 1))
+	RegisterDecoder(XBM, func(io.Reader) (image.Image, error) { return want, nil })
+	decode, err := Decoder(XBM)
+	if err != nil {
+		t.Fatalf("Decoder(XBM): %v", err)
+	}
+	if img, _ := decode(nil); img != want {
+		t.Fatal("Decoder(XBM) did not return the registered decoder")
+	}
+}
@@ -0,0 +1,24 @@
+package fastimage
+
+import "net/http"
+
+// sniffLen is the number of bytes DetectContentType considers, as in net/http.
+const sniffLen = 512
+
+// DetectContentType is a drop-in for http.DetectContentType that also returns the
+// image info. It considers at most the first 512 bytes of p and returns the MIME
+// type of any image format this package knows, along with its dimensions when they
+// fit in those bytes. For everything else it falls back to http.DetectContentType,
+// so it always returns a valid MIME type, "application/octet-stream" at worst, and
+// a zero Info.
+func DetectContentType(p []byte) (string, Info) {
+	if len(p) > sniffLen {
+		p = p[:sniffLen]
+	}
+	if t := GetType(p); t != Unknown {
+		info := GetInfo(p)
+		info.Type = t
+		return t.Mime(), info
+	}
+	return http.DetectContentType(p), Info{}
+}
@@ -0,0 +1,43 @@
+package fastimage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	cases := []struct {
+		file string
+		mime string
+		info Info
+	}{
+		{"pak38.gif", "image/gif", Info{GIF, 333, 194}},
+		{"test.gif", "image/gif", Info{GIF, 60, 40}},
+		{"letter_T.jpg", "image/jpeg", Info{JPEG, 52, 54}},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile("testdata/" + c.file)
+		if err != nil {
+			t.Fatalf("read %s: %v", c.file, err)
+		}
+		mime, info := DetectContentType(data)
+		if mime != c.mime || info != c.info {
+			t.Errorf("DetectContentType(%s) = %q, %+v, want %q, %+v", c.file, mime, info, c.mime, c.info)
+		}
+	}
+
+	for _, c := range []struct {
+		data string
+		mime string
+	}{
+		{"<!DOCTYPE html><html><body>hello</body></html>", "text/html; charset=utf-8"},
+		{"plain text", "text/plain; charset=utf-8"},
+		{"", "text/plain; charset=utf-8"},
+		{"\x00\x01\x02\x03", "application/octet-stream"},
+	} {
+		mime, info := DetectContentType([]byte(c.data))
+		if mime != c.mime || info != (Info{}) {
+			t.Errorf("DetectContentType(%q) = %q, %+v, want %q and no info", c.data, mime, info, c.mime)
+		}
+	}
+}
@@ -3,9 +3,39 @@ package fastimage
 import (
 	"fmt"
 	"io"
+	"strings"
 	"time"
 )
 
+// errorMessage returns the message of err, or "" when err is nil. Result types
+// encode their errors to JSON with it, as error values have no JSON form.
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// ProbeError is the error reported for a URL that could not be probed. It carries the
+// accounting of the probe and wraps the underlying error, so errors.Is and errors.As
+// see through it.
+type ProbeError struct {
+	URL string
+	// Attempts is the number of times the probe was started, including retries.
+	Attempts int
+	// BytesFetched is the number of response body bytes read across all requests.
+	BytesFetched int64
+	// StatusCode is the status of the last HTTP response, or 0 if none was received.
+	StatusCode int
+	Err        error
+}
+
+func (e *ProbeError) Error() string {
+	return fmt.Sprintf("fastimage: probing %s: %s", e.URL, strings.TrimPrefix(e.Err.Error(), "fastimage: "))
+}
+
+func (e *ProbeError) Unwrap() error { return e.Err }
+
 type HTTPStatusError struct {
 	URL        string
 	StatusCode int
@@ -39,3 +69,79 @@ func (e *InsufficientBytesError) Error() string {
 
 // Let callers use errors.Is(err, io.ErrUnexpectedEOF).
 func (e *InsufficientBytesError) Unwrap() error { return io.ErrUnexpectedEOF }
+
+type HTMLImageNotFoundError struct {
+	URL string
+}
+
+func (e *HTMLImageNotFoundError) Error() string {
+	return fmt.Sprintf("fastimage: no image referenced by HTML page %s", e.URL)
+}
+
+// HTMLImageNotImageError reports an HTML page whose og:image, twitter:image or
+// image_src target is an HTML page too, which is not followed further.
+type HTMLImageNotImageError struct {
+	URL      string
+	ImageURL string
+}
+
+func (e *HTMLImageNotImageError) Error() string {
+	return fmt.Sprintf("fastimage: og:image target %s of HTML page %s is not an image", e.ImageURL, e.URL)
+}
+
+// RobotsDisallowedError reports a URL that was not requested because the robots.txt
+// of its origin disallows it, with GetHTTPImageOptions.RespectRobots set.
+type RobotsDisallowedError struct {
+	URL string
+}
+
+func (e *RobotsDisallowedError) Error() string {
+	return fmt.Sprintf("fastimage: %s is disallowed by robots.txt", e.URL)
+}
+
+// MissingDecoderError reports an image type that Decoder has no decoder for.
+// Package names the Go package providing one, when there is a known one.
+type MissingDecoderError struct {
+	Type    Type
+	Package string
+}
+
+func (e *MissingDecoderError) Error() string {
+	if e.Type == Unknown {
+		return "fastimage: no decoder for unknown image type"
+	}
+	if e.Package == "" {
+		return fmt.Sprintf("fastimage: no decoder registered for %s", e.Type)
+	}
+	return fmt.Sprintf("fastimage: no decoder registered for %s; import %s and register its Decode with fastimage.RegisterDecoder", e.Type, e.Package)
+}
+
+// UploadRejectedError reports a request body refused by GateUploads.
+type UploadRejectedError struct {
+	// Info is what was detected of the body. Its Type is Unknown when the body is not
+	// a recognized image, and its dimensions are zero when they were not needed or
+	// not found.
+	Info Info
+	// StatusCode is the status the request is rejected with by default: 415 for
+	// bodies that are not an accepted image type and 413 for images exceeding the
+	// dimension limits.
+	StatusCode int
+	Reason     string
+}
+
+func (e *UploadRejectedError) Error() string {
+	if e.Info.Width != 0 && e.Info.Height != 0 {
+		return fmt.Sprintf("fastimage: upload rejected: %s (%s, %dx%d)", e.Reason, e.Info.Type, e.Info.Width, e.Info.Height)
+	}
+	return "fastimage: upload rejected: " + e.Reason
+}
+
+// RangeNotSupportedError reports a server that answered a range request with the
+// whole file, or without the size of the file, where only ranges make sense.
+type RangeNotSupportedError struct {
+	URL string
+}
+
+func (e *RangeNotSupportedError) Error() string {
+	return fmt.Sprintf("fastimage: %s does not support range requests", e.URL)
+}
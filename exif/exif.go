@@ -0,0 +1,256 @@
+// Package exif decodes common EXIF tags, such as the camera, the capture time, the
+// exposure and the GPS position, from the header bytes of JPEG, PNG, WebP, TIFF,
+// AVIF and HEIC files, as located by fastimage.GetEXIF.
+package exif
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// ErrNotFound is returned by Decode when the bytes hold no EXIF data.
+var ErrNotFound = errors.New("exif: no EXIF data found")
+
+// Tags holds the decoded EXIF tags. Zero values mean the tag was not found within
+// the provided bytes.
+type Tags struct {
+	Make     string `json:"make,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Software string `json:"software,omitempty"`
+	// Orientation is the EXIF orientation, 1 to 8.
+	Orientation int `json:"orientation,omitempty"`
+	// DateTime is when the file was last changed, and DateTimeOriginal when the
+	// picture was taken. They are in the time zone of their OffsetTime tags, or in
+	// UTC when the file records none, which usually means camera local time.
+	DateTime         time.Time     `json:"date_time,omitzero"`
+	DateTimeOriginal time.Time     `json:"date_time_original,omitzero"`
+	ExposureTime     time.Duration `json:"exposure_time,omitempty"`
+	FNumber          float64       `json:"f_number,omitempty"`
+	ISO              int           `json:"iso,omitempty"`
+	// FocalLength is in millimeters.
+	FocalLength float64 `json:"focal_length,omitempty"`
+	LensModel   string  `json:"lens_model,omitempty"`
+	// GPS is the position the picture was taken at, or nil.
+	GPS *GPS `json:"gps,omitempty"`
+}
+
+// GPS is a position from the GPS IFD.
+type GPS struct {
+	// Latitude and Longitude are in degrees, negative to the south and west.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Altitude is in meters, negative below sea level.
+	Altitude float64 `json:"altitude,omitempty"`
+}
+
+// Tags of IFD0 and of the Exif and GPS IFDs it points to.
+const (
+	tagMake               = 0x010f
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagSoftware           = 0x0131
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagExposureTime       = 0x829a
+	tagFNumber            = 0x829d
+	tagISO                = 0x8827
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTime         = 0x9010
+	tagOffsetTimeOriginal = 0x9011
+	tagFocalLength        = 0x920a
+	tagLensModel          = 0xa434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// Decode decodes the EXIF tags of the image starting with p. Tags whose values lie
+// beyond p are left zero, so more bytes may reveal more.
+func Decode(p []byte) (*Tags, error) {
+	b := fastimage.GetEXIF(p)
+	if b == nil {
+		return nil, ErrNotFound
+	}
+	return DecodeTIFF(b)
+}
+
+// DecodeTIFF decodes EXIF tags from TIFF-format data, such as the payload of a
+// JPEG APP1 segment after its "Exif\x00\x00" identifier.
+func DecodeTIFF(b []byte) (*Tags, error) {
+	var order binary.ByteOrder
+	switch {
+	case len(b) < 8:
+		return nil, ErrNotFound
+	case b[0] == 'I' && b[1] == 'I':
+		order = binary.LittleEndian
+	case b[0] == 'M' && b[1] == 'M':
+		order = binary.BigEndian
+	default:
+		return nil, ErrNotFound
+	}
+	d := decoder{b: b, order: order}
+	ifd0 := d.ifd(order.Uint32(b[4:8]))
+
+	t := &Tags{
+		Make:        d.string(ifd0[tagMake]),
+		Model:       d.string(ifd0[tagModel]),
+		Software:    d.string(ifd0[tagSoftware]),
+		Orientation: int(d.uint(ifd0[tagOrientation])),
+	}
+	exif := d.ifd(d.uint(ifd0[tagExifIFD]))
+	t.DateTime = d.time(ifd0[tagDateTime], exif[tagOffsetTime])
+	t.DateTimeOriginal = d.time(exif[tagDateTimeOriginal], exif[tagOffsetTimeOriginal])
+	if seconds := d.rational(exif[tagExposureTime], 0); seconds > 0 {
+		t.ExposureTime = time.Duration(seconds * float64(time.Second))
+	}
+	t.FNumber = d.rational(exif[tagFNumber], 0)
+	t.ISO = int(d.uint(exif[tagISO]))
+	t.FocalLength = d.rational(exif[tagFocalLength], 0)
+	t.LensModel = d.string(exif[tagLensModel])
+
+	if gps := d.ifd(d.uint(ifd0[tagGPSIFD])); gps[tagGPSLatitude].count >= 3 && gps[tagGPSLongitude].count >= 3 {
+		t.GPS = &GPS{
+			Latitude:  d.degrees(gps[tagGPSLatitude]),
+			Longitude: d.degrees(gps[tagGPSLongitude]),
+			Altitude:  d.rational(gps[tagGPSAltitude], 0),
+		}
+		if d.string(gps[tagGPSLatitudeRef]) == "S" {
+			t.GPS.Latitude = -t.GPS.Latitude
+		}
+		if d.string(gps[tagGPSLongitudeRef]) == "W" {
+			t.GPS.Longitude = -t.GPS.Longitude
+		}
+		if d.uint(gps[tagGPSAltitudeRef]) == 1 {
+			t.GPS.Altitude = -t.GPS.Altitude
+		}
+	}
+	return t, nil
+}
+
+// entry is an IFD entry: its field type, its count and where its value is.
+type entry struct {
+	typ   uint16
+	count uint32
+	// value is the 4-byte value field, holding the value or its offset.
+	value []byte
+}
+
+type decoder struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+// ifd returns the entries of the IFD at offset, as far as b holds them.
+func (d decoder) ifd(offset uint32) map[uint16]entry {
+	if offset < 8 || int64(offset)+2 > int64(len(d.b)) {
+		return nil
+	}
+	i := int(offset)
+	n := int(d.order.Uint16(d.b[i : i+2]))
+	entries := make(map[uint16]entry, n)
+	for i += 2; n > 0 && i+12 <= len(d.b); i, n = i+12, n-1 {
+		entries[d.order.Uint16(d.b[i:i+2])] = entry{
+			typ:   d.order.Uint16(d.b[i+2 : i+4]),
+			count: d.order.Uint32(d.b[i+4 : i+8]),
+			value: d.b[i+8 : i+12],
+		}
+	}
+	return entries
+}
+
+// data returns the bytes of the value of e, or nil when they lie beyond b.
+func (d decoder) data(e entry) []byte {
+	var size int64
+	switch e.typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		size = 1
+	case 3, 8: // SHORT, SSHORT
+		size = 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		size = 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		size = 8
+	default:
+		return nil
+	}
+	size *= int64(e.count)
+	if size <= 4 {
+		return e.value[:size]
+	}
+	offset := int64(d.order.Uint32(e.value))
+	if offset+size > int64(len(d.b)) {
+		return nil
+	}
+	return d.b[offset : offset+size]
+}
+
+// uint returns the first value of an unsigned integer entry.
+func (d decoder) uint(e entry) uint32 {
+	v := d.data(e)
+	switch {
+	case e.typ == 1 && len(v) >= 1:
+		return uint32(v[0])
+	case e.typ == 3 && len(v) >= 2:
+		return uint32(d.order.Uint16(v))
+	case e.typ == 4 && len(v) >= 4:
+		return d.order.Uint32(v)
+	}
+	return 0
+}
+
+// rational returns the index-th value of a RATIONAL or SRATIONAL entry.
+func (d decoder) rational(e entry, index int) float64 {
+	v := d.data(e)
+	if (e.typ != 5 && e.typ != 10) || len(v) < 8*(index+1) {
+		return 0
+	}
+	v = v[8*index:]
+	num, den := d.order.Uint32(v[0:4]), d.order.Uint32(v[4:8])
+	if den == 0 {
+		return 0
+	}
+	if e.typ == 10 {
+		return float64(int32(num)) / float64(int32(den))
+	}
+	return float64(num) / float64(den)
+}
+
+// string returns the value of an ASCII entry without its terminating NULs and
+// padding.
+func (d decoder) string(e entry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(d.data(e)), "\x00")
+	return strings.TrimSpace(s)
+}
+
+// time parses a date and time entry, in the zone of the offset entry when there is
+// one.
+func (d decoder) time(e, offset entry) time.Time {
+	s := d.string(e)
+	if s == "" {
+		return time.Time{}
+	}
+	if zone := d.string(offset); zone != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", s+zone); err == nil {
+			return t
+		}
+	}
+	t, _ := time.Parse("2006:01:02 15:04:05", s)
+	return t
+}
+
+// degrees converts degrees, minutes and seconds to degrees.
+func (d decoder) degrees(e entry) float64 {
+	return d.rational(e, 0) + d.rational(e, 1)/60 + d.rational(e, 2)/3600
+}
@@ -0,0 +1,68 @@
+package exif
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	data, err := os.ReadFile("../testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Make != "Canon" || tags.Model != "Canon EOS R5" || tags.Software != "Firmware 1.8.1" || tags.Orientation != 1 {
+		t.Errorf("got %q %q %q orientation %d", tags.Make, tags.Model, tags.Software, tags.Orientation)
+	}
+	want := time.Date(2024, 5, 17, 14, 3, 10, 0, time.FixedZone("", 2*60*60))
+	if !tags.DateTimeOriginal.Equal(want) {
+		t.Errorf("DateTimeOriginal = %v, want %v", tags.DateTimeOriginal, want)
+	}
+	if want := time.Date(2024, 5, 17, 14, 3, 11, 0, time.UTC); !tags.DateTime.Equal(want) {
+		t.Errorf("DateTime = %v, want %v", tags.DateTime, want)
+	}
+	if tags.ExposureTime != 4*time.Millisecond || tags.FNumber != 2.8 || tags.ISO != 400 || tags.FocalLength != 50 {
+		t.Errorf("got exposure %v f/%g ISO %d %gmm", tags.ExposureTime, tags.FNumber, tags.ISO, tags.FocalLength)
+	}
+	if tags.LensModel != "RF50mm F1.8 STM" {
+		t.Errorf("LensModel = %q", tags.LensModel)
+	}
+	if tags.GPS == nil {
+		t.Fatal("no GPS position")
+	}
+	if lat, lon := tags.GPS.Latitude, tags.GPS.Longitude; lat < 48.8580 || lat > 48.8581 || lon < 2.2944 || lon > 2.2945 {
+		t.Errorf("GPS = %g, %g, want about 48.85805, 2.29448", lat, lon)
+	}
+	if tags.GPS.Altitude != 35.12 {
+		t.Errorf("Altitude = %g, want 35.12", tags.GPS.Altitude)
+	}
+}
+
+func TestDecodeNotFound(t *testing.T) {
+	data, err := os.ReadFile("../testdata/letter_T.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(data); err != ErrNotFound {
+		t.Errorf("Decode() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	data, err := os.ReadFile("../testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IFD0 and the start of its values only.
+	tags, err := Decode(data[:120])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Make != "Canon" || tags.GPS != nil || !tags.DateTimeOriginal.IsZero() {
+		t.Errorf("got %+v", tags)
+	}
+}
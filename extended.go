@@ -0,0 +1,833 @@
+package fastimage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"slices"
+	"time"
+)
+
+// ExtendedInfo holds the image info along with properties that some formats record
+// in their headers. Zero values mean the property was not found in the provided
+// bytes or is not reported for the format.
+type ExtendedInfo struct {
+	Info
+	// Orientation is the EXIF orientation, 1 to 8.
+	Orientation int `json:"orientation,omitempty"`
+	// DPIX and DPIY are the horizontal and vertical resolution in dots per inch.
+	DPIX float64 `json:"dpi_x,omitempty"`
+	DPIY float64 `json:"dpi_y,omitempty"`
+	// Alpha reports whether the image has an alpha channel or transparency.
+	Alpha bool `json:"alpha,omitempty"`
+	// Animated reports whether the image has more than one frame.
+	Animated bool `json:"animated,omitempty"`
+	// BitDepth is the number of bits per channel, or per index for palette images.
+	BitDepth int `json:"bit_depth,omitempty"`
+	// Sequence reports whether an AVIF or HEIC file declares an image sequence
+	// brand, such as burst photos or animations, rather than only still images.
+	Sequence bool `json:"sequence,omitempty"`
+	// Pictures is the number of images an MPO file holds, such as the two views of
+	// a stereo photo.
+	Pictures int `json:"pictures,omitempty"`
+	// Channels is the number of channels, including alpha and extra channels.
+	Channels int `json:"channels,omitempty"`
+	// ColorModel is the color model the channels are in.
+	ColorModel ColorModel `json:"color_model,omitempty"`
+	// Frames is the number of frames of an animation: as declared by an APNG, or
+	// as found in the bytes walked for an animated GIF or WebP, which is short of
+	// the total when the file is longer.
+	Frames int `json:"frames,omitempty"`
+	// Loops is how many times an animated WebP or APNG plays, 0 meaning forever.
+	Loops int `json:"loops,omitempty"`
+	// Duration is the sum of the frame delays of an animated GIF or WebP found in
+	// the bytes walked. Browsers play GIF delays under 20ms slower, so it can be
+	// shorter than what viewers see.
+	Duration time.Duration `json:"duration,omitempty"`
+	// ICC reports whether the image embeds an ICC color profile.
+	ICC bool `json:"icc,omitempty"`
+	// ColorPrimaries and TransferCharacteristics are the coding-independent code
+	// points of ITU-T H.273 that AVIF and HEIC files give in an nclx colr box, such
+	// as 9 for BT.2020 primaries and 16 for the PQ transfer function.
+	ColorPrimaries          int `json:"color_primaries,omitempty"`
+	TransferCharacteristics int `json:"transfer_characteristics,omitempty"`
+	// HDR reports whether the transfer function is PQ or HLG, which HDR images use.
+	HDR bool `json:"hdr,omitempty"`
+	// Quality is the estimated quality factor of a JPEG file, 1 to 100 on the
+	// libjpeg scale, from how its luminance quantization table scales the standard
+	// one. Encoders with their own tables get the closest libjpeg quality.
+	Quality int `json:"quality,omitempty"`
+	// Layers is the number of layers of a PSD file, found when the provided bytes
+	// reach its layer info section. Flattened files have none.
+	Layers int `json:"layers,omitempty"`
+	// WebPFormat is the image chunk a WebP file starts with: "VP8" for lossy,
+	// "VP8L" for lossless and "VP8X" for extended files, whose VP8X header gives
+	// WebPFeatures.
+	WebPFormat   string       `json:"webp_format,omitempty"`
+	WebPFeatures WebPFeatures `json:"webp_features,omitempty"`
+	// Lossless reports whether a WebP image is coded losslessly: a VP8L file or a
+	// still VP8X file holding a VP8L image.
+	Lossless bool `json:"lossless,omitempty"`
+	// Items is the number of items the iinf box of an AVIF or HEIC file lists, found
+	// when the provided bytes hold its meta box. Items are the images, including
+	// thumbnails and the tiles of grid images, and metadata such as Exif, so more
+	// items than a still image needs point at bursts or live photos.
+	Items int `json:"items,omitempty"`
+	// MajorBrand and CompatibleBrands are the brands of the ftyp box of AVIF, HEIC,
+	// CR3 and JPEG XL container files, such as "avif" and "mif1".
+	MajorBrand       string `json:"major_brand,omitempty"`
+	CompatibleBrands Brands `json:"compatible_brands,omitempty"`
+}
+
+// WebPFeatures is the feature flags byte of the VP8X header of extended WebP files.
+type WebPFeatures uint8
+
+const (
+	// WebPAnimation flags animated files
+	WebPAnimation WebPFeatures = 0x02
+	// WebPXMP flags files with an XMP chunk
+	WebPXMP WebPFeatures = 0x04
+	// WebPEXIF flags files with an EXIF chunk
+	WebPEXIF WebPFeatures = 0x08
+	// WebPAlpha flags files with transparency
+	WebPAlpha WebPFeatures = 0x10
+	// WebPICC flags files with an ICC profile
+	WebPICC WebPFeatures = 0x20
+)
+
+// Brands is a list of ISO-BMFF brands, stored as their four-character codes one
+// after the other as in an ftyp box, which keeps ExtendedInfo comparable.
+type Brands string
+
+// List returns the brands in order.
+func (b Brands) List() []string {
+	list := make([]string, 0, len(b)/4)
+	for i := 0; i+4 <= len(b); i += 4 {
+		list = append(list, string(b[i:i+4]))
+	}
+	return list
+}
+
+// Contains reports whether brand, such as "avio", is in the list.
+func (b Brands) Contains(brand string) bool {
+	return slices.Contains(b.List(), brand)
+}
+
+// MarshalJSON encodes the brands as a JSON array of strings.
+func (b Brands) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.List())
+}
+
+// ftypBrands returns the major brand and the compatible brands of the ftyp box of
+// b, skipping the minor version between them.
+func ftypBrands(b []byte) (string, Brands) {
+	box, header := ftypBox(b)
+	if len(box) < header+8 {
+		return "", ""
+	}
+	compatible := box[header+8:]
+	return string(box[header : header+4]), Brands(compatible[:len(compatible)&^3])
+}
+
+// ExtendedOptions controls GetExtendedInfoWithOptions and
+// GetExtendedInfoReaderWithOptions.
+type ExtendedOptions struct {
+	// MaxBytes bounds the bytes walked for the frames of an animation, which
+	// may span the whole file. The reader variant reads up to MaxBytes of an
+	// animation for them. Zero or negative uses 1 MB.
+	MaxBytes int
+}
+
+// ColorModel represents the color model of an image, or `ColorUnknown`.
+type ColorModel uint8
+
+const (
+	// ColorUnknown represents an unknown or unreported color model
+	ColorUnknown ColorModel = iota
+	// ColorGray represents grayscale images
+	ColorGray
+	// ColorGrayAlpha represents grayscale images with an alpha channel
+	ColorGrayAlpha
+	// ColorRGB represents RGB images, including YCbCr-coded ones
+	ColorRGB
+	// ColorRGBA represents RGB images with an alpha channel
+	ColorRGBA
+	// ColorCMYK represents CMYK images
+	ColorCMYK
+	// ColorPalette represents images indexing a color palette
+	ColorPalette
+	// ColorLab represents CIE L*a*b* images
+	ColorLab
+)
+
+// String return a lower name of the color model
+func (m ColorModel) String() string {
+	switch m {
+	case ColorGray:
+		return "gray"
+	case ColorGrayAlpha:
+		return "gray_alpha"
+	case ColorRGB:
+		return "rgb"
+	case ColorRGBA:
+		return "rgba"
+	case ColorCMYK:
+		return "cmyk"
+	case ColorPalette:
+		return "palette"
+	case ColorLab:
+		return "lab"
+	}
+	return ""
+}
+
+// IsAnimated reports whether the image starting with p has more than one frame:
+// a GIF with a second image, a WebP with the animation flag,
+// an APNG or an AVIF image sequence. It is cheaper than GetExtendedInfo, reading
+// only the headers that say so, and like it needs more bytes for a GIF whose
+// second image is further into the file.
+func IsAnimated(p []byte) bool {
+	switch GetType(p) {
+	case GIF:
+		return gifAnimated(p)
+	case WEBP:
+		return len(p) >= 30 && p[15] == 'X' && p[20]&0x02 != 0
+	case APNG:
+		return true
+	case AVIF:
+		return avifAnimated(p)
+	}
+	return false
+}
+
+// avifAnimated reports whether an AVIF file holds an image sequence, by brand or
+// by its moov box. AVIF sequences are animations, unlike HEIC sequences, which
+// are often bursts.
+func avifAnimated(b []byte) bool {
+	return isHEIFSequence(b) || isoBox(b, "moov") != nil
+}
+
+// gifAnimated reports whether a GIF file has a second image. A NETSCAPE2.0 looping
+// extension alone does not make one animated, as encoders add it to still images too.
+func gifAnimated(b []byte) bool {
+	images, _ := gifScan(b, 2)
+	return images > 1
+}
+
+// gifScan walks the blocks of a GIF file up to its trailer, the end of b or its
+// limit-th image when limit is positive. It returns the number of images, the sum
+// of the delays of their graphic control extensions in hundredths of a second.
+func gifScan(b []byte, limit int) (images, delay int) {
+	if len(b) < 13 {
+		return 0, 0
+	}
+	i := 13
+	if b[10]&0x80 != 0 { // global color table
+		i += 3 << (b[10]&0x07 + 1)
+	}
+	for i < len(b) {
+		switch b[i] {
+		case 0x21: // extension
+			if i+6 <= len(b) && b[i+1] == 0xf9 && b[i+2] == 4 { // graphic control
+				delay += int(littleEndian.Uint16(b[i+4 : i+6]))
+			}
+			i += 2
+		case 0x2c: // image descriptor
+			if images++; images == limit {
+				return images, delay
+			}
+			if i+10 > len(b) {
+				return images, delay
+			}
+			if b[i+9]&0x80 != 0 { // local color table
+				i += 3 << (b[i+9]&0x07 + 1)
+			}
+			i += 11 // descriptor and LZW minimum code size
+		default: // trailer or corrupt data
+			return images, delay
+		}
+		// Skip the data sub-blocks up to the terminating empty one.
+		for i < len(b) && b[i] != 0 {
+			i += 1 + int(b[i])
+		}
+		i++
+	}
+	return images, delay
+}
+
+// extendedMinBytes is the number of bytes GetExtendedInfoReader reads at least, so
+// that metadata stored after the dimensions is seen too.
+const extendedMinBytes = 64 << 10
+
+// GetExtendedInfo detects image info and header metadata from the provided bytes,
+// using default options. See GetExtendedInfoWithOptions.
+func GetExtendedInfo(p []byte) ExtendedInfo {
+	return GetExtendedInfoWithOptions(p, ExtendedOptions{})
+}
+
+// GetExtendedInfoWithOptions detects image info and header metadata from the
+// provided bytes. Like GetInfo, it needs more bytes for metadata stored further
+// into the file.
+func GetExtendedInfoWithOptions(p []byte, options ExtendedOptions) (info ExtendedInfo) {
+	options = normalizeExtendedOptions(options)
+	info.Info = GetInfo(p)
+	switch info.Type {
+	case AVIF, HEIC, CR3, JXL:
+		info.MajorBrand, info.CompatibleBrands = ftypBrands(p)
+	}
+	switch info.Type {
+	case JPEG, MPO:
+		jpegExtended(p, &info)
+	case PNG, APNG:
+		pngExtended(p, &info)
+		info.Animated = info.Type == APNG
+	case GIF:
+		gifExtended(p[:min(len(p), options.MaxBytes)], &info)
+	case WEBP:
+		webpExtended(p[:min(len(p), options.MaxBytes)], &info)
+	case BMP:
+		bmpExtended(p, &info)
+	case PSD:
+		psdExtended(p, &info)
+	case AVIF, HEIC:
+		// The pixi property lists the bits of each channel, which are all equal
+		// in practice.
+		if pixi := heifPrimaryProperty(p, "pixi"); len(pixi) >= 6 {
+			info.BitDepth = int(pixi[5])
+		}
+		info.ICC = heifICC(p) != nil
+		if nclx := heifColr(p, "nclx"); len(nclx) >= 4 {
+			info.ColorPrimaries = int(bigEndian.Uint16(nclx[0:2]))
+			info.TransferCharacteristics = int(bigEndian.Uint16(nclx[2:4]))
+			info.HDR = info.TransferCharacteristics == 16 || info.TransferCharacteristics == 18
+		}
+		_, _, info.Items = heifItemInfo(p)
+		info.Sequence = isHEIFSequence(p)
+		info.Animated = info.Type == AVIF && avifAnimated(p)
+	case TIFF, CR2, NEF, ARW, DNG:
+		order := byteOrder(littleEndian)
+		if hasTIFFBig(p) {
+			order = bigEndian
+		}
+		tiffExtended(p, &info, order)
+		if info.Type == TIFF {
+			// The first IFD of RAW files describes a preview, not the sensor data.
+			tiffImageExtended(p, &info, order)
+		}
+	}
+	return
+}
+
+// GetExtendedInfoReader reads from r until it can determine the image info and has
+// read at least 64 KB, or until EOF, using default options. See
+// GetExtendedInfoReaderWithOptions.
+func GetExtendedInfoReader(r io.Reader) (ExtendedInfo, error) {
+	return GetExtendedInfoReaderWithOptions(r, ExtendedOptions{})
+}
+
+// GetExtendedInfoReaderWithOptions reads from r until it can determine the image
+// info and has read at least 64 KB, or until EOF. Animations are read on up to
+// MaxBytes, for their frames.
+func GetExtendedInfoReaderWithOptions(r io.Reader, options ExtendedOptions) (ExtendedInfo, error) {
+	options = normalizeExtendedOptions(options)
+	buf := make([]byte, 0, 4096)
+	tmp := make([]byte, 4096)
+
+	for {
+		n, err := r.Read(tmp)
+		if n > 0 {
+			buf = append(buf, tmp[:n]...)
+			if len(buf) >= extendedMinBytes {
+				info := GetInfo(buf)
+				if info.Type != Unknown && info.Width != 0 && info.Height != 0 &&
+					(len(buf) >= options.MaxBytes || !IsAnimated(buf)) {
+					return GetExtendedInfoWithOptions(buf, options), nil
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return GetExtendedInfoWithOptions(buf, options), nil
+			}
+			return ExtendedInfo{}, err
+		}
+	}
+}
+
+func normalizeExtendedOptions(options ExtendedOptions) ExtendedOptions {
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = 1 << 20
+	}
+	return options
+}
+
+func jpegExtended(b []byte, info *ExtendedInfo) {
+	i := 2
+	for i+3 < len(b) {
+		if b[i] != 0xff {
+			return
+		}
+		code := b[i+1]
+		length := int(b[i+3]) | int(b[i+2])<<8
+		if length < 2 {
+			return
+		}
+		seg := b[i+4 : min(i+2+length, len(b))]
+		switch {
+		case code == 0xe0 && len(seg) >= 12 && bytes.HasPrefix(seg, []byte("JFIF\x00")):
+			x := float64(bigEndian.Uint16(seg[8:10]))
+			y := float64(bigEndian.Uint16(seg[10:12]))
+			switch seg[7] {
+			case 1: // dots per inch
+				info.DPIX, info.DPIY = x, y
+			case 2: // dots per centimeter
+				info.DPIX, info.DPIY = x*2.54, y*2.54
+			}
+		case code == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")):
+			exif := seg[6:]
+			switch {
+			case hasTIFFBig(exif):
+				tiffExtended(exif, info, bigEndian)
+			case hasTIFFLittle(exif):
+				tiffExtended(exif, info, littleEndian)
+			}
+		case code == 0xe2 && bytes.HasPrefix(seg, []byte("MPF\x00")):
+			var n uint32
+			switch mpf := seg[4:]; {
+			case hasTIFFBig(mpf):
+				n, _ = tiffTag(mpf, bigEndian, 0xb001) // NumberOfImages
+			case hasTIFFLittle(mpf):
+				n, _ = tiffTag(mpf, littleEndian, 0xb001)
+			}
+			info.Pictures = int(n)
+		case code == 0xe2 && bytes.HasPrefix(seg, []byte("ICC_PROFILE\x00")):
+			info.ICC = true
+		case code == 0xdb:
+			if quality := jpegQuality(seg); quality > 0 {
+				info.Quality = quality
+			}
+		case isSOF(code):
+			if len(seg) > 0 {
+				info.BitDepth = int(seg[0])
+			}
+			if len(seg) > 5 {
+				info.Channels = int(seg[5])
+				switch info.Channels {
+				case 1:
+					info.ColorModel = ColorGray
+				case 3:
+					info.ColorModel = ColorRGB
+				case 4:
+					info.ColorModel = ColorCMYK
+				}
+			}
+			return
+		case code == 0xda:
+			return
+		}
+		i += 2 + length
+	}
+}
+
+// jpegLuminance is the luminance quantization table of the JPEG standard, in
+// zigzag order like DQT segments, which libjpeg scales by its quality factor.
+var jpegLuminance = [64]int{
+	16, 11, 12, 14, 12, 10, 16, 14,
+	13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37,
+	29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68,
+	87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113,
+	121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+// jpegQuality estimates the libjpeg quality of the table with id 0 of the DQT
+// segment seg, or returns 0 when the segment does not hold it. libjpeg scales the
+// standard table by 5000/quality percent below 50 and by 200-2*quality above, and
+// clamps the entries of 8-bit tables to 255.
+func jpegQuality(seg []byte) int {
+	for i := 0; i < len(seg); {
+		precision, id := seg[i]>>4, seg[i]&0x0f
+		size := 64
+		if precision != 0 {
+			size = 128
+		}
+		if i+1+size > len(seg) {
+			return 0
+		}
+		if id != 0 {
+			i += 1 + size
+			continue
+		}
+		// Entries libjpeg clamped to 255 tell nothing of the scale.
+		sum, standard, ones := 0, 0, true
+		for k := range 64 {
+			q := int(seg[i+1+k])
+			if precision != 0 {
+				q = int(bigEndian.Uint16(seg[i+1+2*k:]))
+			}
+			ones = ones && q == 1
+			if q < 255 {
+				sum += q
+				standard += jpegLuminance[k]
+			}
+		}
+		switch {
+		case ones:
+			return 100
+		case standard == 0:
+			return 1
+		}
+		scale := float64(sum) * 100 / float64(standard)
+		quality := 5000 / scale
+		if scale <= 100 {
+			quality = (200 - scale) / 2
+		}
+		return max(1, min(100, int(quality+0.5)))
+	}
+	return 0
+}
+
+func pngExtended(b []byte, info *ExtendedInfo) {
+	if len(b) < 26 {
+		return
+	}
+	info.BitDepth = int(b[24])
+	switch b[25] {
+	case 0:
+		info.Channels, info.ColorModel = 1, ColorGray
+	case 2:
+		info.Channels, info.ColorModel = 3, ColorRGB
+	case 3:
+		info.Channels, info.ColorModel = 1, ColorPalette
+	case 4:
+		info.Channels, info.ColorModel = 2, ColorGrayAlpha
+	case 6:
+		info.Channels, info.ColorModel = 4, ColorRGBA
+	}
+	info.Alpha = info.ColorModel == ColorGrayAlpha || info.ColorModel == ColorRGBA
+	for i := 8; i+8 <= len(b); {
+		length := int(bigEndian.Uint32(b[i : i+4]))
+		typ := string(b[i+4 : i+8])
+		if typ == "IDAT" {
+			return
+		}
+		switch {
+		case typ == "tRNS":
+			info.Alpha = true
+		case typ == "iCCP":
+			info.ICC = true
+		case typ == "pHYs" && i+17 <= len(b) && b[i+16] == 1: // pixels per meter
+			info.DPIX = float64(bigEndian.Uint32(b[i+8:i+12])) * 0.0254
+			info.DPIY = float64(bigEndian.Uint32(b[i+12:i+16])) * 0.0254
+		case typ == "acTL" && i+16 <= len(b):
+			info.Frames = int(bigEndian.Uint32(b[i+8 : i+12]))
+			info.Loops = int(bigEndian.Uint32(b[i+12 : i+16]))
+		}
+		i += 12 + length
+	}
+}
+
+func gifExtended(b []byte, info *ExtendedInfo) {
+	images, delay := gifScan(b, 0)
+	info.Animated = images > 1
+	if info.Animated {
+		info.Frames = images
+		info.Duration = time.Duration(delay) * 10 * time.Millisecond
+	}
+}
+
+func webpExtended(b []byte, info *ExtendedInfo) {
+	if len(b) < 30 {
+		return
+	}
+	info.WebPFormat = string(bytes.TrimRight(b[12:16], " "))
+	switch b[15] {
+	case 'L': // VP8L
+		info.Alpha = b[24]&0x10 != 0
+		info.Lossless = true
+	case 'X': // VP8X
+		info.WebPFeatures = WebPFeatures(b[20])
+		info.ICC = info.WebPFeatures&WebPICC != 0
+		info.Alpha = info.WebPFeatures&WebPAlpha != 0
+		info.Animated = info.WebPFeatures&WebPAnimation != 0
+		info.Lossless = !info.Animated && webpChunk(b, "VP8L") != nil
+	}
+	if !info.Animated {
+		return
+	}
+	for i := 12; i+8 <= len(b); {
+		size := int(littleEndian.Uint32(b[i+4 : i+8]))
+		switch string(b[i : i+4]) {
+		case "ANIM":
+			if i+14 <= len(b) {
+				info.Loops = int(littleEndian.Uint16(b[i+12 : i+14]))
+			}
+		case "ANMF":
+			info.Frames++
+			if i+23 <= len(b) {
+				ms := uint32(b[i+20]) | uint32(b[i+21])<<8 | uint32(b[i+22])<<16
+				info.Duration += time.Duration(ms) * time.Millisecond
+			}
+		}
+		if size < 0 || size > len(b) {
+			return
+		}
+		i += 8 + size + size&1
+	}
+}
+
+// bmpExtended reads the bits per pixel of the BMP info header, which are per
+// channel for 24- and 32-bit images, and its resolution.
+func bmpExtended(b []byte, info *ExtendedInfo) {
+	if len(b) < 30 {
+		return
+	}
+	bits := int(littleEndian.Uint16(b[28:30]))
+	if littleEndian.Uint32(b[14:18]) == 12 { // OS/2 BITMAPCOREHEADER
+		bits = int(littleEndian.Uint16(b[24:26]))
+	} else if len(b) >= 46 {
+		// Pixels per meter, signed but never meaningfully negative.
+		x, y := int32(littleEndian.Uint32(b[38:42])), int32(littleEndian.Uint32(b[42:46]))
+		if x > 0 && y > 0 {
+			info.DPIX, info.DPIY = float64(x)*0.0254, float64(y)*0.0254
+		}
+	}
+	switch bits {
+	case 16:
+		info.BitDepth = 5
+	case 24, 32:
+		info.BitDepth = 8
+	default:
+		info.BitDepth = bits
+	}
+}
+
+// psdExtended reads the channels, depth and color mode of the PSD file header.
+// psdExtended reads the header of a PSD or PSB file, whose color mode is 0 for
+// bitmap images, which are reported as 1-bit gray, and the layer count that follows
+// the color mode data and the image resources.
+func psdExtended(b []byte, info *ExtendedInfo) {
+	if len(b) < 26 {
+		return
+	}
+	info.Channels = int(bigEndian.Uint16(b[12:14]))
+	info.BitDepth = int(bigEndian.Uint16(b[22:24]))
+	switch bigEndian.Uint16(b[24:26]) {
+	case 0, 1, 8: // bitmap, grayscale and duotone
+		info.ColorModel = ColorGray
+		if info.Channels > 1 {
+			info.ColorModel = ColorGrayAlpha
+		}
+	case 2: // indexed
+		info.ColorModel = ColorPalette
+	case 3:
+		info.ColorModel = ColorRGB
+		if info.Channels > 3 {
+			info.ColorModel = ColorRGBA
+		}
+	case 4:
+		info.ColorModel = ColorCMYK
+	case 9:
+		info.ColorModel = ColorLab
+	}
+	info.Layers = psdLayers(b)
+}
+
+// psdLayers returns the layer count of the layer info section of a PSD file, or 0
+// when b does not reach it. PSB files, version 2, give the section lengths in 8
+// bytes. A negative count means the first alpha channel holds the transparency of
+// the merged image.
+func psdLayers(b []byte) int {
+	i := int64(26)
+	for range 2 { // the color mode data and the image resources
+		if i+4 > int64(len(b)) {
+			return 0
+		}
+		i += 4 + int64(bigEndian.Uint32(b[i:i+4]))
+	}
+	lengthSize := int64(4)
+	if bigEndian.Uint16(b[4:6]) == 2 {
+		lengthSize = 8
+	}
+	// The layer and mask information length, then the layer info length.
+	i += lengthSize
+	if i+lengthSize+2 > int64(len(b)) || bytes.Equal(b[i:i+lengthSize], make([]byte, lengthSize)) {
+		return 0
+	}
+	count := int(int16(bigEndian.Uint16(b[i+lengthSize : i+lengthSize+2])))
+	return max(count, -count)
+}
+
+// tiffImageExtended reads the sample layout of the first IFD of the TIFF data b.
+func tiffImageExtended(b []byte, info *ExtendedInfo, order byteOrder) {
+	info.BitDepth = tiffBitDepth(b, order)
+	info.Channels = 1
+	if n, ok := tiffTag(b, order, 277); ok { // SamplesPerPixel
+		info.Channels = int(n)
+	}
+	photometric, ok := tiffTag(b, order, 262)
+	if !ok {
+		return
+	}
+	switch photometric {
+	case 0, 1: // WhiteIsZero and BlackIsZero
+		info.ColorModel = ColorGray
+		if info.Channels > 1 {
+			info.ColorModel = ColorGrayAlpha
+		}
+	case 2, 6: // RGB and YCbCr
+		info.ColorModel = ColorRGB
+		if info.Channels > 3 {
+			info.ColorModel = ColorRGBA
+		}
+	case 3:
+		info.ColorModel = ColorPalette
+	case 5: // separated, CMYK unless InkSet says otherwise
+		info.ColorModel = ColorCMYK
+	}
+}
+
+func tiffExtended(b []byte, info *ExtendedInfo, order byteOrder) {
+	if v, ok := tiffTag(b, order, 274); ok && v >= 1 && v <= 8 {
+		info.Orientation = int(v)
+	}
+	if len(b) < 8 {
+		return
+	}
+	ifd0 := int(order.Uint32(b[4:8]))
+	if tiffHasTag(b, order, ifd0, 34675) { // ICCProfile
+		info.ICC = true
+	}
+	if info.DPIX == 0 && info.DPIY == 0 { // JFIF density comes first in JPEG files
+		x, y := tiffRational(b, order, ifd0, 282), tiffRational(b, order, ifd0, 283)
+		unit, ok := tiffTag(b, order, 296)
+		switch {
+		case !ok || unit == 2: // inches, the default
+			info.DPIX, info.DPIY = x, y
+		case unit == 3: // centimeters
+			info.DPIX, info.DPIY = x*2.54, y*2.54
+		}
+	}
+}
+
+// tiffRational returns the value of a RATIONAL tag in the IFD at offset i of the
+// TIFF data b, or 0.
+func tiffRational(b []byte, order byteOrder, i int, tag uint16) float64 {
+	typ, value, ok := tiffEntry(b, order, i, tag)
+	if !ok || typ != 5 || len(value) < 8 {
+		return 0
+	}
+	den := order.Uint32(value[4:8])
+	if den == 0 {
+		return 0
+	}
+	return float64(order.Uint32(value[0:4])) / float64(den)
+}
+
+// tiffHasTag reports whether the IFD at offset i of the TIFF data b lists tag,
+// whether or not its value lies within b.
+func tiffHasTag(b []byte, order byteOrder, i int, tag uint16) bool {
+	if i < 8 || i+2 > len(b) {
+		return false
+	}
+	n := int(order.Uint16(b[i : i+2]))
+	for i += 2; n > 0 && i+12 <= len(b); i, n = i+12, n-1 {
+		if order.Uint16(b[i:i+2]) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// heifICC returns the ICC profile of the first colr property of a HEIF file that
+// holds one rather than only nclx color parameters, or nil.
+func heifICC(b []byte) []byte {
+	if prof := heifColr(b, "prof"); prof != nil {
+		return prof
+	}
+	return heifColr(b, "rICC")
+}
+
+// heifColr returns the payload after the color type of the first colr property of
+// a HEIF file with the given type, or nil.
+func heifColr(b []byte, colorType string) []byte {
+	meta := isoBox(b, "meta")
+	if len(meta) < 4 {
+		return nil
+	}
+	ipco := isoBox(isoBox(meta[4:], "iprp"), "ipco")
+	for i := 1; ; i++ {
+		prop, name := isoChild(ipco, i)
+		if prop == nil {
+			return nil
+		}
+		if name == "colr" && len(prop) >= 4 && string(prop[:4]) == colorType {
+			return prop[4:]
+		}
+	}
+}
+
+// tiffBitDepth returns the first BitsPerSample value of the first IFD of the TIFF
+// data b, which defaults to 1 when the tag is absent.
+func tiffBitDepth(b []byte, order byteOrder) int {
+	if len(b) < 8 {
+		return 0
+	}
+	typ, value, ok := tiffEntry(b, order, int(order.Uint32(b[4:8])), 258)
+	switch {
+	case !ok:
+		return 1
+	case typ == 3 && len(value) >= 2:
+		return int(order.Uint16(value))
+	}
+	return 0
+}
+
+// tiffTag returns the value of an integer tag in the first IFD of the TIFF data b.
+func tiffTag(b []byte, order byteOrder, tag uint16) (uint32, bool) {
+	if len(b) < 8 {
+		return 0, false
+	}
+	return tiffIFDTag(b, order, int(order.Uint32(b[4:8])), tag)
+}
+
+// tiffIFDTag returns the value of an integer tag in the IFD at offset i of the TIFF
+// data b.
+func tiffIFDTag(b []byte, order byteOrder, i int, tag uint16) (uint32, bool) {
+	if i < 8 || i+2 > len(b) {
+		return 0, false
+	}
+	n := int(order.Uint16(b[i : i+2]))
+	i += 2
+
+	for ; n > 0 && i+12 <= len(b); i, n = i+12, n-1 {
+		if order.Uint16(b[i:i+2]) != tag {
+			continue
+		}
+		switch order.Uint16(b[i+2 : i+4]) {
+		case 1, 6:
+			return uint32(b[i+8]), true
+		case 3, 8:
+			return uint32(order.Uint16(b[i+8 : i+10])), true
+		case 4, 9:
+			return order.Uint32(b[i+8 : i+12]), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// tiffNextIFD returns the offset of the IFD following the one at offset i of the
+// TIFF data b, or 0 when there is none or it lies beyond b.
+func tiffNextIFD(b []byte, order byteOrder, i int) int {
+	if i < 8 || i+2 > len(b) {
+		return 0
+	}
+	end := i + 2 + 12*int(order.Uint16(b[i:i+2]))
+	if end+4 > len(b) {
+		return 0
+	}
+	return int(order.Uint32(b[end : end+4]))
+}
@@ -0,0 +1,339 @@
+package fastimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	stdjpeg "image/jpeg"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetExtendedInfo(t *testing.T) {
+	cases := []struct {
+		File string
+		Info ExtendedInfo
+	}{
+		{"testdata/letter_T.jpg", ExtendedInfo{Info: Info{JPEG, 52, 54}, BitDepth: 8, Channels: 3, ColorModel: ColorRGB, Quality: 75}},
+		{"testdata/letter_T_exif.jpg", ExtendedInfo{Info: Info{JPEG, 52, 54}, Orientation: 6, DPIX: 72, DPIY: 72, BitDepth: 8, Channels: 3, ColorModel: ColorRGB, Quality: 75}},
+		{"testdata/stereo.mpo", ExtendedInfo{Info: Info{MPO, 64, 48}, BitDepth: 8, Pictures: 2, Channels: 3, ColorModel: ColorRGB, Quality: 60}},
+		{"testdata/pass-1_s.png", ExtendedInfo{Info: Info{PNG, 90, 60}, BitDepth: 8, Channels: 1, ColorModel: ColorPalette}},
+		{"testdata/cow.avif", ExtendedInfo{Info: Info{AVIF, 500, 300}, BitDepth: 8, ColorPrimaries: 2, TransferCharacteristics: 2, Items: 1, MajorBrand: "avif", CompatibleBrands: "avifmif1miafMA1B"}},
+		{"testdata/spinner.avif", ExtendedInfo{Info: Info{AVIF, 480, 270}, Animated: true, Sequence: true, MajorBrand: "avis", CompatibleBrands: "avifavismsf1iso8mif1miaf"}},
+		{"testdata/grid.heic", ExtendedInfo{Info: Info{HEIC, 1024, 768}, Items: 5, MajorBrand: "heic", CompatibleBrands: "mif1heic"}},
+		{"testdata/burst.heics", ExtendedInfo{Info: Info{HEIC, 640, 480}, Sequence: true, MajorBrand: "msf1", CompatibleBrands: "msf1hevciso8"}},
+		{"testdata/blink.png", ExtendedInfo{Info: Info{APNG, 24, 16}, BitDepth: 8, Alpha: true, Animated: true, Channels: 4, ColorModel: ColorRGBA, Frames: 2}},
+		{"testdata/test.gif", ExtendedInfo{Info: Info{GIF, 60, 40}}},
+		{"testdata/animated.gif", ExtendedInfo{Info: Info{GIF, 16, 12}, Animated: true, Frames: 2, Duration: 200 * time.Millisecond}},
+		{"testdata/4.sm.webp", ExtendedInfo{Info: Info{WEBP, 320, 241}, WebPFormat: "VP8"}},
+		{"testdata/spin.webp", ExtendedInfo{Info: Info{WEBP, 100, 80}, Alpha: true, Animated: true, Frames: 3, Loops: 3, Duration: 300 * time.Millisecond, WebPFormat: "VP8X", WebPFeatures: WebPAnimation | WebPAlpha}},
+		{"testdata/2_webp_a.webp", ExtendedInfo{Info: Info{WEBP, 386, 395}, Alpha: true, WebPFormat: "VP8X", WebPFeatures: WebPAlpha}},
+		{"testdata/2_webp_ll.webp", ExtendedInfo{Info: Info{WEBP, 386, 395}, Alpha: true, WebPFormat: "VP8L", Lossless: true}},
+		{"testdata/bexjdic.tif", ExtendedInfo{Info: Info{TIFF, 35, 32}, Orientation: 1, DPIX: 1200, DPIY: 1200, BitDepth: 8, Channels: 1, ColorModel: ColorPalette}},
+		{"testdata/lexjdic.tif", ExtendedInfo{Info: Info{TIFF, 35, 32}, Orientation: 1, DPIX: 1200, DPIY: 1200, BitDepth: 8, Channels: 1, ColorModel: ColorPalette}},
+		{"testdata/deep16.tiff", ExtendedInfo{Info: Info{TIFF, 4, 3}, BitDepth: 16, Channels: 3, ColorModel: ColorRGB, ICC: true}},
+		{"testdata/xterm.bmp", ExtendedInfo{Info: Info{BMP, 64, 38}, DPIX: 2925 * 0.0254, DPIY: 2925 * 0.0254, BitDepth: 4}},
+		{"testdata/468x60.psd", ExtendedInfo{Info: Info{PSD, 468, 60}, BitDepth: 8, Channels: 4, ColorModel: ColorRGBA}},
+		{"testdata/letter_T.psd", ExtendedInfo{Info: Info{PSD, 52, 54}, BitDepth: 8, Channels: 3, ColorModel: ColorRGB, Layers: 1}},
+	}
+
+	for _, c := range cases {
+		data, err := os.ReadFile(c.File)
+		if err != nil {
+			t.Errorf("read file(%+v) error: %+v", c.File, err)
+			continue
+		}
+
+		if got, want := GetExtendedInfo(data), c.Info; got != want {
+			t.Errorf("get extended info error, file=%+v, got=%+v, want=%+v,", c.File, got, want)
+		}
+
+		file, err := os.Open(c.File)
+		if err != nil {
+			t.Errorf("open file(%+v) error: %+v", c.File, err)
+			continue
+		}
+		info, err := GetExtendedInfoReader(file)
+		file.Close()
+		if err != nil {
+			t.Errorf("read file(%+v) error: %+v", c.File, err)
+			continue
+		}
+		if got, want := info, c.Info; got != want {
+			t.Errorf("get extended info reader error, file=%+v, got=%+v, want=%+v,", c.File, got, want)
+		}
+	}
+}
+
+func TestColorModelString(t *testing.T) {
+	for m := ColorGray; m <= ColorLab; m++ {
+		if m.String() == "" {
+			t.Errorf("color model %d has no name", m)
+		}
+	}
+	if got := ColorUnknown.String(); got != "" {
+		t.Errorf("ColorUnknown.String() = %q, want empty", got)
+	}
+}
+
+func TestIsAnimated(t *testing.T) {
+	for _, c := range []struct {
+		File     string
+		Animated bool
+	}{
+		{"testdata/animated.gif", true},
+		{"testdata/test.gif", false},
+		{"testdata/blink.png", true},
+		{"testdata/pass-1_s.png", false},
+		{"testdata/spinner.avif", true},
+		{"testdata/cow.avif", false},
+		{"testdata/2_webp_a.webp", false},
+		{"testdata/spin.webp", true},
+		{"testdata/letter_T.jpg", false},
+	} {
+		data, err := os.ReadFile(c.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := IsAnimated(data); got != c.Animated {
+			t.Errorf("IsAnimated(%s) = %v, want %v", c.File, got, c.Animated)
+		}
+	}
+
+	// GIFs with a global color table and no looping extension, so they play once.
+	header := "GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff"
+	frame := "\x2c\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02\x44\x01\x00"
+	pad := strings.Repeat("\x00", 80)
+	if !IsAnimated([]byte(header + frame + frame + "\x3b" + pad)) {
+		t.Errorf("IsAnimated(two-image GIF) = false, want true")
+	}
+	if IsAnimated([]byte(header + frame + "\x3b" + pad)) {
+		t.Errorf("IsAnimated(one-image GIF) = true, want false")
+	}
+
+	// A looping extension on a single image does not make it animated.
+	looping := "\x21\xff\x0bNETSCAPE2.0\x03\x01\x00\x00\x00"
+	still := []byte(header + looping + frame + "\x3b" + pad)
+	if IsAnimated(still) {
+		t.Errorf("IsAnimated(looping one-image GIF) = true, want false")
+	}
+	if info := GetExtendedInfo(still); info.Animated || info.Frames != 0 {
+		t.Errorf("GetExtendedInfo(looping one-image GIF) = %+v, want still", info)
+	}
+	if info := GetExtendedInfo([]byte(header + looping + frame + frame + "\x3b" + pad)); !info.Animated || info.Frames != 2 {
+		t.Errorf("GetExtendedInfo(looping two-image GIF) = %+v, want 2 frames", info)
+	}
+}
+
+func TestGetExtendedInfoMaxBytes(t *testing.T) {
+	data, err := os.ReadFile("testdata/spin.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The budget ends within the second frame.
+	info := GetExtendedInfoWithOptions(data, ExtendedOptions{MaxBytes: 100})
+	if info.Frames != 2 || info.Loops != 3 {
+		t.Errorf("frames = %d, loops = %d, want 2 and 3", info.Frames, info.Loops)
+	}
+
+	info, err = GetExtendedInfoReaderWithOptions(bytes.NewReader(data), ExtendedOptions{MaxBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Frames != 2 {
+		t.Errorf("reader frames = %d, want 2", info.Frames)
+	}
+}
+
+func TestAPNGPlays(t *testing.T) {
+	data, err := os.ReadFile("testdata/blink.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte("acTL"))
+	if i < 0 {
+		t.Fatal("no acTL chunk")
+	}
+	// The CRC is not checked, so num_plays can be patched in place.
+	data[i+11] = 3
+	if info := GetExtendedInfo(data); info.Frames != 2 || info.Loops != 3 {
+		t.Errorf("frames = %d, loops = %d, want 2 and 3", info.Frames, info.Loops)
+	}
+}
+
+func TestICC(t *testing.T) {
+	read := func(name string) []byte {
+		data, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	insert := func(b []byte, at int, s string) []byte {
+		return append(append(append([]byte{}, b[:at]...), s...), b[at:]...)
+	}
+	jpeg := read("letter_T.jpg")
+	png := read("pass-1_s.png")
+	webp := read("spin.webp")
+	taggedWebP := append([]byte{}, webp...)
+	taggedWebP[20] |= 0x20
+
+	for _, c := range []struct {
+		Name string
+		Data []byte
+		ICC  bool
+	}{
+		{"jpeg", jpeg, false},
+		{"jpeg with APP2", insert(jpeg, 2, "\xff\xe2\x00\x10ICC_PROFILE\x00\x01\x01"), true},
+		{"png", png, false},
+		{"png with iCCP", insert(png, 33, "\x00\x00\x00\x00iCCP\x00\x00\x00\x00"), true},
+		{"webp", webp, false},
+		{"webp with VP8X flag", taggedWebP, true},
+	} {
+		if got := GetExtendedInfo(c.Data).ICC; got != c.ICC {
+			t.Errorf("%s: ICC = %v, want %v", c.Name, got, c.ICC)
+		}
+	}
+
+	box := func(name, payload string) string {
+		n := len(payload) + 8
+		return string([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}) + name + payload
+	}
+	for _, c := range []struct {
+		Colr string
+		ICC  bool
+	}{
+		{"nclx\x00\x01\x00\x0d\x00\x06\x80", false},
+		{"prof\x00\x00\x02\x00", true},
+	} {
+		meta := box("meta", "\x00\x00\x00\x00"+box("iprp", box("ipco", box("colr", c.Colr))))
+		if got := heifICC([]byte(meta)) != nil; got != c.ICC {
+			t.Errorf("heifICC(colr %s) = %v, want %v", c.Colr[:4], got, c.ICC)
+		}
+	}
+}
+
+func TestPNGPhysicalDensity(t *testing.T) {
+	data, err := os.ReadFile("testdata/pass-1_s.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 11811 pixels per meter is 300 DPI; the CRC is not checked.
+	phys := "\x00\x00\x00\x09pHYs\x00\x00\x2e\x23\x00\x00\x2e\x23\x01\x00\x00\x00\x00"
+	data = append(append(append([]byte{}, data[:33]...), phys...), data[33:]...)
+	info := GetExtendedInfo(data)
+	if want := 11811 * 0.0254; info.DPIX != want || info.DPIY != want {
+		t.Errorf("DPI = %gx%g, want %g", info.DPIX, info.DPIY, want)
+	}
+}
+
+func TestHDR(t *testing.T) {
+	data, err := os.ReadFile("testdata/cow.avif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Patch the image into 10-bit BT.2020 with the PQ transfer function.
+	nclx := bytes.Index(data, []byte("colrnclx"))
+	pixi := bytes.Index(data, []byte("pixi"))
+	if nclx < 0 || pixi < 0 {
+		t.Fatal("no nclx colr or pixi box")
+	}
+	copy(data[nclx+8:], []byte{0, 9, 0, 16})
+	copy(data[pixi+9:], []byte{10, 10, 10})
+
+	info := GetExtendedInfo(data)
+	if info.BitDepth != 10 || info.ColorPrimaries != 9 || info.TransferCharacteristics != 16 || !info.HDR {
+		t.Errorf("got depth %d, primaries %d, transfer %d, HDR %v, want 10, 9, 16 and HDR",
+			info.BitDepth, info.ColorPrimaries, info.TransferCharacteristics, info.HDR)
+	}
+}
+
+func TestJPEGQuality(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for quality := 1; quality <= 100; quality++ {
+		var buf bytes.Buffer
+		if err := stdjpeg.Encode(&buf, img, &stdjpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+		if got := GetExtendedInfo(buf.Bytes()).Quality; got != quality {
+			t.Errorf("quality %d: estimated %d", quality, got)
+		}
+	}
+}
+
+func TestPSDLab(t *testing.T) {
+	data, err := os.ReadFile("testdata/letter_T.psd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[25] = 9 // Lab color mode
+	info := GetExtendedInfo(data)
+	if info.ColorModel != ColorLab || info.Layers != 1 {
+		t.Errorf("got color model %v and %d layers, want lab and 1", info.ColorModel, info.Layers)
+	}
+	for n := range 200 {
+		GetExtendedInfo(data[:n])
+	}
+}
+
+func TestWebPLossless(t *testing.T) {
+	data, err := os.ReadFile("testdata/2_webp_ll.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wrap the VP8L chunk in an extended file with an ICC profile flag; the
+	// canvas size is stored minus one in 24 bits.
+	vp8x := []byte("VP8X\x0a\x00\x00\x00\x20\x00\x00\x00\x81\x01\x00\x8a\x01\x00")
+	body := append(append([]byte("WEBP"), vp8x...), data[12:]...)
+	extended := append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+
+	info := GetExtendedInfo(extended)
+	if info.Info != (Info{WEBP, 386, 395}) || info.WebPFormat != "VP8X" || info.WebPFeatures != WebPICC || !info.Lossless {
+		t.Errorf("got %+v, want a lossless 386x395 VP8X file with the ICC flag", info)
+	}
+}
+
+func TestBrands(t *testing.T) {
+	data, err := os.ReadFile("testdata/camera.cr3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := GetExtendedInfo(data)
+	if info.MajorBrand != "crx " || !slices.Equal(info.CompatibleBrands.List(), []string{"crx ", "isom"}) {
+		t.Errorf("got major brand %q and compatible brands %q", info.MajorBrand, info.CompatibleBrands.List())
+	}
+
+	brands := Brands("avifmif1miaf")
+	if !brands.Contains("mif1") || brands.Contains("avio") || brands.Contains("avif"[1:]) {
+		t.Errorf("Contains on %q gave wrong answers", brands)
+	}
+	if got, err := json.Marshal(brands); err != nil || string(got) != `["avif","mif1","miaf"]` {
+		t.Errorf("json.Marshal(%q) = %s, %v", brands, got, err)
+	}
+	if got, err := json.Marshal(ExtendedInfo{}); err != nil || strings.Contains(string(got), "brands") {
+		t.Errorf("json.Marshal(ExtendedInfo{}) = %s, %v", got, err)
+	}
+}
+
+func TestHEIFItems(t *testing.T) {
+	data, err := os.ReadFile("testdata/grid.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The grid image, its four tiles and nothing else, once the meta box is read.
+	meta := bytes.Index(data, []byte("meta"))
+	if meta < 4 {
+		t.Fatal("no meta box")
+	}
+	end := meta - 4 + int(binary.BigEndian.Uint32(data[meta-4:meta]))
+	if got := GetExtendedInfo(data[:end]).Items; got != 5 {
+		t.Errorf("items = %d, want 5", got)
+	}
+	if got := GetExtendedInfo(data[:end-1]).Items; got != 0 {
+		t.Errorf("items of a truncated meta box = %d, want 0", got)
+	}
+}
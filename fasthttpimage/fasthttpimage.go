@@ -0,0 +1,63 @@
+// Package fasthttpimage detects images in fasthttp request and response bodies
+// without copying them into net/http types.
+//
+// It is a separate module so that the fastimage package itself stays free of
+// dependencies.
+package fasthttpimage
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/kotylevskiy/fastimage"
+	"github.com/valyala/fasthttp"
+)
+
+// maxStreamBytes bounds the part of a body stream read by BodyStreamInfo.
+const maxStreamBytes = 256 << 10
+
+// RequestInfo detects the image in the body of req. The body is read in place,
+// without copying. Requests whose body is streamed, with Server.StreamRequestBody
+// set, should use BodyStreamInfo(req.BodyStream()) instead, since reading their
+// body here would load all of it.
+func RequestInfo(req *fasthttp.Request) fastimage.Info {
+	return fastimage.GetInfo(req.Body())
+}
+
+// ResponseInfo detects the image in the body of resp, read in place without
+// copying. Bodies with a Content-Encoding are detected as they are sent, so a
+// compressed image body is not recognized.
+func ResponseInfo(resp *fasthttp.Response) fastimage.Info {
+	return fastimage.GetInfo(resp.Body())
+}
+
+// CtxInfo detects the image in the request body of ctx. See RequestInfo.
+func CtxInfo(ctx *fasthttp.RequestCtx) fastimage.Info {
+	return RequestInfo(&ctx.Request)
+}
+
+// BodyStreamInfo reads the head of stream until it can determine the image info,
+// EOF, or 256 KB, and returns the info along with a reader that yields the whole
+// body: the bytes read so far followed by the rest of stream. Callers keep
+// consuming the body from the returned reader.
+func BodyStreamInfo(stream io.Reader) (fastimage.Info, io.Reader, error) {
+	var buf []byte
+	tmp := make([]byte, 4096)
+	for len(buf) < maxStreamBytes {
+		n, err := stream.Read(tmp)
+		buf = append(buf, tmp[:n]...)
+		if n > 0 {
+			info := fastimage.GetInfo(buf)
+			if info.Type != fastimage.Unknown && info.Width != 0 && info.Height != 0 {
+				return info, io.MultiReader(bytes.NewReader(buf), stream), nil
+			}
+		}
+		if err == io.EOF {
+			return fastimage.GetInfo(buf), bytes.NewReader(buf), nil
+		}
+		if err != nil {
+			return fastimage.Info{}, io.MultiReader(bytes.NewReader(buf), stream), err
+		}
+	}
+	return fastimage.GetInfo(buf), io.MultiReader(bytes.NewReader(buf), stream), nil
+}
@@ -0,0 +1,50 @@
+package fasthttpimage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/kotylevskiy/fastimage"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRequestAndResponseInfo(t *testing.T) {
+	data, err := os.ReadFile("../testdata/letter_T.jpg")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	want := fastimage.Info{Type: fastimage.JPEG, Width: 52, Height: 54}
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetBody(data)
+	if got := CtxInfo(&ctx); got != want {
+		t.Errorf("request info: got %+v want %+v", got, want)
+	}
+
+	var resp fasthttp.Response
+	resp.SetBody(data)
+	if got := ResponseInfo(&resp); got != want {
+		t.Errorf("response info: got %+v want %+v", got, want)
+	}
+}
+
+func TestBodyStreamInfo(t *testing.T) {
+	data, err := os.ReadFile("../testdata/pak38.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	info, body, err := BodyStreamInfo(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("body stream info: %v", err)
+	}
+	if want := (fastimage.Info{Type: fastimage.GIF, Width: 333, Height: 194}); info != want {
+		t.Errorf("got %+v want %+v", info, want)
+	}
+	rest, err := io.ReadAll(body)
+	if err != nil || !bytes.Equal(rest, data) {
+		t.Fatalf("body was not replayed intact: %d bytes, err=%v", len(rest), err)
+	}
+}
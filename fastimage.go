@@ -1,5 +1,10 @@
 package fastimage
 
+import (
+	"bytes"
+	"strconv"
+)
+
 // Type represents the type of the image detected, or `Unknown`.
 type Type uint64
 
@@ -44,6 +49,60 @@ const (
 	XV
 	// AVIF represendts a AVIF image
 	AVIF
+	// HEIC represents a HEIC or other HEIF image
+	HEIC
+	// JXL represents a JPEG XL image
+	JXL
+	// ICO represents a Windows icon
+	ICO
+	// CUR represents a Windows cursor
+	CUR
+	// TGA represents a Truevision TGA (Targa) image
+	TGA
+	// APNG represents an animated PNG image
+	APNG
+	// BPG represents a BPG (Better Portable Graphics) image
+	BPG
+	// PAM represents a Netpbm PAM image
+	PAM
+	// SVG represents an SVG image
+	SVG
+	// SVGZ represents a gzip-compressed SVG image
+	SVGZ
+	// PVR represents a PowerVR texture
+	PVR
+	// CR2 represents a Canon RAW image
+	CR2
+	// NEF represents a Nikon RAW image
+	NEF
+	// ARW represents a Sony RAW image
+	ARW
+	// DNG represents an Adobe Digital Negative RAW image
+	DNG
+	// ANI represents a Windows animated cursor
+	ANI
+	// PICT represents an Apple QuickDraw picture
+	PICT
+	// DPX represents an SMPTE DPX image
+	DPX
+	// CIN represents a Kodak Cineon image
+	CIN
+	// IVF represents video frames, such as AV1 stills, in an IVF container
+	IVF
+	// FITS represents a FITS image
+	FITS
+	// ILBM represents an IFF ILBM or PBM image
+	ILBM
+	// PCD represents a Kodak Photo CD image or overview file
+	PCD
+	// TIM represents a PlayStation TIM image
+	TIM
+	// EPS represents an Encapsulated PostScript file
+	EPS
+	// CR3 represents a Canon RAW image in an ISO-BMFF container
+	CR3
+	// MPO represents a Multi-Picture Object file, such as a stereo photo
+	MPO
 )
 
 // String return a lower name of image type
@@ -87,6 +146,60 @@ func (t Type) String() string {
 		return "xv"
 	case AVIF:
 		return "avif"
+	case HEIC:
+		return "heic"
+	case JXL:
+		return "jxl"
+	case ICO:
+		return "ico"
+	case CUR:
+		return "cur"
+	case TGA:
+		return "tga"
+	case APNG:
+		return "apng"
+	case BPG:
+		return "bpg"
+	case PAM:
+		return "pam"
+	case SVG:
+		return "svg"
+	case SVGZ:
+		return "svgz"
+	case PVR:
+		return "pvr"
+	case CR2:
+		return "cr2"
+	case NEF:
+		return "nef"
+	case ARW:
+		return "arw"
+	case DNG:
+		return "dng"
+	case ANI:
+		return "ani"
+	case PICT:
+		return "pict"
+	case DPX:
+		return "dpx"
+	case CIN:
+		return "cin"
+	case IVF:
+		return "ivf"
+	case FITS:
+		return "fits"
+	case ILBM:
+		return "ilbm"
+	case PCD:
+		return "pcd"
+	case TIM:
+		return "tim"
+	case EPS:
+		return "eps"
+	case CR3:
+		return "cr3"
+	case MPO:
+		return "mpo"
 	}
 	return ""
 }
@@ -132,6 +245,58 @@ func (t Type) Mime() string {
 		return "image/x-portable-pixmap"
 	case AVIF:
 		return "image/avif"
+	case HEIC:
+		return "image/heic"
+	case JXL:
+		return "image/jxl"
+	case ICO:
+		return "image/vnd.microsoft.icon"
+	case CUR:
+		return "image/x-win-bitmap"
+	case TGA:
+		return "image/x-tga"
+	case APNG:
+		return "image/apng"
+	case BPG:
+		return "image/bpg"
+	case PAM:
+		return "image/x-portable-arbitrarymap"
+	case SVG, SVGZ:
+		return "image/svg+xml"
+	case PVR:
+		return "image/x-pvr"
+	case CR2:
+		return "image/x-canon-cr2"
+	case NEF:
+		return "image/x-nikon-nef"
+	case ARW:
+		return "image/x-sony-arw"
+	case DNG:
+		return "image/x-adobe-dng"
+	case ANI:
+		return "application/x-navi-animation"
+	case PICT:
+		return "image/x-pict"
+	case DPX:
+		return "image/x-dpx"
+	case CIN:
+		return "image/cineon"
+	case IVF:
+		return "video/x-ivf"
+	case FITS:
+		return "image/fits"
+	case ILBM:
+		return "image/x-ilbm"
+	case PCD:
+		return "image/x-photo-cd"
+	case TIM:
+		return "image/x-sony-tim"
+	case EPS:
+		return "application/postscript"
+	case CR3:
+		return "image/x-canon-cr3"
+	case MPO:
+		return "image/mpo"
 	}
 	return ""
 }
@@ -143,6 +308,67 @@ type Info struct {
 	Height uint32 `json:"height"`
 }
 
+// AspectRatio returns the width divided by the height, or 0 when either is unknown.
+func (i Info) AspectRatio() float64 {
+	if i.Width == 0 || i.Height == 0 {
+		return 0
+	}
+	return float64(i.Width) / float64(i.Height)
+}
+
+// Megapixels returns the number of pixels in millions.
+func (i Info) Megapixels() float64 {
+	return float64(i.Width) * float64(i.Height) / 1e6
+}
+
+// Orientation returns whether the image is wider than tall, taller than wide or
+// square, as stored. It does not apply the EXIF orientation, which is the
+// Orientation field of ExtendedInfo.
+func (i Info) Orientation() Orientation {
+	switch {
+	case i.Width == 0 || i.Height == 0:
+		return OrientationUnknown
+	case i.Width > i.Height:
+		return Landscape
+	case i.Width < i.Height:
+		return Portrait
+	}
+	return Square
+}
+
+// Fits reports whether the image is no wider than maxW and no taller than maxH,
+// and false when its dimensions are unknown.
+func (i Info) Fits(maxW, maxH uint32) bool {
+	return i.Width > 0 && i.Height > 0 && i.Width <= maxW && i.Height <= maxH
+}
+
+// Orientation represents the shape of an image, or `OrientationUnknown`.
+type Orientation uint8
+
+const (
+	// OrientationUnknown represents an image whose dimensions are unknown
+	OrientationUnknown Orientation = iota
+	// Landscape represents images wider than tall
+	Landscape
+	// Portrait represents images taller than wide
+	Portrait
+	// Square represents images as wide as tall
+	Square
+)
+
+// String return a lower name of the orientation
+func (o Orientation) String() string {
+	switch o {
+	case Landscape:
+		return "landscape"
+	case Portrait:
+		return "portrait"
+	case Square:
+		return "square"
+	}
+	return ""
+}
+
 // GetType detects an image type from the provided bytes.
 // Unknown is a normal outcome and means there is insufficient data, not invalid data.
 // Callers should retry with more bytes if they need a definitive type.
@@ -155,15 +381,25 @@ func GetType(p []byte) Type {
 
 	switch {
 	case hasJPEG(p):
+		if jpegMPF(p) != nil {
+			return MPO
+		}
 		return JPEG
 	case hasPNG(p):
+		if hasPNGAnimation(p) {
+			return APNG
+		}
 		return PNG
 	case hasWEBP(p):
 		return WEBP
+	case hasANI(p):
+		return ANI
 	case hasGIF(p):
 		return GIF
 	case hasBMP(p):
 		return BMP
+	case hasPAM(p):
+		return PAM
 	case hasPPM(p):
 		return PPM
 	case hasXBM(p):
@@ -171,9 +407,9 @@ func GetType(p []byte) Type {
 	case hasXPM(p):
 		return XPM
 	case hasTIFFBig(p):
-		return TIFF
+		return tiffType(p, bigEndian)
 	case hasTIFFLittle(p):
-		return TIFF
+		return tiffType(p, littleEndian)
 	case hasPSD(p):
 		return PSD
 	case hasMNG(p):
@@ -184,13 +420,86 @@ func GetType(p []byte) Type {
 		return RAS
 	case hasPCX(p):
 		return PCX
-	case hasAVIFFtyp(p):
-		return AVIF
+	case hasFtypImage(p):
+		t, _ := ftypImageType(p)
+		return t
+	case hasJXL(p):
+		return JXL
+	case hasICO(p):
+		return ICO
+	case hasCUR(p):
+		return CUR
+	case hasBPG(p):
+		return BPG
+	case hasPVR(p):
+		return PVR
+	case hasDPX(p):
+		return DPX
+	case hasCIN(p):
+		return CIN
+	case hasIVF(p):
+		return IVF
+	case hasFITS(p):
+		return FITS
+	case hasILBM(p):
+		return ILBM
+	case hasPCD(p):
+		return PCD
+	case hasTIM(p):
+		return TIM
+	case hasEPS(p):
+		return EPS
+	case hasSVG(p):
+		return SVG
+	case hasSVGZ(p):
+		return SVGZ
+	case hasPICT(p):
+		return PICT
+	case hasTGA(p):
+		return TGA
 	}
 
 	return Unknown
 }
 
+// DetectOptions controls GetInfoWithOptions and GetInfoReaderWithOptions.
+type DetectOptions struct {
+	// ApplyOrientation swaps the width and height of images whose EXIF orientation
+	// rotates them by 90 or 270 degrees, giving the dimensions they are displayed
+	// at rather than stored at.
+	ApplyOrientation bool
+}
+
+// GetInfoWithOptions detects image info from the provided bytes like GetInfo,
+// adjusted as options say. The EXIF orientation is only applied when its tag is
+// within p, which for WebP files means the whole file.
+func GetInfoWithOptions(p []byte, options DetectOptions) Info {
+	info := GetInfo(p)
+	if options.ApplyOrientation && rotatesQuarter(exifOrientation(p)) {
+		info.Width, info.Height = info.Height, info.Width
+	}
+	return info
+}
+
+// exifOrientation returns the EXIF orientation of the image starting with p, or 0.
+func exifOrientation(p []byte) int {
+	exif := GetEXIF(p)
+	order := byteOrder(littleEndian)
+	if hasTIFFBig(exif) {
+		order = bigEndian
+	}
+	if v, ok := tiffTag(exif, order, 274); ok && v >= 1 && v <= 8 {
+		return int(v)
+	}
+	return 0
+}
+
+// rotatesQuarter reports whether the EXIF orientation o turns the image by 90 or
+// 270 degrees, with or without mirroring.
+func rotatesQuarter(o int) bool {
+	return o >= 5 && o <= 8
+}
+
 // GetInfo detects image info from the provided bytes.
 // A zero Info is a normal outcome and means there is insufficient data, not invalid data.
 // Callers should retry with more bytes if they need dimensions.
@@ -209,6 +518,8 @@ func GetInfo(p []byte) (info Info) {
 		png(p, &info)
 	case hasWEBP(p):
 		webp(p, &info)
+	case hasANI(p):
+		ani(p, &info)
 	case hasGIF(p):
 		gif(p, &info)
 	case hasBMP(p):
@@ -233,8 +544,42 @@ func GetInfo(p []byte) (info Info) {
 		ras(p, &info)
 	case hasPCX(p):
 		pcx(p, &info)
-	case hasAVIFFtyp(p):
-		avif(p, &info)
+	case hasFtypImage(p):
+		ftypImage(p, &info)
+	case hasJXL(p):
+		jxl(p, &info)
+	case hasICO(p):
+		ico(p, &info, ICO)
+	case hasCUR(p):
+		ico(p, &info, CUR)
+	case hasBPG(p):
+		bpg(p, &info)
+	case hasPVR(p):
+		pvr(p, &info)
+	case hasDPX(p):
+		dpx(p, &info)
+	case hasCIN(p):
+		cin(p, &info)
+	case hasIVF(p):
+		ivf(p, &info)
+	case hasFITS(p):
+		fits(p, &info)
+	case hasILBM(p):
+		ilbm(p, &info)
+	case hasPCD(p):
+		pcd(p, &info)
+	case hasTIM(p):
+		tim(p, &info)
+	case hasEPS(p):
+		eps(p, &info)
+	case hasSVG(p):
+		svg(p, &info)
+	case hasGzip(p):
+		svgz(p, &info)
+	case hasPICT(p):
+		pict(p, &info)
+	case hasTGA(p):
+		tga(p, &info)
 	}
 
 	return
@@ -256,6 +601,23 @@ func hasPNG(b []byte) bool {
 		b[7] == '\x0a'
 }
 
+// hasPNGAnimation reports whether the PNG data b has an acTL chunk before its
+// first IDAT chunk, which makes it an APNG. Decoders without APNG support show its
+// first frame as a still PNG.
+func hasPNGAnimation(b []byte) bool {
+	for i := 8; i+8 <= len(b); {
+		length := int(bigEndian.Uint32(b[i : i+4]))
+		switch string(b[i+4 : i+8]) {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+		i += 12 + length
+	}
+	return false
+}
+
 func hasWEBP(b []byte) bool {
 	return len(b) >= 12 &&
 		b[0] == 'R' &&
@@ -268,6 +630,10 @@ func hasWEBP(b []byte) bool {
 		b[11] == 'P'
 }
 
+func hasANI(b []byte) bool {
+	return len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "ACON"
+}
+
 func hasGIF(b []byte) bool {
 	return len(b) >= 6 &&
 		b[0] == 'G' &&
@@ -293,6 +659,16 @@ func hasPPM(b []byte) bool {
 	return false
 }
 
+// hasPAM reports a P7 header made of keyword lines, as opposed to the XV thumbnails
+// that share the magic.
+func hasPAM(b []byte) bool {
+	if len(b) < 3 || b[0] != 'P' || b[1] != '7' {
+		return false
+	}
+	_, _, ok := pamHeader(b)
+	return ok
+}
+
 func hasXBM(b []byte) bool {
 	return len(b) >= 8 &&
 		b[0] == '#' &&
@@ -342,14 +718,14 @@ func hasMNG(b []byte) bool {
 		b[7] == '\x0a'
 }
 
+// hasRGB validates the header of SGI images: the magic number, verbatim or RLE
+// storage, 1 or 2 bytes per channel and 1 to 3 dimensions.
 func hasRGB(b []byte) bool {
-	return len(b) >= 6 &&
-		b[0] == '\x01' &&
-		b[1] == '\xda' &&
-		b[2] == '[' &&
-		b[3] == '\x01' &&
-		b[4] == '\x00' &&
-		b[5] == ']'
+	if len(b) < 12 || b[0] != '\x01' || b[1] != '\xda' {
+		return false
+	}
+	storage, bpc, dimension := b[2], b[3], bigEndian.Uint16(b[4:6])
+	return storage <= 1 && (bpc == 1 || bpc == 2) && dimension >= 1 && dimension <= 3
 }
 
 func hasRAS(b []byte) bool {
@@ -360,7 +736,76 @@ func hasPCX(b []byte) bool {
 	return len(b) >= 3 && b[0] == '\x0a' && b[2] == '\x01'
 }
 
-func hasAVIFFtyp(b []byte) bool {
+// isoBrand is what an ftyp brand says about an ISO-BMFF file.
+type isoBrand struct {
+	t Type
+	// generic brands name the HEIF structure, not the codec, and give way to a
+	// specific brand.
+	generic bool
+}
+
+// isoBrands maps the ftyp brands of ISO-BMFF images to the type they declare.
+var isoBrands = map[string]isoBrand{
+	"avif": {t: AVIF},
+	"avis": {t: AVIF},
+	"heic": {t: HEIC},
+	"heix": {t: HEIC},
+	"heim": {t: HEIC},
+	"heis": {t: HEIC},
+	"hevc": {t: HEIC},
+	"hevx": {t: HEIC},
+	"hevm": {t: HEIC},
+	"hevs": {t: HEIC},
+	"mif1": {t: HEIC, generic: true},
+	"msf1": {t: HEIC, generic: true},
+	"crx ": {t: CR3},
+	"jxl ": {t: JXL},
+}
+
+func hasFtypImage(b []byte) bool {
+	t, _ := ftypImageType(b)
+	return t != Unknown
+}
+
+// ftypImageType classifies an ISO-BMFF file by the brands of its ftyp box in one
+// pass, and returns the brand that decided. The major brand wins unless it is
+// generic, then the first specific compatible brand, then a generic one.
+func ftypImageType(b []byte) (Type, string) {
+	box, header := ftypBox(b)
+	if len(box) < header+8 {
+		return Unknown, ""
+	}
+	var generic string
+	for i := header; i+4 <= len(box); i += 4 {
+		if i == header+4 {
+			continue // minor version
+		}
+		brand := string(box[i : i+4])
+		class, ok := isoBrands[brand]
+		switch {
+		case !ok:
+		case !class.generic:
+			return class.t, brand
+		case generic == "":
+			generic = brand
+		}
+	}
+	if generic == "" {
+		return Unknown, ""
+	}
+	return isoBrands[generic].t, generic
+}
+
+// GetBrand returns the ftyp brand by which GetType classified an ISO-BMFF image,
+// such as avis for an AVIF image sequence or heix for a 10-bit HEIC image, or ""
+// when p is not one.
+func GetBrand(p []byte) string {
+	_, brand := ftypImageType(p)
+	return brand
+}
+
+// ftypBox returns the ftyp box of an ISO-BMFF file and the length of its header.
+func ftypBox(b []byte) ([]byte, int) {
 	for i := 0; i+8 <= len(b); {
 		size32 := bigEndian.Uint32(b[i : i+4])
 		size := int(size32)
@@ -368,11 +813,11 @@ func hasAVIFFtyp(b []byte) bool {
 		switch size32 {
 		case 1:
 			if i+16 > len(b) {
-				return false
+				return nil, 0
 			}
 			size64 := readUint64(b[i+8 : i+16])
 			if size64 < 16 || size64 > uint64(len(b)-i) {
-				return false
+				return nil, 0
 			}
 			size = int(size64)
 			header = 16
@@ -380,43 +825,203 @@ func hasAVIFFtyp(b []byte) bool {
 			size = len(b) - i
 		}
 		if size < header {
-			return false
+			return nil, 0
 		}
 		if i+size > len(b) {
-			return false
+			return nil, 0
 		}
 		if b[i+4] == 'f' &&
 			b[i+5] == 't' &&
 			b[i+6] == 'y' &&
 			b[i+7] == 'p' {
-			return ftypHasAVIF(b[i:i+size], header)
+			return b[i : i+size], header
 		}
 		i += size
 	}
-	return false
+	return nil, 0
 }
 
-func ftypHasAVIF(b []byte, header int) bool {
+// ftypHasBrand reports whether the major or a compatible brand of the ftyp box b
+// satisfies isBrand.
+func ftypHasBrand(b []byte, header int, isBrand func([]byte) bool) bool {
 	if len(b) < header+8 {
 		return false
 	}
-	if isAVIFBrand(b[header : header+4]) {
+	if isBrand(b[header : header+4]) {
 		return true
 	}
 	for i := header + 8; i+4 <= len(b); i += 4 {
-		if isAVIFBrand(b[i : i+4]) {
+		if isBrand(b[i : i+4]) {
 			return true
 		}
 	}
 	return false
 }
 
-func isAVIFBrand(b []byte) bool {
+// jxlSignature is the first box of a JPEG XL container.
+var jxlSignature = []byte{0, 0, 0, 0x0c, 'J', 'X', 'L', ' ', 0x0d, 0x0a, 0x87, 0x0a}
+
+func hasJXL(b []byte) bool {
+	return hasJXLCodestream(b) || (len(b) >= 12 && string(b[:12]) == string(jxlSignature))
+}
+
+func hasJXLCodestream(b []byte) bool {
+	return len(b) >= 2 && b[0] == '\xff' && b[1] == '\x0a'
+}
+
+func hasICO(b []byte) bool {
+	return hasICODirectory(b) && b[2] == 1
+}
+
+func hasCUR(b []byte) bool {
+	return hasICODirectory(b) && b[2] == 2
+}
+
+func hasBPG(b []byte) bool {
+	return len(b) >= 4 && b[0] == 'B' && b[1] == 'P' && b[2] == 'G' && b[3] == '\xfb'
+}
+
+// hasPVR matches the version field of PVR v3 headers, written in either byte order.
+func hasPVR(b []byte) bool {
+	return len(b) >= 4 && (string(b[:4]) == "PVR\x03" || string(b[:4]) == "\x03RVP")
+}
+
+// hasDPX matches the DPX magic number, written in either byte order.
+func hasDPX(b []byte) bool {
+	return len(b) >= 4 && (string(b[:4]) == "SDPX" || string(b[:4]) == "XPDS")
+}
+
+// hasCIN matches the Cineon magic number, written in either byte order.
+func hasCIN(b []byte) bool {
 	return len(b) >= 4 &&
-		b[0] == 'a' &&
-		b[1] == 'v' &&
-		b[2] == 'i' &&
-		(b[3] == 'f' || b[3] == 's')
+		(string(b[:4]) == "\x80\x2a\x5f\xd7" || string(b[:4]) == "\xd7\x5f\x2a\x80")
+}
+
+// hasIVF matches the signature and version 0 of IVF files, which hold AV1, VP8 or
+// VP9 frames as named by the FourCC in their header.
+func hasIVF(b []byte) bool {
+	return len(b) >= 6 && string(b[:4]) == "DKIF" && b[4] == 0 && b[5] == 0
+}
+
+// fitsCardLen is the length of the keyword records of FITS headers.
+const fitsCardLen = 80
+
+// hasFITS matches the SIMPLE keyword that starts FITS files, set to true.
+func hasFITS(b []byte) bool {
+	if len(b) < fitsCardLen || string(b[:10]) != "SIMPLE  = " {
+		return false
+	}
+	value, _ := fitsValue(b[:fitsCardLen])
+	return string(value) == "T"
+}
+
+// hasILBM matches IFF FORM containers of interleaved (ILBM) or chunky (PBM)
+// bitmaps.
+func hasILBM(b []byte) bool {
+	return len(b) >= 12 && string(b[:4]) == "FORM" && (string(b[8:12]) == "ILBM" || string(b[8:12]) == "PBM ")
+}
+
+// Photo CD image packs start with a sector of 0xff bytes followed by their
+// "PCD_IPI" header, and overview files with "PCD_OPA".
+const (
+	pcdImageMagicOffset = 0x800
+	pcdOrientation      = 0xe02
+)
+
+func hasPCD(b []byte) bool {
+	return (len(b) >= 7 && string(b[:7]) == "PCD_OPA") ||
+		(len(b) >= pcdImageMagicOffset+7 && string(b[pcdImageMagicOffset:pcdImageMagicOffset+7]) == "PCD_IPI")
+}
+
+// hasTIM matches the TIM magic number and a flags word with a pixel mode of 4, 8, 16
+// or 24 bits per pixel, where only the first two may have a color lookup table.
+func hasTIM(b []byte) bool {
+	if len(b) < 8 || littleEndian.Uint32(b[:4]) != 0x10 {
+		return false
+	}
+	flags := littleEndian.Uint32(b[4:8])
+	mode, clut := flags&7, flags&8 != 0
+	return flags&^0xf == 0 && mode <= 3 && (!clut || mode <= 1)
+}
+
+// epsBinaryMagic starts DOS EPS files, which wrap the PostScript with TIFF or WMF
+// previews.
+const epsBinaryMagic = "\xc5\xd0\xd3\xc6"
+
+// hasEPS matches PostScript whose first line declares EPSF conformance, and the
+// header of DOS EPS files.
+func hasEPS(b []byte) bool {
+	if len(b) >= 4 && string(b[:4]) == epsBinaryMagic {
+		return true
+	}
+	if !bytes.HasPrefix(b, []byte("%!PS-Adobe-")) {
+		return false
+	}
+	line, _ := readLine(b, 0)
+	return bytes.Contains(line, []byte(" EPSF-"))
+}
+
+// pictHeaderLen is the length of the application header that precedes the picture
+// in PICT files, but not in PICT resources or clipboard data.
+const pictHeaderLen = 512
+
+func hasPICT(b []byte) bool {
+	return pictStart(b) >= 0
+}
+
+// pictStart returns the offset of the picture in PICT data b, after the file header
+// or at the start of headerless data, or -1. A picture starts with its size and
+// frame, followed by the version opcode: 0x1101 for version 1 or 0x001102ff for
+// version 2.
+func pictStart(b []byte) int {
+	for _, i := range []int{pictHeaderLen, 0} {
+		if i+14 > len(b) {
+			continue
+		}
+		p := b[i:]
+		v1 := p[10] == 0x11 && p[11] == 0x01
+		v2 := p[10] == 0x00 && p[11] == 0x11 && p[12] == 0x02 && p[13] == 0xff
+		top, left := int16(bigEndian.Uint16(p[2:4])), int16(bigEndian.Uint16(p[4:6]))
+		bottom, right := int16(bigEndian.Uint16(p[6:8])), int16(bigEndian.Uint16(p[8:10]))
+		if (v1 || v2) && bottom > top && right > left {
+			return i
+		}
+	}
+	return -1
+}
+
+// tgaFooter ends TGA 2.0 files.
+const tgaFooter = "TRUEVISION-XFILE.\x00"
+
+// hasTGA validates the fields of a TGA header, as the format has no magic number.
+// When b ends with the TGA 2.0 footer, the color map fields, which some writers
+// leave unset, are not checked. TGA is the last format tried.
+func hasTGA(b []byte) bool {
+	if len(b) < 18 {
+		return false
+	}
+	mapType, imageType, depth := b[1], b[2], b[16]
+	switch {
+	case mapType > 1,
+		imageType != 1 && imageType != 2 && imageType != 3 && imageType != 9 && imageType != 10 && imageType != 11,
+		depth != 8 && depth != 15 && depth != 16 && depth != 24 && depth != 32,
+		b[17]&0xc0 != 0,
+		littleEndian.Uint16(b[12:14]) == 0 || littleEndian.Uint16(b[14:16]) == 0:
+		return false
+	}
+	if len(b) >= 26 && string(b[len(b)-18:]) == tgaFooter {
+		return true
+	}
+
+	mapLength, mapDepth := littleEndian.Uint16(b[5:7]), b[7]
+	colorMapped := imageType == 1 || imageType == 9
+	if colorMapped != (mapType == 1) {
+		return false
+	}
+	if mapType == 0 {
+		return mapLength == 0 && b[3] == 0 && b[4] == 0
+	}
+	return mapLength > 0 && (mapDepth == 15 || mapDepth == 16 || mapDepth == 24 || mapDepth == 32)
 }
 
 func jpeg(b []byte, info *Info) {
@@ -432,11 +1037,14 @@ func jpeg(b []byte, info *Info) {
 		switch {
 		case marker != 0xff:
 			return
-		case code >= 0xc0 && code <= 0xc3:
+		case isSOF(code):
 			if i+4 >= len(b) {
 				return
 			}
 			info.Type = JPEG
+			if jpegMPF(b) != nil {
+				info.Type = MPO
+			}
 			info.Width = uint32(b[i+4]) | uint32(b[i+3])<<8
 			info.Height = uint32(b[i+2]) | uint32(b[i+1])<<8
 			return
@@ -449,6 +1057,32 @@ func jpeg(b []byte, info *Info) {
 	}
 }
 
+// isSOF reports whether code is a start of frame marker, which gives the size of the
+// image. C4, C8 and CC fall in the same range but define Huffman tables, a JPEG
+// extension and arithmetic coding conditioning.
+func isSOF(code byte) bool {
+	return code >= 0xc0 && code <= 0xcf && code != 0xc4 && code != 0xc8 && code != 0xcc
+}
+
+// jpegMPF returns the MP Index IFD, in TIFF format, of the APP2 MPF segment that
+// makes a JPEG file the first image of an MPO file, or nil when there is none
+// before the frame header.
+func jpegMPF(b []byte) []byte {
+	for i := 2; i+3 < len(b); {
+		code := b[i+1]
+		length := int(b[i+3]) | int(b[i+2])<<8
+		if b[i] != 0xff || length < 2 || code == 0xda || isSOF(code) {
+			return nil
+		}
+		seg := b[i+4 : min(i+2+length, len(b))]
+		if code == 0xe2 && len(seg) >= 12 && bytes.HasPrefix(seg, []byte("MPF\x00")) {
+			return seg[4:]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
 func webp(b []byte, info *Info) {
 	if len(b) < 30 {
 		return
@@ -476,14 +1110,234 @@ func webp(b []byte, info *Info) {
 	}
 }
 
-func avif(b []byte, info *Info) {
-	info.Width, info.Height = avifDimensions(b)
+// ani reports the size of the first frame of an animated cursor. Frames are
+// usually ICO or CUR files, in which case the size in the anih header is zero;
+// otherwise they are raw bitmaps of the size it gives.
+func ani(b []byte, info *Info) {
+	var width, height uint32
+	for i := 12; i+8 <= len(b); {
+		id := string(b[i : i+4])
+		size := int(littleEndian.Uint32(b[i+4 : i+8]))
+		data := b[i+8 : min(i+8+size, len(b))]
+		switch {
+		case id == "anih" && len(data) >= 20:
+			width, height = littleEndian.Uint32(data[12:16]), littleEndian.Uint32(data[16:20])
+		case id == "LIST" && len(data) >= 4 && string(data[:4]) == "fram":
+			if len(data) >= 12 && string(data[4:8]) == "icon" && hasICODirectory(data[12:]) {
+				width, height = icoLargest(data[12:])
+			}
+			if width != 0 && height != 0 {
+				info.Type, info.Width, info.Height = ANI, width, height
+			}
+			return
+		}
+		i += 8 + size + size&1
+	}
+}
+
+// ftypImage reads the size of an ISO-BMFF image the way its brands call for.
+func ftypImage(b []byte, info *Info) {
+	t, _ := ftypImageType(b)
+	switch t {
+	case AVIF, HEIC:
+		info.Width, info.Height = heifDimensions(b)
+	case CR3:
+		info.Width, info.Height = cr3Dimensions(b)
+	case JXL:
+		jxl(b, info)
+		return
+	}
 	if info.Width != 0 && info.Height != 0 {
-		info.Type = AVIF
+		info.Type = t
+	}
+}
+
+// heifDimensions returns the size in the ispe property of the primary item. Files
+// with a grid, such as iPhone photos, also carry the smaller size of their tiles.
+// When the meta box cannot be followed, for example because a sparse download
+// left out a box before it, the first ispe found is used. Image sequences without
+// a primary item report the size of their first video track.
+func heifDimensions(b []byte) (uint32, uint32) {
+	if width, height, ok := heifPrimaryDimensions(b); ok {
+		return width, height
+	}
+	if width, height := firstISPE(b); width != 0 && height != 0 {
+		return width, height
+	}
+	return trackDimensions(b)
+}
+
+// trackDimensions returns the size in the tkhd box of the first track of the moov
+// box that has one, as 16.16 fixed-point values.
+func trackDimensions(b []byte) (uint32, uint32) {
+	moov := isoBox(b, "moov")
+	for i := 1; ; i++ {
+		trak, name := isoChild(moov, i)
+		if trak == nil {
+			return 0, 0
+		}
+		if name != "trak" {
+			continue
+		}
+		tkhd := isoBox(trak, "tkhd")
+		if len(tkhd) < 1 {
+			continue
+		}
+		offset := 76 // version 0, with 32-bit times and duration
+		if tkhd[0] == 1 {
+			offset = 88
+		}
+		if len(tkhd) < offset+8 {
+			continue
+		}
+		width, height := bigEndian.Uint32(tkhd[offset:offset+4])>>16, bigEndian.Uint32(tkhd[offset+4:offset+8])>>16
+		if width != 0 && height != 0 {
+			return width, height
+		}
+	}
+}
+
+// isHEIFSequence reports whether the ftyp box of b names an image sequence brand:
+// avis for AVIF, the HEVC sequence brands or the generic msf1.
+func isHEIFSequence(b []byte) bool {
+	box, header := ftypBox(b)
+	return box != nil && ftypHasBrand(box, header, func(brand []byte) bool {
+		switch string(brand[:4]) {
+		case "avis", "hevc", "hevx", "hevm", "hevs", "msf1":
+			return true
+		}
+		return false
+	})
+}
+
+func heifPrimaryDimensions(b []byte) (uint32, uint32, bool) {
+	prop := heifPrimaryProperty(b, "ispe")
+	if len(prop) < 12 {
+		return 0, 0, false
 	}
+	width, height := bigEndian.Uint32(prop[4:8]), bigEndian.Uint32(prop[8:12])
+	return width, height, width != 0 && height != 0
 }
 
-func avifDimensions(b []byte) (uint32, uint32) {
+// heifPrimaryProperty returns the payload of the property named name that the ipma
+// box associates with the primary item, or nil when there is none or the boxes
+// leading to it are missing.
+func heifPrimaryProperty(b []byte, name string) []byte {
+	meta := isoBox(b, "meta")
+	if len(meta) < 4 {
+		return nil
+	}
+	meta = meta[4:] // version and flags
+
+	pitm := isoBox(meta, "pitm")
+	if len(pitm) < 6 {
+		return nil
+	}
+	primary := uint32(bigEndian.Uint16(pitm[4:6]))
+	if pitm[0] != 0 {
+		if len(pitm) < 8 {
+			return nil
+		}
+		primary = bigEndian.Uint32(pitm[4:8])
+	}
+
+	iprp := isoBox(meta, "iprp")
+	ipco, ipma := isoBox(iprp, "ipco"), isoBox(iprp, "ipma")
+	if ipco == nil || len(ipma) < 8 {
+		return nil
+	}
+	version, wide := ipma[0], ipma[3]&1 != 0
+	count := bigEndian.Uint32(ipma[4:8])
+	i := 8
+	for range count {
+		var item uint32
+		if version < 1 {
+			if i+2 > len(ipma) {
+				return nil
+			}
+			item = uint32(bigEndian.Uint16(ipma[i : i+2]))
+			i += 2
+		} else {
+			if i+4 > len(ipma) {
+				return nil
+			}
+			item = bigEndian.Uint32(ipma[i : i+4])
+			i += 4
+		}
+		if i >= len(ipma) {
+			return nil
+		}
+		n := int(ipma[i])
+		i++
+		for range n {
+			var index int
+			if wide {
+				if i+2 > len(ipma) {
+					return nil
+				}
+				index = int(bigEndian.Uint16(ipma[i:i+2]) & 0x7fff)
+				i += 2
+			} else {
+				if i >= len(ipma) {
+					return nil
+				}
+				index = int(ipma[i] & 0x7f)
+				i++
+			}
+			if item != primary {
+				continue
+			}
+			if prop, propName := isoChild(ipco, index); propName == name {
+				return prop
+			}
+		}
+	}
+	return nil
+}
+
+// isoBox returns the payload of the first box named name among the boxes in b, or
+// nil when there is none or the boxes before it are truncated.
+func isoBox(b []byte, name string) []byte {
+	for i := 1; ; i++ {
+		payload, boxName := isoChild(b, i)
+		if payload == nil || boxName == name {
+			return payload
+		}
+	}
+}
+
+// isoChild returns the payload and the name of the index-th box in b, counting
+// from 1, or nil when there are fewer complete boxes.
+func isoChild(b []byte, index int) ([]byte, string) {
+	for i := 0; i+8 <= len(b); {
+		size := int(bigEndian.Uint32(b[i : i+4]))
+		header := 8
+		switch size {
+		case 0:
+			size = len(b) - i
+		case 1:
+			if i+16 > len(b) {
+				return nil, ""
+			}
+			size64 := readUint64(b[i+8 : i+16])
+			if size64 > uint64(len(b)-i) {
+				return nil, ""
+			}
+			size, header = int(size64), 16
+		}
+		if size < header || i+size > len(b) {
+			return nil, ""
+		}
+		if index--; index == 0 {
+			return b[i+header : i+size], string(b[i+4 : i+8])
+		}
+		i += size
+	}
+	return nil, ""
+}
+
+// firstISPE returns the size in the first ispe property found in b.
+func firstISPE(b []byte) (uint32, uint32) {
 	for i := 4; i+16 <= len(b); i++ {
 		if b[i] != 'i' ||
 			b[i+1] != 's' ||
@@ -507,6 +1361,398 @@ func avifDimensions(b []byte) (uint32, uint32) {
 	return 0, 0
 }
 
+func jxl(b []byte, info *Info) {
+	if !hasJXLCodestream(b) {
+		b = jxlCodestream(b)
+	}
+	if len(b) < 2 {
+		return
+	}
+	info.Width, info.Height = jxlSize(b[2:])
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = JXL
+	}
+}
+
+// jxlCodestream returns the start of the codestream in a JPEG XL container, held by
+// a jxlc box or split across jxlp boxes that start with a 4-byte index.
+func jxlCodestream(b []byte) []byte {
+	if t, _ := ftypImageType(b); t != JXL {
+		return nil
+	}
+	for i := 1; ; i++ {
+		payload, name := isoChild(b, i)
+		switch {
+		case payload == nil:
+			return nil
+		case name == "jxlc":
+			return payload
+		case name == "jxlp" && len(payload) >= 4:
+			return payload[4:]
+		}
+	}
+}
+
+// jxlRatios are the width to height ratios a JPEG XL size header can select
+// instead of coding the width.
+var jxlRatios = [8][2]uint32{1: {1, 1}, 2: {12, 10}, 3: {4, 3}, 4: {3, 2}, 5: {16, 9}, 6: {5, 4}, 7: {2, 1}}
+
+// jxlSize decodes the SizeHeader that follows the codestream signature.
+func jxlSize(b []byte) (uint32, uint32) {
+	r := lsbBitReader{b: b}
+	small := r.read(1) == 1
+	sizeField := func() uint32 {
+		if small {
+			return (r.read(5) + 1) * 8
+		}
+		return r.read([4]int{9, 13, 18, 30}[r.read(2)]) + 1
+	}
+	height := sizeField()
+	ratio := r.read(3)
+	var width uint32
+	if ratio == 0 {
+		width = sizeField()
+	} else {
+		width = uint32(uint64(height) * uint64(jxlRatios[ratio][0]) / uint64(jxlRatios[ratio][1]))
+	}
+	if r.short {
+		return 0, 0
+	}
+	return width, height
+}
+
+// lsbBitReader reads bit fields least significant bit first. Reading past the end
+// returns zero bits and sets short.
+type lsbBitReader struct {
+	b     []byte
+	pos   int // in bits
+	short bool
+}
+
+func (r *lsbBitReader) read(n int) uint32 {
+	var v uint32
+	for i := range n {
+		if r.pos/8 >= len(r.b) {
+			r.short = true
+			return 0
+		}
+		v |= uint32(r.b[r.pos/8]>>(r.pos%8)&1) << i
+		r.pos++
+	}
+	return v
+}
+
+// ico reads ICO and CUR files, given as t. Their directories only differ in the
+// fields after the size, which cursors use for the hotspot.
+func ico(b []byte, info *Info, t Type) {
+	info.Width, info.Height = icoLargest(b)
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = t
+	}
+}
+
+// icoLargest returns the size of the largest image listed in the ICO or CUR
+// directory within b. The directory stores sizes in a byte, with 0 meaning 256 or
+// more, so the header of a PNG entry is read for its real size when b holds it.
+func icoLargest(b []byte) (width, height uint32) {
+	count := int(littleEndian.Uint16(b[4:6]))
+	for i := 6; count > 0 && i+16 <= len(b); i, count = i+16, count-1 {
+		w, h := uint32(b[i]), uint32(b[i+1])
+		if w == 0 || h == 0 {
+			offset := int(littleEndian.Uint32(b[i+12 : i+16]))
+			var entry Info
+			if offset > 0 && offset+24 <= len(b) && hasPNG(b[offset:]) {
+				png(b[offset:offset+24], &entry)
+			}
+			if entry.Type == PNG {
+				w, h = entry.Width, entry.Height
+			}
+		}
+		if w == 0 {
+			w = 256
+		}
+		if h == 0 {
+			h = 256
+		}
+		if uint64(w)*uint64(h) > uint64(width)*uint64(height) {
+			width, height = w, h
+		}
+	}
+	return width, height
+}
+
+func bpg(b []byte, info *Info) {
+	// The magic is followed by two bytes of pixel format and flags.
+	i := 6
+	info.Width, i = readUE7(b, i)
+	info.Height, _ = readUE7(b, i)
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = BPG
+	}
+}
+
+// readUE7 reads the unsigned integer at i in b stored in big-endian groups of 7
+// bits, with the high bit set on all but the last byte, and returns the index after
+// it. It returns 0 when the value is truncated or longer than 32 bits.
+func readUE7(b []byte, i int) (uint32, int) {
+	var v uint64
+	for n := 0; n < 5 && i < len(b); n++ {
+		c := b[i]
+		i++
+		v = v<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			if v > 1<<32-1 {
+				return 0, i
+			}
+			return uint32(v), i
+		}
+	}
+	return 0, i
+}
+
+func pvr(b []byte, info *Info) {
+	if len(b) < 32 {
+		return
+	}
+	var order byteOrder = littleEndian
+	if b[0] == '\x03' {
+		order = bigEndian
+	}
+	info.Height = order.Uint32(b[24:28])
+	info.Width = order.Uint32(b[28:32])
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = PVR
+	}
+}
+
+// dpx reads the pixels per line and lines per element of the image information
+// header, which follows the 768-byte file information header.
+func dpx(b []byte, info *Info) {
+	if len(b) < 780 {
+		return
+	}
+	var order byteOrder = bigEndian
+	if b[0] == 'X' {
+		order = littleEndian
+	}
+	info.Width = order.Uint32(b[772:776])
+	info.Height = order.Uint32(b[776:780])
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = DPX
+	}
+}
+
+// cin reads the pixels per line and lines per image of the first channel in the
+// image information header, which follows the 192-byte file information header.
+func cin(b []byte, info *Info) {
+	if len(b) < 208 {
+		return
+	}
+	var order byteOrder = bigEndian
+	if b[0] == '\xd7' {
+		order = littleEndian
+	}
+	info.Width = order.Uint32(b[200:204])
+	info.Height = order.Uint32(b[204:208])
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = CIN
+	}
+}
+
+func ivf(b []byte, info *Info) {
+	if len(b) < 16 {
+		return
+	}
+	info.Width = uint32(littleEndian.Uint16(b[12:14]))
+	info.Height = uint32(littleEndian.Uint16(b[14:16]))
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = IVF
+	}
+}
+
+// fits reads NAXIS1 and NAXIS2 from the primary header, up to its END card. Images
+// in extensions, after a primary header without data, are not reported.
+func fits(b []byte, info *Info) {
+	var naxis, width, height uint32
+	for i := 0; i+fitsCardLen <= len(b); i += fitsCardLen {
+		card := b[i : i+fitsCardLen]
+		keyword := bytes.TrimRight(card[:8], " ")
+		if string(keyword) == "END" {
+			break
+		}
+		value, ok := fitsValue(card)
+		if !ok {
+			continue
+		}
+		switch string(keyword) {
+		case "NAXIS":
+			naxis, _ = parseUint32(value, 0)
+		case "NAXIS1":
+			width, _ = parseUint32(value, 0)
+		case "NAXIS2":
+			height, _ = parseUint32(value, 0)
+		default:
+			continue
+		}
+		if naxis == 1 && width != 0 {
+			height = 1
+		}
+		if naxis >= 1 && width != 0 && height != 0 {
+			info.Type, info.Width, info.Height = FITS, width, height
+			return
+		}
+	}
+}
+
+// fitsValue returns the value of a FITS header card, without its comment, and
+// false when the card has none.
+func fitsValue(card []byte) ([]byte, bool) {
+	if len(card) < 10 || card[8] != '=' || card[9] != ' ' {
+		return nil, false
+	}
+	value := card[10:]
+	if i := bytes.IndexByte(value, '/'); i >= 0 {
+		value = value[:i]
+	}
+	value = bytes.TrimSpace(value)
+	return value, len(value) > 0
+}
+
+// ilbm reads the size from the BMHD chunk, which precedes the image data.
+func ilbm(b []byte, info *Info) {
+	for i := 12; i+8 <= len(b); {
+		size := int(bigEndian.Uint32(b[i+4 : i+8]))
+		switch string(b[i : i+4]) {
+		case "BMHD":
+			if i+12 > len(b) {
+				return
+			}
+			info.Width = uint32(bigEndian.Uint16(b[i+8 : i+10]))
+			info.Height = uint32(bigEndian.Uint16(b[i+10 : i+12]))
+			if info.Width != 0 && info.Height != 0 {
+				info.Type = ILBM
+			}
+			return
+		case "BODY":
+			return
+		}
+		i += 8 + size + size&1
+	}
+}
+
+// pcd reports the Base resolution of Photo CD images, 768x512, which image packs
+// also store at 4 and 16 times fewer and up to 16 times more pixels. Portrait image
+// packs, rotated by 90 or 270 degrees, report 512x768. Overview files hold Base/16
+// thumbnails of a whole disc and report the Base resolution too.
+func pcd(b []byte, info *Info) {
+	info.Width, info.Height = 768, 512
+	if string(b[:7]) != "PCD_OPA" {
+		if len(b) <= pcdOrientation {
+			info.Width, info.Height = 0, 0
+			return
+		}
+		if b[pcdOrientation]&1 != 0 {
+			info.Width, info.Height = 512, 768
+		}
+	}
+	info.Type = PCD
+}
+
+// tim reads the size of the image block, after the color lookup table when there
+// is one. Its width counts 16-bit units of frame buffer, which hold 4 pixels at 4
+// bits per pixel, 2 at 8 bits, 1 at 16 bits and 2/3 at 24 bits.
+func tim(b []byte, info *Info) {
+	flags := littleEndian.Uint32(b[4:8])
+	i := 8
+	if flags&8 != 0 {
+		if i+4 > len(b) {
+			return
+		}
+		i += int(littleEndian.Uint32(b[i : i+4]))
+	}
+	if i < 8 || i+12 > len(b) {
+		return
+	}
+	width := uint32(littleEndian.Uint16(b[i+8 : i+10]))
+	switch flags & 7 {
+	case 0:
+		width *= 4
+	case 1:
+		width *= 2
+	case 3:
+		width = width * 2 / 3
+	}
+	info.Width = width
+	info.Height = uint32(littleEndian.Uint16(b[i+10 : i+12]))
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = TIM
+	}
+}
+
+// eps reports the size of the %%BoundingBox comment, in points. A bounding box
+// deferred with "(atend)" is looked for further on, in the trailer.
+func eps(b []byte, info *Info) {
+	if string(b[:4]) == epsBinaryMagic {
+		if len(b) < 12 {
+			return
+		}
+		offset, length := int64(littleEndian.Uint32(b[4:8])), int64(littleEndian.Uint32(b[8:12]))
+		if offset >= int64(len(b)) {
+			return
+		}
+		b = b[offset:min(offset+length, int64(len(b)))]
+	}
+	prefix := []byte("%%BoundingBox:")
+	for i := 0; ; {
+		j := bytes.Index(b[i:], prefix)
+		if j < 0 {
+			return
+		}
+		i += j + len(prefix)
+		line, _ := readLine(b, i)
+		fields := bytes.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		var box [4]int64
+		var err error
+		for k := range box {
+			if box[k], err = strconv.ParseInt(string(fields[k]), 10, 32); err != nil {
+				break
+			}
+		}
+		if err != nil || bytes.IndexByte(line, '\n') < 0 {
+			// "(atend)", or a line that may go on past b.
+			continue
+		}
+		if box[2] > box[0] && box[3] > box[1] {
+			info.Type, info.Width, info.Height = EPS, uint32(box[2]-box[0]), uint32(box[3]-box[1])
+		}
+		return
+	}
+}
+
+// pict reports the size of the picture frame, which is in 72 dpi units for version
+// 2 pictures stored at a higher resolution.
+func pict(b []byte, info *Info) {
+	i := pictStart(b)
+	if i < 0 {
+		return
+	}
+	p := b[i:]
+	top, left := int16(bigEndian.Uint16(p[2:4])), int16(bigEndian.Uint16(p[4:6]))
+	bottom, right := int16(bigEndian.Uint16(p[6:8])), int16(bigEndian.Uint16(p[8:10]))
+	info.Type = PICT
+	info.Width = uint32(int32(right) - int32(left))
+	info.Height = uint32(int32(bottom) - int32(top))
+}
+
+func tga(b []byte, info *Info) {
+	info.Width = uint32(littleEndian.Uint16(b[12:14]))
+	info.Height = uint32(littleEndian.Uint16(b[14:16]))
+	info.Type = TGA
+}
+
 func png(b []byte, info *Info) {
 	if len(b) < 24 {
 		return
@@ -527,6 +1773,9 @@ func png(b []byte, info *Info) {
 
 	if info.Width != 0 && info.Height != 0 {
 		info.Type = PNG
+		if hasPNGAnimation(b) {
+			info.Type = APNG
+		}
 	}
 }
 
@@ -575,10 +1824,20 @@ func ppm(b []byte, info *Info) {
 	case '4':
 		info.Type = BPM
 	case '7':
+		if width, height, ok := pamHeader(b); ok {
+			info.Type, info.Width, info.Height = PAM, width, height
+			if width == 0 || height == 0 {
+				info.Type = Unknown
+			}
+			return
+		}
 		info.Type = XV
 	}
 
 	i := skipSpace(b, 2)
+	if b[1] == '7' {
+		i = skipXVComments(b, i)
+	}
 	info.Width, i = parseUint32(b, i)
 	i = skipSpace(b, i)
 	info.Height, _ = parseUint32(b, i)
@@ -588,6 +1847,61 @@ func ppm(b []byte, info *Info) {
 	}
 }
 
+// pamHeader reads the WIDTH and HEIGHT lines of a PAM header, which starts with
+// "P7" and a newline. ok is false when the first line after comments is not a
+// keyword line, or the header ends before its dimensions.
+func pamHeader(b []byte) (width, height uint32, ok bool) {
+	if len(b) < 3 || (b[2] != '\n' && b[2] != '\r') {
+		return 0, 0, false
+	}
+	var line []byte
+	for i := 3; i < len(b); {
+		line, i = readLine(b, i)
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, value, _ := bytes.Cut(line, []byte(" "))
+		switch string(key) {
+		case "WIDTH", "HEIGHT":
+			if len(value) == 0 {
+				return 0, 0, false
+			}
+			if n, _ := parseUint32(value, 0); key[0] == 'W' {
+				width = n
+			} else {
+				height = n
+			}
+		case "DEPTH", "MAXVAL", "TUPLTYPE":
+		case "ENDHDR":
+			return width, height, true
+		default:
+			return 0, 0, false
+		}
+		if width != 0 && height != 0 {
+			return width, height, true
+		}
+	}
+	return 0, 0, false
+}
+
+// skipXVComments skips the "332" format tag and the comment lines that follow it
+// in XV thumbnails, which put the dimensions after them.
+func skipXVComments(b []byte, i int) int {
+	if i+3 > len(b) || string(b[i:i+3]) != "332" {
+		return i
+	}
+	j := skipSpace(b, i+3)
+	if j == i+3 || j >= len(b) || b[j] != '#' {
+		return i
+	}
+	for j < len(b) && b[j] == '#' {
+		_, j = readLine(b, j)
+		j = skipSpace(b, j)
+	}
+	return j
+}
+
 func xbm(b []byte, info *Info) {
 	var p []byte
 	var i int
@@ -630,7 +1944,7 @@ func xpm(b []byte, info *Info) {
 			break
 		}
 		j = skipSpace(line, 0)
-		if line[j] != '"' {
+		if j == len(line) || line[j] != '"' {
 			continue
 		}
 		info.Width, j = parseUint32(line, j+1)
@@ -644,19 +1958,37 @@ func xpm(b []byte, info *Info) {
 	}
 }
 
+// tiffType returns the camera RAW format of the TIFF data b, or TIFF.
+func tiffType(b []byte, order byteOrder) Type {
+	if t := rawType(b, order); t != Unknown {
+		return t
+	}
+	return TIFF
+}
+
 func tiff(b []byte, info *Info, order byteOrder) {
+	if len(b) < 8 {
+		return
+	}
+	if t := rawType(b, order); t != Unknown {
+		raw(b, info, order, t)
+		return
+	}
 	i := int(order.Uint32(b[4:8]))
-	n := int(order.Uint16(b[i+2 : i+4]))
+	if i < 8 || i+2 > len(b) {
+		return
+	}
+	n := int(order.Uint16(b[i : i+2]))
 	i += 2
 
-	for ; i < n*12; i += 12 {
+	for ; n > 0 && i+12 <= len(b); i, n = i+12, n-1 {
 		tag := order.Uint16(b[i : i+2])
 		datatype := order.Uint16(b[i+2 : i+4])
 
 		var value uint32
 		switch datatype {
 		case 1, 6:
-			value = uint32(b[i+9])
+			value = uint32(b[i+8])
 		case 3, 8:
 			value = uint32(order.Uint16(b[i+8 : i+10]))
 		case 4, 9:
@@ -723,16 +2055,17 @@ func mng(b []byte, info *Info) {
 	}
 }
 
+// rgb reads XSIZE and YSIZE of SGI images. One-dimensional images are a single
+// row, whatever YSIZE holds.
 func rgb(b []byte, info *Info) {
 	if len(b) < 10 {
 		return
 	}
-	_ = b[9]
-
-	info.Width = uint32(b[6])<<8 |
-		uint32(b[7])
-	info.Height = uint32(b[8])<<8 |
-		uint32(b[9])
+	info.Width = uint32(bigEndian.Uint16(b[6:8]))
+	info.Height = uint32(bigEndian.Uint16(b[8:10]))
+	if bigEndian.Uint16(b[4:6]) == 1 {
+		info.Height = 1
+	}
 
 	if info.Width != 0 && info.Height != 0 {
 		info.Type = RGB
@@ -798,14 +2131,16 @@ func readNonSpace(b []byte, i int) (p []byte, j int) {
 	return
 }
 
+// readLine returns the line at i in b, with its newline unless b ends first, and
+// the index after it.
 func readLine(b []byte, i int) (p []byte, j int) {
 	_ = b[len(b)-1]
 	for j = i; j < len(b); j++ {
 		if b[j] == '\n' {
+			j++
 			break
 		}
 	}
-	j++
 	p = b[i:j]
 	return
 }
@@ -837,6 +2172,7 @@ func readUint64(b []byte) uint64 {
 type byteOrder interface {
 	Uint16([]byte) uint16
 	Uint32([]byte) uint32
+	PutUint32([]byte, uint32)
 }
 
 var littleEndian littleOrder
@@ -853,6 +2189,14 @@ func (littleOrder) Uint32(b []byte) uint32 {
 	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 }
 
+func (littleOrder) PutUint32(b []byte, v uint32) {
+	_ = b[3]
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
+
 var bigEndian bigOrder
 
 type bigOrder struct{}
@@ -866,3 +2210,11 @@ func (bigOrder) Uint32(b []byte) uint32 {
 	_ = b[3]
 	return uint32(b[3]) | uint32(b[2])<<8 | uint32(b[1])<<16 | uint32(b[0])<<24
 }
+
+func (bigOrder) PutUint32(b []byte, v uint32) {
+	_ = b[3]
+	b[0] = byte(v >> 24)
+	b[1] = byte(v >> 16)
+	b[2] = byte(v >> 8)
+	b[3] = byte(v)
+}
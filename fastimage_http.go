@@ -1,11 +1,21 @@
 package fastimage
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -27,6 +37,30 @@ const (
 type HTTPImageInfo struct {
 	// URL is the original image URL.
 	URL string `json:"url"`
+	// ImageURL is the URL the image was actually read from when it differs from URL,
+	// for example the og:image target of an HTML page.
+	ImageURL string `json:"image_url,omitempty"`
+	// ContentEncoding is the Content-Encoding the image was served with, such as gzip,
+	// when the response body had to be decoded before detection. Image responses should
+	// never be encoded, so a non-empty value points at a misconfigured origin.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	// ContentLength is the size of the image file in bytes, from the total of a
+	// Content-Range header, the Content-Length of a full response or the end of the
+	// body, and 0 when the probe did not learn it, as for images served with a
+	// Content-Encoding.
+	ContentLength int64 `json:"content_length,omitempty"`
+	// FromCache reports that the result was served from GetHTTPImageOptions.Cache.
+	FromCache bool `json:"from_cache,omitempty"`
+	// ContentHash is the hex digest, computed with GetHTTPImageOptions.ContentHash,
+	// of the first HashedBytes bytes of the image, which are the bytes the probe
+	// downloaded. Two probes saw the same bytes when both their hashes and their
+	// HashedBytes match. Bodies served with a Content-Encoding are hashed decoded.
+	ContentHash string `json:"content_hash,omitempty"`
+	HashedBytes int64  `json:"hashed_bytes,omitempty"`
+	// HashedFullBody reports that the hashed bytes are the whole image, because the
+	// file was small enough or the server sent all of it anyway, so ContentHash
+	// detects any change to the file.
+	HashedFullBody bool `json:"hashed_full_body,omitempty"`
 	Info
 }
 
@@ -34,6 +68,23 @@ type HTTPImageInfo struct {
 type GetHTTPImageResult struct {
 	HTTPImageInfo
 	Error error `json:"error,omitempty"`
+	// Stats is the accounting of the requests made for the URL, whether the probe
+	// succeeded or not. It is zero for results served from the cache without a request.
+	Stats ProbeStats `json:"stats"`
+}
+
+// ProbeStats is the accounting of the requests made to probe one URL.
+type ProbeStats struct {
+	// Attempts is the number of times the probe was started, including retries.
+	Attempts int `json:"attempts"`
+	// Requests is the number of HTTP requests sent, including follow-up range
+	// requests, HTML page lookups and requests to mirrors.
+	Requests int `json:"requests"`
+	// BytesFetched is the number of response body bytes read across all requests.
+	BytesFetched int64 `json:"bytes_fetched"`
+	// Elapsed is the time from the start of the probe to its result, including time
+	// spent waiting for a connection slot.
+	Elapsed time.Duration `json:"elapsed"`
 }
 
 // GetHTTPImageOptions controls concurrency behavior for HTTP image probing.
@@ -44,11 +95,67 @@ type GetHTTPImageOptions struct {
 	ConcurrentRequestsNonReusable int
 	// MaxConcurrentConnections is the global limit across all origins.
 	MaxConcurrentConnections int
+	// FollowHTMLImages makes URLs that return an HTML page resolve to the page's
+	// og:image, twitter:image or <link rel="image_src"> target, which is probed instead.
+	// The robots.txt and pacing of the target's own origin apply to it.
+	FollowHTMLImages bool
+	// MultiRangeTail, when positive, makes the first request of each probe also ask
+	// for the last MultiRangeTail bytes of the file (bytes=0-1023,-N). Servers that
+	// support multipart/byteranges return both parts in a single response, which saves
+	// a round trip for files whose metadata sits at the end, such as TIFFs with a
+	// trailing IFD or ISO-BMFF files with the meta box after mdat.
+	MultiRangeTail int64
+	// Header holds extra headers sent with every request, such as User-Agent or an
+	// Authorization header a CDN requires. Range and conditional headers are set by
+	// the prober and override any given here.
+	Header http.Header
+	// Timeout, when positive, bounds each probe from the moment it gets a connection
+	// slot, including retries, follow-up range requests and HTML image lookups.
+	// Probes that run out of time report context.DeadlineExceeded.
+	Timeout time.Duration
+	// Retries is the number of times a probe is retried after a 429 or 503 response
+	// carrying Retry-After. Zero uses the default of one retry and a negative value
+	// disables retries.
+	Retries int
+	// Backoff, when positive, also retries probes that failed with a transport error
+	// or a 429, 500, 502, 503 or 504 response without Retry-After. The first retry
+	// waits Backoff and every further retry waits twice as long as the one before.
+	Backoff time.Duration
+	// RequestsPerSecondPerOrigin, when positive, spaces out the requests sent to each
+	// origin so that no more than this many start per second.
+	RequestsPerSecondPerOrigin float64
+	// RespectRobots makes the prober fetch the robots.txt of each origin once per
+	// batch and fail disallowed URLs with *RobotsDisallowedError without requesting
+	// them. The group for the User-Agent product token, or the * group, applies, and
+	// its Crawl-delay slows the origin down further. A robots.txt answered with a 5xx
+	// status disallows everything, and one that is missing or cannot be fetched
+	// allows everything.
+	RespectRobots bool
+	// RangeSizes is the ladder of prefix sizes, in bytes, requested when a format gives
+	// no hint about where its header continues. Zero or negative sizes are ignored and
+	// the default ladder of 1, 4, 16, 64 and 256 KB is used when none is left.
+	RangeSizes []int64
+	// Mirrors maps a URL to equivalent URLs of the same image, such as the same
+	// asset on another CDN. A mirror is probed when the URLs before it fail, and the
+	// result reports the mirror that answered in ImageURL.
+	Mirrors map[string][]string
+	// HedgeDelay, when positive, probes the next mirror of a URL once this long has
+	// passed without a result instead of waiting for a failure. The first successful
+	// probe wins and the others are cancelled.
+	HedgeDelay time.Duration
+	// Cache, when set, is consulted before probing a URL and updated with successful
+	// results. Stale entries with validators are revalidated with conditional requests.
+	Cache Cache
+	// ContentHash, when set, hashes the image bytes each successful probe downloaded
+	// into HTTPImageInfo.ContentHash, for cheap duplicate and change detection across
+	// crawls. sha256.New is a good default; a faster non-cryptographic hash such as
+	// xxhash fits too.
+	ContentHash func() hash.Hash
 }
 
 // GetHTTPImageInfo fetches basic image metadata for a list of URLs using default options.
 //
-// Errors:
+// Errors are reported as *ProbeError wrapping one of:
 //   - context.Canceled or context.DeadlineExceeded if the context ends.
 //   - *url.Error from url.Parse or for invalid URLs.
 //   - http.Client transport errors from http.Client.Do.
@@ -62,7 +169,7 @@ func GetHTTPImageInfo(ctx context.Context, urls []string) []GetHTTPImageResult {
 
 // GetHTTPImageDataWithOptions fetches basic image metadata for a list of URLs using custom options.
 //
-// Errors:
+// Errors are reported as *ProbeError wrapping one of:
 //   - context.Canceled or context.DeadlineExceeded if the context ends.
 //   - *url.Error from url.Parse or for invalid URLs.
 //   - http.Client transport errors from http.Client.Do.
@@ -70,23 +177,55 @@ func GetHTTPImageInfo(ctx context.Context, urls []string) []GetHTTPImageResult {
 //   - *HTTPStatusError for non-200/206 responses.
 //   - *RetryAfterError for 429/503 responses with parseable Retry-After.
 //   - *InsufficientBytesError when there is not enough data to detect image info.
+//   - *HTMLImageNotFoundError when FollowHTMLImages is set and a page has no image reference.
+//   - *HTMLImageNotImageError when FollowHTMLImages is set and a page's image reference is a page too.
+//   - *RobotsDisallowedError when RespectRobots is set and robots.txt disallows the URL.
 func GetHTTPImageDataWithOptions(ctx context.Context, urls []string, options GetHTTPImageOptions) []GetHTTPImageResult {
-	sizes := []int64{1024, 4096, 16384, 65536, 262144}
+	return StartHTTPImageBatch(ctx, urls, options).Wait()
+}
+
+// HTTPImageBatch is a batch of HTTP image probes running in the background.
+// Individual probes can be cancelled and the whole batch paused and resumed
+// without cancelling the batch context.
+type HTTPImageBatch struct {
+	results   []GetHTTPImageResult
+	cancels   []context.CancelFunc
+	gate      pauseGate
+	completed chan int
+	done      chan struct{}
+	options   GetHTTPImageOptions
+	global    chan struct{}
 
+	mu      sync.Mutex
+	origins []string // every origin of the batch, mirrors included, for Snapshot
+	workers map[string]*originWorker
+}
+
+// StartHTTPImageBatch starts probing urls in the background and returns immediately.
+// Results are indexed like urls and reported by Wait. Errors are the same as for
+// GetHTTPImageDataWithOptions; cancelled probes report context.Canceled.
+func StartHTTPImageBatch(ctx context.Context, urls []string, options GetHTTPImageOptions) *HTTPImageBatch {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
 	options = normalizeHTTPImageOptions(options)
 
-	results := make([]GetHTTPImageResult, len(urls))
-	if len(urls) == 0 {
-		return results
+	batch := &HTTPImageBatch{
+		results:   make([]GetHTTPImageResult, len(urls)),
+		cancels:   make([]context.CancelFunc, len(urls)),
+		completed: make(chan int, len(urls)),
+		done:      make(chan struct{}),
+		options:   options,
+		global:    make(chan struct{}, options.MaxConcurrentConnections),
+		workers:   make(map[string]*originWorker),
 	}
+	results := batch.results
 
 	type item struct {
 		index  int
 		rawURL string
+		ctx    context.Context
 	}
 
 	originGroups := make(map[string][]item)
@@ -94,72 +233,170 @@ func GetHTTPImageDataWithOptions(ctx context.Context, urls []string, options Get
 
 	for i, rawURL := range urls {
 		results[i].URL = rawURL
-		parsed, err := url.Parse(rawURL)
-		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
-			if err == nil {
-				err = &url.Error{Op: "parse", URL: rawURL, Err: fmt.Errorf("invalid URL")}
-			}
-			results[i].Error = err
+		origin, err := originOf(rawURL)
+		if err != nil {
+			results[i].Error = &ProbeError{URL: rawURL, Err: err}
+			batch.completed <- i
 			continue
 		}
-		host := normalizeOriginHost(parsed)
-		origin := parsed.Scheme + "://" + host
 		if _, ok := originGroups[origin]; !ok {
 			origins = append(origins, origin)
 		}
-		originGroups[origin] = append(originGroups[origin], item{index: i, rawURL: rawURL})
+		itemCtx, cancel := context.WithCancel(ctx)
+		batch.cancels[i] = cancel
+		originGroups[origin] = append(originGroups[origin], item{index: i, rawURL: rawURL, ctx: itemCtx})
 	}
 
 	sort.Strings(origins)
 
-	type originWorker struct {
-		client  *http.Client
-		limiter *originLimiter
-	}
-	originWorkers := make(map[string]originWorker, len(origins))
-	for _, origin := range origins {
-		transport := &http.Transport{
-			ForceAttemptHTTP2: true,
-			MaxConnsPerHost:   options.ConcurrentRequestsReusable,
-			Proxy:             http.ProxyFromEnvironment,
-		}
-		originWorkers[origin] = originWorker{
-			client:  &http.Client{Transport: transport},
-			limiter: newOriginLimiter(options.ConcurrentRequestsNonReusable, options.ConcurrentRequestsReusable),
+	// Mirrors may live on origins that none of the URLs use.
+	allOrigins := origins
+	for _, rawURL := range urls {
+		for _, mirror := range options.Mirrors[rawURL] {
+			origin, err := originOf(mirror)
+			if err != nil || slices.Contains(allOrigins, origin) {
+				continue
+			}
+			allOrigins = append(allOrigins, origin)
 		}
 	}
 
-	globalLimiter := make(chan struct{}, options.MaxConcurrentConnections)
+	for _, origin := range allOrigins {
+		batch.worker(origin)
+	}
+
+	workerFor := batch.worker
 	var wg sync.WaitGroup
 
 	for _, origin := range origins {
-		worker := originWorkers[origin]
+		worker := batch.worker(origin)
 		for _, it := range originGroups[origin] {
-			if results[it.index].Error != nil {
-				continue
-			}
 			wg.Add(1)
-			go func(it item, worker originWorker) {
+			go func(it item, worker *originWorker) {
 				defer wg.Done()
-				info, err := fetchImageInfo(ctx, worker.client, it.rawURL, globalLimiter, worker.limiter, sizes)
-				if err != nil {
-					results[it.index].Error = err
-					return
-				}
-				results[it.index].HTTPImageInfo = HTTPImageInfo{
-					URL:  it.rawURL,
-					Info: info,
-				}
+				defer batch.cancels[it.index]()
+				defer func() { batch.completed <- it.index }()
+				results[it.index] = probeURL(it.ctx, it.rawURL, worker, workerFor, options)
 			}(it, worker)
 		}
 	}
-	wg.Wait()
 
-	for _, worker := range originWorkers {
-		worker.client.CloseIdleConnections()
+	go func() {
+		wg.Wait()
+		batch.mu.Lock()
+		for _, worker := range batch.workers {
+			worker.client.CloseIdleConnections()
+		}
+		batch.mu.Unlock()
+		close(batch.completed)
+		close(batch.done)
+	}()
+
+	return batch
+}
+
+// worker returns the worker of origin, creating it for origins first seen during the
+// batch, such as those of HTML image targets.
+func (b *HTTPImageBatch) worker(origin string) *originWorker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if w, ok := b.workers[origin]; ok {
+		return w
+	}
+	w := newOriginWorker(b.options, b.global, &b.gate)
+	w.workerFor = b.worker
+	b.workers[origin] = w
+	b.origins = append(b.origins, origin)
+	return w
+}
+
+// Cancel cancels the probe of the URL at index. It is a no-op for finished probes
+// and out-of-range indexes.
+func (b *HTTPImageBatch) Cancel(index int) {
+	if index < 0 || index >= len(b.cancels) || b.cancels[index] == nil {
+		return
 	}
+	b.cancels[index]()
+}
+
+// Pause stops the batch from issuing new requests until Resume is called.
+// Requests already in flight are allowed to complete.
+func (b *HTTPImageBatch) Pause() {
+	b.gate.pause()
+}
+
+// Resume lets a paused batch continue issuing requests.
+func (b *HTTPImageBatch) Resume() {
+	b.gate.resume()
+}
+
+// Done returns a channel that is closed when every probe of the batch has finished.
+func (b *HTTPImageBatch) Done() <-chan struct{} {
+	return b.done
+}
 
-	return results
+// Completed returns a channel that receives the index of each probe as it finishes,
+// so that its result can be read with Result before the batch is done. The channel
+// is closed once every probe has finished.
+func (b *HTTPImageBatch) Completed() <-chan int {
+	return b.completed
+}
+
+// Result returns the result of the probe at index. It must only be called for
+// indexes received from Completed, or after Done is closed.
+func (b *HTTPImageBatch) Result(index int) GetHTTPImageResult {
+	return b.results[index]
+}
+
+// Wait blocks until every probe has finished and returns the results, indexed like
+// the URLs the batch was started with.
+func (b *HTTPImageBatch) Wait() []GetHTTPImageResult {
+	<-b.done
+	return b.results
+}
+
+// pauseGate blocks callers of wait while paused.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused chan struct{}
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == nil {
+		g.paused = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused != nil {
+		close(g.paused)
+		g.paused = nil
+	}
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused != nil
+}
+
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	paused := g.paused
+	g.mu.Unlock()
+	if paused == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-paused:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func normalizeHTTPImageOptions(options GetHTTPImageOptions) GetHTTPImageOptions {
@@ -175,6 +412,20 @@ func normalizeHTTPImageOptions(options GetHTTPImageOptions) GetHTTPImageOptions
 	if options.ConcurrentRequestsReusable < options.ConcurrentRequestsNonReusable {
 		options.ConcurrentRequestsReusable = options.ConcurrentRequestsNonReusable
 	}
+	if options.Retries == 0 {
+		options.Retries = 1
+	}
+	var sizes []int64
+	for _, size := range options.RangeSizes {
+		if size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	if len(sizes) == 0 {
+		sizes = []int64{1024, 4096, 16384, 65536, 262144}
+	}
+	slices.Sort(sizes)
+	options.RangeSizes = slices.Compact(sizes)
 	return options
 }
 
@@ -191,155 +442,727 @@ func release(limiter chan struct{}) {
 	<-limiter
 }
 
-func fetchImageInfo(
-	ctx context.Context,
-	client *http.Client,
-	rawURL string,
-	globalLimiter chan struct{},
-	originLimiter *originLimiter,
-	sizes []int64,
-) (Info, error) {
-	var info Info
-	if err := acquire(ctx, globalLimiter); err != nil {
-		return info, err
+// probeURL probes rawURL on worker, the worker of its origin, or tries it and its
+// mirrors on the workers workerFor returns when it has any.
+func probeURL(ctx context.Context, rawURL string, worker *originWorker, workerFor func(origin string) *originWorker, options GetHTTPImageOptions) GetHTTPImageResult {
+	var stats probeStats
+	var info HTTPImageInfo
+	var err error
+	started := time.Now()
+	if mirrors := options.Mirrors[rawURL]; len(mirrors) > 0 {
+		candidates := append([]string{rawURL}, mirrors...)
+		info, err = fetchFirst(ctx, candidates, workerFor, options.HedgeDelay, &stats)
+	} else {
+		info, err = worker.fetchImageInfo(ctx, rawURL, &stats)
+	}
+	result := GetHTTPImageResult{
+		HTTPImageInfo: HTTPImageInfo{URL: rawURL},
+		Stats: ProbeStats{
+			Attempts:     stats.attempts,
+			Requests:     stats.requests,
+			BytesFetched: stats.bytes,
+			Elapsed:      time.Since(started),
+		},
+	}
+	if err != nil {
+		result.Error = stats.wrap(rawURL, err)
+		return result
+	}
+	result.HTTPImageInfo = info
+	return result
+}
+
+// newOriginWorker returns a worker for one origin that shares the global limiter
+// and the pause gate of its batch.
+func newOriginWorker(options GetHTTPImageOptions, global chan struct{}, gate *pauseGate) *originWorker {
+	transport := &http.Transport{
+		ForceAttemptHTTP2: true,
+		MaxConnsPerHost:   options.ConcurrentRequestsReusable,
+		IdleConnTimeout:   90 * time.Second,
+		Proxy:             http.ProxyFromEnvironment,
+	}
+	return &originWorker{
+		client:  &http.Client{Transport: transport},
+		limiter: newOriginLimiter(options.ConcurrentRequestsNonReusable, options.ConcurrentRequestsReusable),
+		global:  global,
+		gate:    gate,
+		pacer:   newOriginPacer(options.RequestsPerSecondPerOrigin),
+		robots:  &robotsCache{},
+		health:  &originHealth{},
+		sizes:   options.RangeSizes,
+		options: options,
+	}
+}
+
+// originWorker probes the URLs of a single origin.
+type originWorker struct {
+	client  *http.Client
+	limiter *originLimiter
+	global  chan struct{}
+	gate    *pauseGate
+	pacer   *originPacer
+	robots  *robotsCache
+	health  *originHealth
+	sizes   []int64
+	options GetHTTPImageOptions
+
+	// workerFor returns the worker of another origin of the run, or nil when the
+	// worker runs alone.
+	workerFor func(origin string) *originWorker
+
+	waiting atomic.Int32 // probes waiting for a connection slot
+	active  atomic.Int32 // probes in fetchImageInfo
+}
+
+// fetchResult is the outcome of a single ranged request.
+type fetchResult struct {
+	info         Info
+	retryAfter   time.Duration
+	needMore     bool
+	readBytes    int
+	html         bool
+	notModified  bool
+	data         []byte
+	size         int64 // size of the file, or -1 when unknown
+	etag         string
+	lastModified string
+	encoding     string
+	expires      time.Time // from Cache-Control or Expires, zero when absent
+	store        bool      // false for Cache-Control: no-store
+}
+
+// probeStats accumulates the accounting of all requests made for one URL.
+type probeStats struct {
+	attempts   int
+	requests   int
+	bytes      int64
+	statusCode int
+}
+
+func (s *probeStats) record(resp *http.Response) {
+	s.statusCode = resp.StatusCode
+}
+
+// wrap returns err as a *ProbeError carrying the accounting for rawURL.
+func (s *probeStats) wrap(rawURL string, err error) error {
+	return &ProbeError{
+		URL:          rawURL,
+		Attempts:     s.attempts,
+		BytesFetched: s.bytes,
+		StatusCode:   s.statusCode,
+		Err:          err,
 	}
-	releaseOrigin, err := originLimiter.acquire(ctx)
+}
+
+func (w *originWorker) fetchImageInfo(ctx context.Context, rawURL string, stats *probeStats) (HTTPImageInfo, error) {
+	w.active.Add(1)
+	defer w.active.Add(-1)
+	result := HTTPImageInfo{URL: rawURL}
+
+	var cached *CacheEntry
+	if w.options.Cache != nil {
+		if entry, ok := w.options.Cache.Get(rawURL); ok && entry != nil {
+			if entry.fresh(time.Now()) {
+				result := entry.httpImageInfo(rawURL)
+				w.hash(&result, entry.Prefix, entry.prefixSize())
+				return result, nil
+			}
+			if entry.ImageURL == "" && (entry.ETag != "" || entry.LastModified != "") {
+				cached = entry
+			}
+		}
+	}
+
+	if err := w.gate.wait(ctx); err != nil {
+		return result, err
+	}
+	w.waiting.Add(1)
+	if err := acquire(ctx, w.global); err != nil {
+		w.waiting.Add(-1)
+		return result, err
+	}
+	releaseOrigin, err := w.limiter.acquire(ctx)
+	w.waiting.Add(-1)
 	if err != nil {
-		release(globalLimiter)
-		return info, err
+		release(w.global)
+		return result, err
 	}
 	defer releaseOrigin()
-	defer release(globalLimiter)
+	defer release(w.global)
 
-	return fetchImageInfoWithRetry(ctx, client, rawURL, sizes, originLimiter)
+	info, err := w.fetchAcquired(ctx, rawURL, cached, stats)
+	w.health.record(err)
+	return info, err
 }
 
-func fetchImageInfoWithRetry(
-	ctx context.Context,
-	client *http.Client,
-	rawURL string,
-	sizes []int64,
-	originLimiter *originLimiter,
-) (Info, error) {
-	var info Info
+// fetchAcquired probes rawURL once fetchImageInfo holds the connection slots.
+func (w *originWorker) fetchAcquired(ctx context.Context, rawURL string, cached *CacheEntry, stats *probeStats) (HTTPImageInfo, error) {
+	result := HTTPImageInfo{URL: rawURL}
+
+	if w.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.options.Timeout)
+		defer cancel()
+	}
+
+	if err := w.checkRobots(ctx, rawURL); err != nil {
+		return result, err
+	}
+
+	res, err := w.fetchImageInfoWithRetry(ctx, rawURL, cached, stats)
+	if err != nil {
+		result.Info = res.info
+		return result, err
+	}
+	if res.notModified {
+		entry := *cached
+		entry.StoredAt = time.Now()
+		entry.Expires = res.expires
+		if res.store {
+			w.options.Cache.Put(rawURL, &entry)
+		}
+		result := entry.httpImageInfo(rawURL)
+		w.hash(&result, entry.Prefix, entry.prefixSize())
+		return result, nil
+	}
+
+	if res.html {
+		imageURL, err := w.fetchHTMLImageURL(ctx, rawURL, stats)
+		if err != nil {
+			return result, err
+		}
+		// The image is fetched like any URL of its origin, robots.txt included, on
+		// the slots the page already holds.
+		target := w.workerOf(imageURL)
+		result.ImageURL = imageURL
+		if err := target.checkRobots(ctx, imageURL); err != nil {
+			return result, err
+		}
+		res, err = target.fetchImageInfoWithRetry(ctx, imageURL, nil, stats)
+		if err != nil {
+			result.Info = res.info
+			return result, err
+		}
+		if res.html {
+			return result, &HTMLImageNotImageError{URL: rawURL, ImageURL: imageURL}
+		}
+	}
+
+	result.Info = res.info
+	result.ContentEncoding = res.encoding
+	result.ContentLength = max(res.size, 0)
+	w.hash(&result, res.data, res.size)
+	if w.options.Cache != nil && res.store {
+		w.options.Cache.Put(rawURL, &CacheEntry{
+			Info:            result.Info,
+			ImageURL:        result.ImageURL,
+			ContentEncoding: result.ContentEncoding,
+			ContentLength:   result.ContentLength,
+			ETag:            res.etag,
+			LastModified:    res.lastModified,
+			Prefix:          res.data,
+			FullBody:        res.size == int64(len(res.data)),
+			StoredAt:        time.Now(),
+			Expires:         res.expires,
+		})
+	}
+	return result, nil
+}
+
+// workerOf returns the worker of the origin of rawURL, or w when it has none.
+func (w *originWorker) workerOf(rawURL string) *originWorker {
+	if w.workerFor == nil {
+		return w
+	}
+	origin, err := originOf(rawURL)
+	if err != nil {
+		return w
+	}
+	if target := w.workerFor(origin); target != nil {
+		return target
+	}
+	return w
+}
+
+// hash sets the content hash of result to that of data, the leading bytes of a file
+// of size bytes, or of unknown size when size is negative.
+func (w *originWorker) hash(result *HTTPImageInfo, data []byte, size int64) {
+	if w.options.ContentHash == nil || len(data) == 0 {
+		return
+	}
+	h := w.options.ContentHash()
+	h.Write(data)
+	result.ContentHash = hex.EncodeToString(h.Sum(nil))
+	result.HashedBytes = int64(len(data))
+	result.HashedFullBody = size == int64(len(data))
+}
+
+func (w *originWorker) fetchImageInfoWithRetry(ctx context.Context, rawURL string, cached *CacheEntry, stats *probeStats) (fetchResult, error) {
+	var res fetchResult
 	var lastErr error
-	for attempt := 0; attempt < 2; attempt++ {
-		var retryAfter time.Duration
-		info, retryAfter, lastErr = fetchImageInfoProgressive(ctx, client, rawURL, sizes, originLimiter)
+	retries := max(w.options.Retries, 0)
+	for attempt := 0; attempt <= retries; attempt++ {
+		stats.attempts++
+		res, lastErr = w.fetchImageInfoProgressive(ctx, rawURL, cached, stats)
 		if lastErr == nil {
-			return info, nil
+			return res, nil
 		}
-		if retryAfter <= 0 || attempt == 1 {
+		if attempt == retries {
 			break
 		}
-		if err := sleepWithContext(ctx, retryAfter); err != nil {
-			return info, err
+		wait := res.retryAfter
+		if wait <= 0 {
+			if w.options.Backoff <= 0 || !retryable(ctx, lastErr) {
+				break
+			}
+			wait = w.options.Backoff << min(attempt, 16)
+		}
+		if err := sleepWithContext(ctx, wait); err != nil {
+			return res, err
 		}
 	}
-	return info, lastErr
+	return res, lastErr
 }
 
-func fetchImageInfoProgressive(
-	ctx context.Context,
-	client *http.Client,
-	rawURL string,
-	sizes []int64,
-	originLimiter *originLimiter,
-) (Info, time.Duration, error) {
-	var info Info
-	var lastErr error
-	lastRead := 0
+// retryable reports whether a probe that failed with err is worth retrying after a
+// backoff: transport errors and statuses that signal a temporary server problem.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Op != "parse"
+}
 
-	for _, size := range sizes {
-		if size < 80 {
-			continue
+// maxFetchRounds bounds the number of requests made to probe a single URL.
+const maxFetchRounds = 10
+
+// probeState accumulates what has been downloaded while probing a single URL.
+type probeState struct {
+	file      sparseFile
+	raw       []byte // undecoded prefix when the body has a Content-Encoding
+	encoding  string
+	readBytes int
+	rangeless bool // the server answered a range request with the full body
+	stats     *probeStats
+}
+
+// fetchImageInfoProgressive downloads the parts of rawURL that detection needs:
+// a short prefix first, then the regions the format points at, and otherwise
+// longer prefixes following w.sizes.
+func (w *originWorker) fetchImageInfoProgressive(ctx context.Context, rawURL string, cached *CacheEntry, stats *probeStats) (fetchResult, error) {
+	st := &probeState{file: sparseFile{size: -1}, stats: stats}
+	var res fetchResult
+	start, end := int64(0), w.sizes[0]-1
+
+	for round := 0; round < maxFetchRounds; round++ {
+		var err error
+		var tail int64
+		if round == 0 {
+			tail = w.options.MultiRangeTail
 		}
-		var retryAfter time.Duration
-		var needMore bool
-		var readBytes int
-		info, retryAfter, lastErr, needMore, readBytes = fetchImageInfoOnce(ctx, client, rawURL, size, originLimiter)
-		if readBytes > 0 {
-			lastRead = readBytes
+		res, err = w.fetchImageInfoOnce(ctx, rawURL, st, start, end, tail, cached)
+		cached = nil
+		if err != nil || res.retryAfter > 0 || res.notModified || res.html || !res.needMore {
+			return res, err
 		}
-		if retryAfter > 0 {
-			return info, retryAfter, lastErr
+		var ok bool
+		if start, end, ok = w.nextRange(st); !ok {
+			break
 		}
-		if lastErr != nil {
-			return info, 0, lastErr
+	}
+
+	// We tried all sizes but still couldn't detect enough header/dimensions.
+	// Treat as insufficient bytes for detection.
+	return res, &InsufficientBytesError{URL: rawURL, Got: st.readBytes, Min: 80}
+}
+
+// nextRange returns the next byte range to request, or ok=false when there is
+// nothing left worth downloading.
+func (w *originWorker) nextRange(st *probeState) (start, end int64, ok bool) {
+	if st.rangeless {
+		return 0, 0, false
+	}
+
+	have := int64(len(st.file.prefix()))
+	if st.encoding != "" {
+		// Ranges address the encoded body, so only the prefix can grow.
+		have = int64(len(st.raw))
+	} else if off, n, ok := st.file.need(); ok && n > 0 {
+		return off, off + n - 1, true
+	}
+
+	if st.file.size >= 0 && have >= st.file.size {
+		return 0, 0, false
+	}
+	for _, size := range w.sizes {
+		if size <= have {
+			continue
 		}
-		if !needMore {
-			return info, 0, nil
+		end = size - 1
+		if st.file.size >= 0 && end >= st.file.size {
+			end = st.file.size - 1
 		}
+		return have, end, true
 	}
+	return 0, 0, false
+}
 
-	if lastErr == nil {
-		// We tried all sizes but still couldn't detect enough header/dimensions.
-		// Treat as insufficient bytes for detection.
-		lastErr = &InsufficientBytesError{Got: lastRead, Min: 80}
+// newRequest returns a GET request for rawURL carrying the configured headers.
+func (w *originWorker) newRequest(ctx context.Context, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range w.options.Header {
+		req.Header[name] = slices.Clone(values)
+	}
+	if host := w.options.Header.Get("Host"); host != "" {
+		req.Host = host
 	}
-	return info, 0, lastErr
+	return req, nil
 }
 
-func fetchImageInfoOnce(
-	ctx context.Context,
-	client *http.Client,
-	rawURL string,
-	minBytes int64,
-	originLimiter *originLimiter,
-) (Info, time.Duration, error, bool, int) {
-	var info Info
+// fetchImageInfoOnce requests bytes start-end of rawURL, plus its last tail bytes
+// when tail is positive, and adds them to st. When cached is not nil the request is
+// made conditional on the cached validators.
+func (w *originWorker) fetchImageInfoOnce(ctx context.Context, rawURL string, st *probeState, start, end, tail int64, cached *CacheEntry) (fetchResult, error) {
+	var res fetchResult
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err := w.gate.wait(ctx); err != nil {
+		return res, err
+	}
+	req, err := w.newRequest(ctx, rawURL)
 	if err != nil {
-		return info, 0, err, false, 0
+		return res, err
+	}
+	if tail > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d,-%d", start, end, tail))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
 	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", minBytes-1))
 
-	resp, err := client.Do(req)
+	if err := w.pacer.wait(ctx); err != nil {
+		return res, err
+	}
+	st.stats.requests++
+	resp, err := w.client.Do(req)
 	if err != nil {
-		return info, 0, err, false, 0
+		return res, err
 	}
 	defer resp.Body.Close()
+	st.stats.record(resp)
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		res.notModified = true
+		res.expires, res.store = cachePolicy(resp.Header, time.Now())
+		return res, nil
+	}
 
 	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
 		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
-			return info, retryAfter, &RetryAfterError{
+			res.retryAfter = retryAfter
+			return res, &RetryAfterError{
 				URL:        rawURL,
 				StatusCode: resp.StatusCode,
 				Status:     resp.Status,
 				RetryAfter: retryAfter,
-			}, false, 0
+			}
 		}
 	}
 
 	if resp.StatusCode == http.StatusPartialContent {
-		originLimiter.enableReusable()
+		w.limiter.enableReusable()
+	}
+
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && start > 0 {
+		// The range starts past the end of the file.
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total >= 0 {
+			st.file.size = total
+		} else {
+			st.file.size = start
+		}
+		return w.probeResult(st, resp), nil
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-		return info, 0, &HTTPStatusError{
+		return res, &HTTPStatusError{
 			URL:        rawURL,
 			StatusCode: resp.StatusCode,
 			Status:     resp.Status,
-		}, false, 0
+		}
+	}
+
+	if start == 0 && w.options.FollowHTMLImages && isHTMLContentType(resp.Header.Get("Content-Type")) {
+		res.html = true
+		return res, nil
 	}
 
-	data, err := io.ReadAll(io.LimitReader(resp.Body, minBytes))
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "identity" {
+		encoding = ""
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && mediaType == "multipart/byteranges":
+		parts := multipart.NewReader(resp.Body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return res, err
+			}
+			off, total, ok := parseContentRange(part.Header.Get("Content-Range"))
+			if !ok {
+				continue
+			}
+			if total >= 0 {
+				st.file.size = total
+			}
+			data, err := io.ReadAll(io.LimitReader(part, end-start+1+tail))
+			if err != nil {
+				return res, err
+			}
+			st.readBytes += len(data)
+			st.stats.bytes += int64(len(data))
+			st.add(off, data, encoding)
+		}
+	case resp.StatusCode == http.StatusPartialContent:
+		off, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok {
+			off = start
+		}
+		if total >= 0 {
+			st.file.size = total
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, end-start+1+tail))
+		if err != nil {
+			return res, err
+		}
+		st.readBytes += len(data)
+		st.stats.bytes += int64(len(data))
+		st.add(off, data, encoding)
+	default:
+		// The server ignored the range and sends the whole body: keep reading it
+		// following w.sizes until detection succeeds.
+		st.rangeless = true
+		if resp.ContentLength >= 0 && encoding == "" {
+			st.file.size = resp.ContentLength
+		}
+		limits := w.sizes
+		for len(limits) > 1 && limits[0] < end+1 {
+			limits = limits[1:]
+		}
+		var data []byte
+		for _, size := range limits {
+			chunk, err := io.ReadAll(io.LimitReader(resp.Body, size-int64(len(data))))
+			if err != nil {
+				return res, err
+			}
+			data = append(data, chunk...)
+			st.readBytes += len(chunk)
+			st.stats.bytes += int64(len(chunk))
+			st.add(0, data, encoding)
+			if int64(len(data)) < size {
+				if encoding == "" {
+					st.file.size = int64(len(data))
+				}
+				break
+			}
+			if !w.probeResult(st, resp).needMore {
+				break
+			}
+		}
+	}
+
+	if p := st.file.prefix(); start == 0 && len(p) < 80 {
+		return res, &InsufficientBytesError{URL: rawURL, Got: len(p), Min: 80}
+	}
+
+	return w.probeResult(st, resp), nil
+}
+
+// add stores data read at off, decoding the prefix when the body has a Content-Encoding.
+func (st *probeState) add(off int64, data []byte, encoding string) {
+	if encoding == "" {
+		st.file.add(off, data)
+		return
+	}
+	switch off {
+	case 0:
+		st.raw = data
+	case int64(len(st.raw)):
+		st.raw = append(st.raw, data...)
+	default:
+		return
+	}
+	if decoded, ok := decodeContentPrefix(encoding, st.raw); ok {
+		st.encoding = encoding
+		st.file = sparseFile{size: -1}
+		st.file.add(0, decoded)
+	}
+}
+
+func (w *originWorker) probeResult(st *probeState, resp *http.Response) fetchResult {
+	res := fetchResult{
+		info:         GetInfo(st.file.bytes()),
+		readBytes:    st.readBytes,
+		data:         st.file.prefix(),
+		size:         st.file.size,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		encoding:     st.encoding,
+	}
+	res.expires, res.store = cachePolicy(resp.Header, time.Now())
+	if res.info.Type == Unknown || res.info.Width == 0 || res.info.Height == 0 {
+		res.needMore = true
+	}
+	return res
+}
+
+// parseContentRange parses a "bytes start-end/total" Content-Range value. total is
+// -1 when the server does not know the size, and start is 0 for unsatisfied ranges.
+func parseContentRange(value string) (start, total int64, ok bool) {
+	value, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	span, size, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+	total = -1
+	if size != "*" {
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		total = n
+	}
+	if span == "*" {
+		return 0, total, true
+	}
+	first, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// fetchHTMLImageURL downloads the head of an HTML page and returns the absolute
+// URL of the image it references.
+func (w *originWorker) fetchHTMLImageURL(ctx context.Context, pageURL string, stats *probeStats) (string, error) {
+	base, err := url.Parse(pageURL)
 	if err != nil {
-		return info, 0, err, false, 0
+		return "", err
 	}
+	if err := w.gate.wait(ctx); err != nil {
+		return "", err
+	}
+
+	req, err := w.newRequest(ctx, pageURL)
+	if err != nil {
+		return "", err
+	}
+	if err := w.pacer.wait(ctx); err != nil {
+		return "", err
+	}
+	stats.requests++
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	stats.record(resp)
 
-	readBytes := len(data)
-	if readBytes < 80 {
-		return info, 0, &InsufficientBytesError{Got: readBytes, Min: 80}, false, readBytes
+	if resp.StatusCode != http.StatusOK {
+		return "", &HTTPStatusError{
+			URL:        pageURL,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	ref, err := findHTMLImage(&countingReader{r: io.LimitReader(resp.Body, maxHTMLBytes), n: &stats.bytes})
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return "", &HTMLImageNotFoundError{URL: pageURL}
 	}
+	target, err := base.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", &url.Error{Op: "parse", URL: target.String(), Err: fmt.Errorf("invalid URL")}
+	}
+	return target.String(), nil
+}
 
-	info = GetInfo(data)
-	if info.Type == Unknown || info.Width == 0 || info.Height == 0 {
-		return info, 0, nil, true, readBytes
+// decodeContentPrefix decodes data, a possibly truncated prefix of a body with the
+// given Content-Encoding. It returns whatever could be decoded before the data ran out.
+func decodeContentPrefix(encoding string, data []byte) ([]byte, bool) {
+	var r io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, false
+		}
+		r = zr
+	case "deflate":
+		// Servers send both zlib-wrapped and raw deflate streams as "deflate".
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			r = flate.NewReader(bytes.NewReader(data))
+		} else {
+			r = zr
+		}
+	default:
+		return nil, false
 	}
+	decoded, err := io.ReadAll(r)
+	if len(decoded) == 0 && err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
 
-	return info, 0, nil, false, readBytes
+// countingReader adds the number of bytes read from r to n.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
 }
 
 func parseRetryAfter(value string) (time.Duration, bool) {
@@ -374,6 +1197,18 @@ func sleepWithContext(ctx context.Context, d time.Duration) error {
 	}
 }
 
+// originOf returns the scheme and normalized host that URLs are grouped by.
+func originOf(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return "", &url.Error{Op: "parse", URL: rawURL, Err: fmt.Errorf("invalid URL")}
+	}
+	return parsed.Scheme + "://" + normalizeOriginHost(parsed), nil
+}
+
 func normalizeOriginHost(u *url.URL) string {
 	if u == nil {
 		return ""
@@ -391,6 +1226,56 @@ func normalizeOriginHost(u *url.URL) string {
 	return host
 }
 
+// originPacer spaces out the requests sent to one origin. With a zero interval it
+// lets every request through.
+type originPacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newOriginPacer(perSecond float64) *originPacer {
+	p := &originPacer{}
+	if perSecond > 0 {
+		p.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return p
+}
+
+// atLeast raises the interval between requests to d.
+func (p *originPacer) atLeast(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.interval = max(p.interval, d)
+}
+
+// currentInterval returns the interval between requests.
+func (p *originPacer) currentInterval() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.interval
+}
+
+// wait blocks until the next request may start.
+func (p *originPacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	if p.interval <= 0 {
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+	if !at.After(now) {
+		return ctx.Err()
+	}
+	return sleepWithContext(ctx, at.Sub(now))
+}
+
 type originLimiter struct {
 	base           chan struct{}
 	extra          chan struct{}
@@ -1,14 +1,25 @@
 package fastimage
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func httpImageTestCases() []httpImageTestCase {
@@ -35,6 +46,7 @@ func httpImageTestCases() []httpImageTestCase {
 		{Path: "/bridge.avif", File: "testdata/bridge.avif", Info: Info{AVIF, 1000, 666}},
 		{Path: "/cow.avif", File: "testdata/cow.avif", Info: Info{AVIF, 500, 300}},
 		{Path: "/parrot.avif", File: "testdata/parrot.avif", Info: Info{AVIF, 1000, 667}},
+		{Path: "/grid.heic", File: "testdata/grid.heic", Info: Info{HEIC, 1024, 768}},
 	}
 }
 
@@ -94,6 +106,661 @@ func TestGetHTTPImageDataWithoutRangeServer(t *testing.T) {
 	}
 }
 
+func TestGetHTTPImageDataFollowsHTMLImage(t *testing.T) {
+	images := newTestImageServer(t, true)
+	defer images.Close()
+
+	pages := map[string]string{
+		"/og.html":      `<html><head><meta property="og:image" content="/letter_T.jpg"><meta name="twitter:image" content="/test.gif"></head></html>`,
+		"/twitter.html": `<!doctype html><head><!-- <meta property="og:image" content="/x.png"> --><meta name="twitter:image" content="/test.gif"></head>`,
+		"/link.html":    `<head><link rel="shortcut image_src" href="` + images.URL + `/pass-1_s.png"></head>`,
+		"/none.html":    `<head><title>nothing</title></head><body><meta property="og:image" content="/test.gif"></body>`,
+		"/page.html":    `<head><meta property="og:image" content="/og.html"></head>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if page, ok := pages[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(page))
+			return
+		}
+		http.Redirect(w, r, images.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/og.html", server.URL + "/twitter.html", server.URL + "/link.html", server.URL + "/none.html", server.URL + "/page.html"}
+	results := GetHTTPImageDataWithOptions(context.Background(), urls, GetHTTPImageOptions{FollowHTMLImages: true})
+
+	expected := []struct {
+		ImageURL string
+		Info     Info
+	}{
+		{server.URL + "/letter_T.jpg", Info{JPEG, 52, 54}},
+		{server.URL + "/test.gif", Info{GIF, 60, 40}},
+		{images.URL + "/pass-1_s.png", Info{PNG, 90, 60}},
+	}
+	for i, want := range expected {
+		if results[i].Error != nil {
+			t.Fatalf("unexpected error for %s: %v", urls[i], results[i].Error)
+		}
+		if results[i].ImageURL != want.ImageURL || results[i].Info != want.Info {
+			t.Fatalf("unexpected result for %s: got %s %+v want %s %+v", urls[i], results[i].ImageURL, results[i].Info, want.ImageURL, want.Info)
+		}
+	}
+	var notFound *HTMLImageNotFoundError
+	if !errors.As(results[3].Error, &notFound) {
+		t.Fatalf("expected HTMLImageNotFoundError for %s, got %v", urls[3], results[3].Error)
+	}
+	var notImage *HTMLImageNotImageError
+	if !errors.As(results[4].Error, &notImage) || notImage.ImageURL != urls[0] {
+		t.Fatalf("expected HTMLImageNotImageError for %s, got %v", urls[4], results[4].Error)
+	}
+}
+
+func TestHTTPImageBatchCancel(t *testing.T) {
+	images := newTestImageServer(t, true)
+	defer images.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/slow.jpg", images.URL + "/letter_T.jpg"}
+	batch := StartHTTPImageBatch(context.Background(), urls, GetHTTPImageOptions{})
+	batch.Cancel(0)
+	results := batch.Wait()
+
+	if !errors.Is(results[0].Error, context.Canceled) {
+		t.Fatalf("expected context.Canceled for %s, got %v", urls[0], results[0].Error)
+	}
+	if results[1].Error != nil || results[1].Info != (Info{JPEG, 52, 54}) {
+		t.Fatalf("unexpected result for %s: %+v err=%v", urls[1], results[1].Info, results[1].Error)
+	}
+}
+
+func TestHTTPImageBatchCompleted(t *testing.T) {
+	images := newTestImageServer(t, true)
+	defer images.Close()
+
+	urls := []string{images.URL + "/letter_T.jpg", "not a url", images.URL + "/test.gif"}
+	batch := StartHTTPImageBatch(context.Background(), urls, GetHTTPImageOptions{})
+	seen := make(map[int]bool)
+	for index := range batch.Completed() {
+		if seen[index] {
+			t.Fatalf("index %d completed twice", index)
+		}
+		seen[index] = true
+		if result := batch.Result(index); result.URL != urls[index] {
+			t.Fatalf("unexpected result for index %d: %+v", index, result)
+		}
+	}
+	if len(seen) != len(urls) {
+		t.Fatalf("unexpected completions: %v", seen)
+	}
+	if results := batch.Wait(); results[2].Info != (Info{GIF, 60, 40}) {
+		t.Fatalf("unexpected result: %+v", results[2].Info)
+	}
+}
+
+func TestHTTPImageBatchPauseResume(t *testing.T) {
+	images := newTestImageServer(t, true)
+	defer images.Close()
+
+	var requests atomic.Int32
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		once.Do(func() {
+			close(entered)
+			<-unblock
+		})
+		http.Redirect(w, r, images.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/letter_T.jpg", server.URL + "/test.gif"}
+	batch := StartHTTPImageBatch(context.Background(), urls, GetHTTPImageOptions{MaxConcurrentConnections: 1})
+
+	<-entered
+	batch.Pause()
+	close(unblock)
+
+	time.Sleep(50 * time.Millisecond)
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("paused batch issued requests: got %d want 1", got)
+	}
+	select {
+	case <-batch.Done():
+		t.Fatalf("paused batch finished")
+	default:
+	}
+
+	batch.Resume()
+	for i, result := range batch.Wait() {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", urls[i], result.Error)
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("unexpected request count: got %d want 2", got)
+	}
+}
+
+func TestGetHTTPImageDataMirrors(t *testing.T) {
+	images := newTestImageServer(t, true)
+	defer images.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+
+	missing := images.URL + "/missing.jpg"
+	hung := slow.URL + "/letter_T.jpg"
+	mirror := images.URL + "/letter_T.jpg"
+	options := GetHTTPImageOptions{
+		Mirrors: map[string][]string{
+			missing: {"not a url", mirror},
+			hung:    {mirror},
+		},
+		HedgeDelay: 50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := GetHTTPImageDataWithOptions(ctx, []string{missing, hung}, options)
+	for _, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", result.URL, result.Error)
+		}
+		if result.Info != (Info{JPEG, 52, 54}) || result.ImageURL != mirror {
+			t.Fatalf("unexpected result for %s: %+v", result.URL, result.HTTPImageInfo)
+		}
+	}
+
+	results = GetHTTPImageDataWithOptions(ctx, []string{missing}, GetHTTPImageOptions{
+		Mirrors: map[string][]string{missing: {images.URL + "/also-missing.jpg"}},
+	})
+	var probeErr *ProbeError
+	if !errors.As(results[0].Error, &probeErr) || probeErr.URL != missing || probeErr.Attempts != 2 {
+		t.Fatalf("unexpected error when every mirror fails: %v", results[0].Error)
+	}
+}
+
+func TestGetHTTPImageDataHeader(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "probe/1.0" || r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "test.gif", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	options := GetHTTPImageOptions{Header: http.Header{
+		"User-Agent": {"probe/1.0"},
+		"X-Token":    {"secret"},
+		"Range":      {"bytes=0-0"},
+	}}
+	results := GetHTTPImageDataWithOptions(context.Background(), []string{server.URL + "/test.gif"}, options)
+	if results[0].Error != nil || results[0].Info != (Info{GIF, 60, 40}) {
+		t.Fatalf("unexpected result: %+v err=%v", results[0].Info, results[0].Error)
+	}
+}
+
+func TestGetHTTPImageDataTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	options := GetHTTPImageOptions{Timeout: 50 * time.Millisecond}
+	results := GetHTTPImageDataWithOptions(context.Background(), []string{server.URL + "/slow.jpg"}, options)
+	if !errors.Is(results[0].Error, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", results[0].Error)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("probe outlived its timeout: %v", elapsed)
+	}
+}
+
+func TestGetHTTPImageDataDecodesContentEncoding(t *testing.T) {
+	cases := httpImageTestCases()
+	files := make(map[string]string)
+	for _, c := range cases {
+		files[c.Path] = c.File
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := os.ReadFile(files[r.URL.Path])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+	}))
+	defer server.Close()
+
+	urls := make([]string, 0, len(cases))
+	for _, c := range cases {
+		urls = append(urls, server.URL+c.Path)
+	}
+	results := GetHTTPImageDataWithOptions(context.Background(), urls, GetHTTPImageOptions{})
+	for i, result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error for %s: %v", urls[i], result.Error)
+		}
+		if got, expected := result.Info, cases[i].Info; got != expected {
+			t.Fatalf("unexpected info for %s: got %+v want %+v", urls[i], got, expected)
+		}
+		if result.ContentEncoding != "gzip" {
+			t.Fatalf("content encoding not recorded for %s: %q", urls[i], result.ContentEncoding)
+		}
+	}
+}
+
+func TestGetHTTPImageDataFollowsFormatHints(t *testing.T) {
+	// TIFF whose only IFD follows 300 KB of pixel data.
+	tiffData := []byte("II*\x00")
+	tiffData = binary.LittleEndian.AppendUint32(tiffData, 8+300000)
+	tiffData = append(tiffData, make([]byte, 300000)...)
+	tiffData = binary.LittleEndian.AppendUint16(tiffData, 2)
+	tiffData = append(tiffData, 0x00, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x80, 0x02, 0x00, 0x00)
+	tiffData = append(tiffData, 0x01, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0xe0, 0x01, 0x00, 0x00)
+	tiffData = append(tiffData, 0, 0, 0, 0)
+
+	// JPEG with a 60 KB APP1 segment before the frame header.
+	jpegData := []byte{0xff, 0xd8, 0xff, 0xe1, 0xea, 0x60}
+	jpegData = append(jpegData, make([]byte, 0xea60-2)...)
+	jpegData = append(jpegData, 0xff, 0xc0, 0x00, 0x11, 0x08, 0x01, 0x2c, 0x01, 0x90, 0x03)
+	jpegData = append(jpegData, make([]byte, 200)...)
+
+	cases := []struct {
+		Name     string
+		Data     []byte
+		Info     Info
+		Requests int32
+	}{
+		{"trailing-ifd.tif", tiffData, Info{TIFF, 640, 480}, 2},
+		{"large-app1.jpg", jpegData, Info{JPEG, 400, 300}, 2},
+	}
+	for _, c := range cases {
+		server, requests := newCountingServer(t, c.Data)
+		results := GetHTTPImageInfo(context.Background(), []string{server.URL + "/" + c.Name})
+		server.Close()
+
+		if results[0].Error != nil {
+			t.Fatalf("unexpected error for %s: %v", c.Name, results[0].Error)
+		}
+		if results[0].Info != c.Info {
+			t.Fatalf("unexpected info for %s: got %+v want %+v", c.Name, results[0].Info, c.Info)
+		}
+		if got := requests.Load(); got != c.Requests {
+			t.Fatalf("unexpected request count for %s: got %d want %d", c.Name, got, c.Requests)
+		}
+		if stats := results[0].Stats; stats.Requests != int(c.Requests) || stats.Attempts != 1 || stats.BytesFetched == 0 {
+			t.Fatalf("unexpected stats for %s: %+v", c.Name, stats)
+		}
+	}
+}
+
+func TestGetHTTPImageDataMultiRangeTail(t *testing.T) {
+	// TIFF whose only IFD sits in the last bytes of the file.
+	data := []byte("II*\x00")
+	data = binary.LittleEndian.AppendUint32(data, 8+300000)
+	data = append(data, make([]byte, 300000)...)
+	data = binary.LittleEndian.AppendUint16(data, 2)
+	data = append(data, 0x00, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x80, 0x02, 0x00, 0x00)
+	data = append(data, 0x01, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0xe0, 0x01, 0x00, 0x00)
+	data = append(data, 0, 0, 0, 0)
+
+	server, requests := newCountingServer(t, data)
+	defer server.Close()
+
+	urls := []string{server.URL + "/trailing-ifd.tif"}
+	results := GetHTTPImageDataWithOptions(context.Background(), urls, GetHTTPImageOptions{MultiRangeTail: 4096})
+	if results[0].Error != nil {
+		t.Fatalf("unexpected error: %v", results[0].Error)
+	}
+	if results[0].Info != (Info{TIFF, 640, 480}) {
+		t.Fatalf("unexpected info: %+v", results[0].Info)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("tail was not fetched with the first request: %d requests", got)
+	}
+}
+
+func TestGetHTTPImageDataStopsAtContentRangeSize(t *testing.T) {
+	server, requests := newCountingServer(t, bytes.Repeat([]byte{'?'}, 500))
+	defer server.Close()
+
+	results := GetHTTPImageInfo(context.Background(), []string{server.URL + "/unknown"})
+	var insufficient *InsufficientBytesError
+	if !errors.As(results[0].Error, &insufficient) {
+		t.Fatalf("expected InsufficientBytesError, got %v", results[0].Error)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("requested past the end of the file: %d requests", got)
+	}
+}
+
+func TestGetHTTPImageDataRetriesAndRangeSizes(t *testing.T) {
+	var busy atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		busy.Add(1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	results := GetHTTPImageDataWithOptions(context.Background(), []string{server.URL + "/a.png"}, GetHTTPImageOptions{Retries: -1})
+	var retryErr *RetryAfterError
+	if !errors.As(results[0].Error, &retryErr) {
+		t.Fatalf("expected RetryAfterError, got %v", results[0].Error)
+	}
+	if got := busy.Load(); got != 1 {
+		t.Fatalf("retried despite negative Retries: %d requests", got)
+	}
+
+	garbage, requests := newCountingServer(t, bytes.Repeat([]byte{'?'}, 500))
+	defer garbage.Close()
+	options := GetHTTPImageOptions{RangeSizes: []int64{256, 0, 128}}
+	results = GetHTTPImageDataWithOptions(context.Background(), []string{garbage.URL + "/unknown"}, options)
+	var insufficient *InsufficientBytesError
+	if !errors.As(results[0].Error, &insufficient) || insufficient.Got != 256 {
+		t.Fatalf("expected InsufficientBytesError after 256 bytes, got %v", results[0].Error)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("unexpected request count: got %d want 2", got)
+	}
+}
+
+func TestGetHTTPImageDataBackoff(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		http.ServeContent(w, r, "test.gif", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/test.gif"}
+	results := GetHTTPImageDataWithOptions(context.Background(), urls, GetHTTPImageOptions{Retries: 2})
+	if results[0].Error == nil || requests.Load() != 1 {
+		t.Fatalf("retried a 502 without Backoff: %d requests, err=%v", requests.Load(), results[0].Error)
+	}
+
+	requests.Store(0)
+	started := time.Now()
+	results = GetHTTPImageDataWithOptions(context.Background(), urls, GetHTTPImageOptions{Retries: 2, Backoff: 10 * time.Millisecond})
+	if results[0].Error != nil || results[0].Info != (Info{GIF, 60, 40}) {
+		t.Fatalf("unexpected result: %+v err=%v", results[0].HTTPImageInfo, results[0].Error)
+	}
+	if results[0].Stats.Attempts != 3 {
+		t.Fatalf("unexpected attempts: got %d want 3", results[0].Stats.Attempts)
+	}
+	if elapsed := time.Since(started); elapsed < 30*time.Millisecond {
+		t.Fatalf("retries did not back off: %v", elapsed)
+	}
+}
+
+func TestGetHTTPImageDataRequestsPerSecondPerOrigin(t *testing.T) {
+	server := newTestImageServer(t, true)
+	defer server.Close()
+
+	urls := []string{server.URL + "/test.gif", server.URL + "/pak38.gif", server.URL + "/xterm.bmp"}
+	started := time.Now()
+	results := GetHTTPImageDataWithOptions(context.Background(), urls, GetHTTPImageOptions{RequestsPerSecondPerOrigin: 20})
+	for _, r := range results {
+		if r.Error != nil {
+			t.Fatalf("probe %s: %v", r.URL, r.Error)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Fatalf("three requests at 20 per second took only %v", elapsed)
+	}
+}
+
+func TestGetHTTPImageDataRespectRobots(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	var robots, images atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			robots.Add(1)
+			fmt.Fprint(w, "User-agent: *\nDisallow: /\n\nUser-agent: audit\nDisallow: /private/\nAllow: /private/ok.gif\n")
+			return
+		}
+		images.Add(1)
+		http.ServeContent(w, r, "test.gif", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/public.gif", server.URL + "/private/secret.gif", server.URL + "/private/ok.gif"}
+	options := GetHTTPImageOptions{RespectRobots: true, Header: http.Header{"User-Agent": {"audit/1.0"}}}
+	results := GetHTTPImageDataWithOptions(context.Background(), urls, options)
+
+	var disallowed *RobotsDisallowedError
+	if results[0].Error != nil || !errors.As(results[1].Error, &disallowed) || results[2].Error != nil {
+		t.Fatalf("unexpected results: %v, %v, %v", results[0].Error, results[1].Error, results[2].Error)
+	}
+	if disallowed.URL != urls[1] {
+		t.Fatalf("unexpected disallowed URL: %s", disallowed.URL)
+	}
+	if robots.Load() != 1 || images.Load() != 2 {
+		t.Fatalf("unexpected requests: %d robots.txt, %d images", robots.Load(), images.Load())
+	}
+}
+
+func TestGetHTTPImageDataHTMLImageRobots(t *testing.T) {
+	data := mustReadFile(t, "testdata/test.gif")
+	var images atomic.Int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+			return
+		}
+		images.Add(1)
+		http.ServeContent(w, r, "test.gif", time.Time{}, bytes.NewReader(data))
+	}))
+	defer cdn.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/public.html":
+			fmt.Fprintf(w, `<head><meta property="og:image" content="%s/public.gif"></head>`, cdn.URL)
+		default:
+			fmt.Fprintf(w, `<head><meta property="og:image" content="%s/private/secret.gif"></head>`, cdn.URL)
+		}
+	}))
+	defer site.Close()
+
+	urls := []string{site.URL + "/public.html", site.URL + "/private.html"}
+	results := GetHTTPImageDataWithOptions(context.Background(), urls, GetHTTPImageOptions{FollowHTMLImages: true, RespectRobots: true})
+
+	var disallowed *RobotsDisallowedError
+	if results[0].Error != nil || !errors.As(results[1].Error, &disallowed) {
+		t.Fatalf("unexpected results: %v, %v", results[0].Error, results[1].Error)
+	}
+	if disallowed.URL != cdn.URL+"/private/secret.gif" {
+		t.Fatalf("unexpected disallowed URL: %s", disallowed.URL)
+	}
+	if images.Load() != 1 {
+		t.Fatalf("unexpected image requests: %d", images.Load())
+	}
+}
+
+func TestGetHTTPImageDataRobotsStatus(t *testing.T) {
+	data := mustReadFile(t, "testdata/test.gif")
+	for _, c := range []struct {
+		Status  int
+		Allowed bool
+	}{
+		{http.StatusNotFound, true},
+		{http.StatusForbidden, true},
+		{http.StatusInternalServerError, false},
+		{http.StatusServiceUnavailable, false},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				w.WriteHeader(c.Status)
+				return
+			}
+			http.ServeContent(w, r, "test.gif", time.Time{}, bytes.NewReader(data))
+		}))
+		result := GetHTTPImageDataWithOptions(context.Background(), []string{server.URL + "/test.gif"}, GetHTTPImageOptions{RespectRobots: true})[0]
+		server.Close()
+
+		var disallowed *RobotsDisallowedError
+		if allowed := !errors.As(result.Error, &disallowed); allowed != c.Allowed {
+			t.Errorf("robots.txt status %d: allowed = %v, want %v (error %v)", c.Status, allowed, c.Allowed, result.Error)
+		}
+	}
+}
+
+func TestGetHTTPImageDataContentHash(t *testing.T) {
+	gif := mustReadFile(t, "testdata/test.gif")
+	png := mustReadFile(t, "testdata/pass-1_s.png")
+	digest := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+
+	for _, supportRange := range []bool{true, false} {
+		server := newTestImageServer(t, supportRange)
+		urls := []string{server.URL + "/test.gif", server.URL + "/pass-1_s.png"}
+		results := GetHTTPImageDataWithOptions(context.Background(), urls, GetHTTPImageOptions{ContentHash: sha256.New})
+		server.Close()
+
+		// The small GIF is downloaded whole, the PNG only up to its first range.
+		gifResult, pngResult := results[0], results[1]
+		if gifResult.Error != nil || gifResult.ContentHash != digest(gif) || gifResult.HashedBytes != int64(len(gif)) || !gifResult.HashedFullBody {
+			t.Errorf("range=%v: unexpected GIF result %+v", supportRange, gifResult.HTTPImageInfo)
+		}
+		if pngResult.Error != nil || pngResult.ContentHash != digest(png[:1024]) || pngResult.HashedBytes != 1024 || pngResult.HashedFullBody {
+			t.Errorf("range=%v: unexpected PNG result %+v", supportRange, pngResult.HTTPImageInfo)
+		}
+	}
+
+	server := newTestImageServer(t, true)
+	defer server.Close()
+	result := GetHTTPImageInfo(context.Background(), []string{server.URL + "/test.gif"})[0]
+	if result.ContentHash != "" || result.HashedBytes != 0 {
+		t.Errorf("content hashed without ContentHash: %+v", result.HTTPImageInfo)
+	}
+}
+
+func TestGetHTTPImageDataContentLength(t *testing.T) {
+	gif := mustReadFile(t, "testdata/test.gif")
+	psd := mustReadFile(t, "testdata/468x60.psd")
+
+	for _, c := range []struct {
+		SupportRange bool
+		Want         []int64
+	}{
+		// Range responses give the size in Content-Range.
+		{true, []int64{int64(len(gif)), int64(len(psd))}},
+		// Without ranges the size is known when the body ends within the probe.
+		{false, []int64{int64(len(gif)), 0}},
+	} {
+		server := newTestImageServer(t, c.SupportRange)
+		results := GetHTTPImageInfo(context.Background(), []string{server.URL + "/test.gif", server.URL + "/468x60.psd"})
+		server.Close()
+		for i, result := range results {
+			if result.Error != nil || result.ContentLength != c.Want[i] {
+				t.Errorf("range=%v: %s: content length %d, %v, want %d", c.SupportRange, result.URL, result.ContentLength, result.Error, c.Want[i])
+			}
+		}
+	}
+}
+
+func TestGetHTTPImageDataProbeErrors(t *testing.T) {
+	server := newTestImageServer(t, true)
+	defer server.Close()
+	garbage, _ := newCountingServer(t, bytes.Repeat([]byte{'?'}, 500))
+	defer garbage.Close()
+
+	urls := []string{server.URL + "/missing.png", garbage.URL + "/garbage", "not a url"}
+	results := GetHTTPImageInfo(context.Background(), urls)
+
+	var probeErr *ProbeError
+	var statusErr *HTTPStatusError
+	if !errors.As(results[0].Error, &probeErr) || !errors.As(results[0].Error, &statusErr) {
+		t.Fatalf("expected ProbeError wrapping HTTPStatusError, got %v", results[0].Error)
+	}
+	if probeErr.URL != urls[0] || probeErr.StatusCode != http.StatusNotFound || probeErr.Attempts != 1 {
+		t.Fatalf("unexpected probe error: %+v", probeErr)
+	}
+
+	var insufficient *InsufficientBytesError
+	if !errors.As(results[1].Error, &probeErr) || !errors.As(results[1].Error, &insufficient) {
+		t.Fatalf("expected ProbeError wrapping InsufficientBytesError, got %v", results[1].Error)
+	}
+	if insufficient.URL != urls[1] || probeErr.BytesFetched != 500 || probeErr.StatusCode != http.StatusPartialContent {
+		t.Fatalf("unexpected probe error: %+v %+v", probeErr, insufficient)
+	}
+	if !errors.Is(results[1].Error, io.ErrUnexpectedEOF) {
+		t.Fatalf("probe error does not unwrap to io.ErrUnexpectedEOF: %v", results[1].Error)
+	}
+
+	var urlErr *url.Error
+	if !errors.As(results[2].Error, &probeErr) || !errors.As(results[2].Error, &urlErr) || probeErr.URL != urls[2] {
+		t.Fatalf("expected ProbeError wrapping url.Error, got %v", results[2].Error)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	cases := []struct {
+		Value string
+		Start int64
+		Total int64
+		OK    bool
+	}{
+		{"bytes 0-1023/123456", 0, 123456, true},
+		{"bytes 4096-8191/*", 4096, -1, true},
+		{"bytes */500", 0, 500, true},
+		{"bytes 10-20", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+	}
+	for _, c := range cases {
+		start, total, ok := parseContentRange(c.Value)
+		if start != c.Start || total != c.Total || ok != c.OK {
+			t.Errorf("parse content range %q: got %d %d %v want %d %d %v", c.Value, start, total, ok, c.Start, c.Total, c.OK)
+		}
+	}
+}
+
+// newCountingServer serves data at every path with range support and counts requests.
+func newCountingServer(t *testing.T, data []byte) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	requests := new(atomic.Int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	return server, requests
+}
+
 func newTestImageServer(t *testing.T, supportRange bool) *httptest.Server {
 	t.Helper()
 
@@ -1,7 +1,10 @@
 package fastimage
 
 import (
+	"bytes"
+	"encoding/binary"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -29,6 +32,33 @@ func TestTypeString(t *testing.T) {
 		{XPM, "xpm"},
 		{XV, "xv"},
 		{AVIF, "avif"},
+		{HEIC, "heic"},
+		{JXL, "jxl"},
+		{ICO, "ico"},
+		{CUR, "cur"},
+		{TGA, "tga"},
+		{APNG, "apng"},
+		{BPG, "bpg"},
+		{PAM, "pam"},
+		{SVG, "svg"},
+		{SVGZ, "svgz"},
+		{PVR, "pvr"},
+		{CR2, "cr2"},
+		{NEF, "nef"},
+		{ARW, "arw"},
+		{DNG, "dng"},
+		{ANI, "ani"},
+		{PICT, "pict"},
+		{DPX, "dpx"},
+		{CIN, "cin"},
+		{IVF, "ivf"},
+		{FITS, "fits"},
+		{ILBM, "ilbm"},
+		{PCD, "pcd"},
+		{TIM, "tim"},
+		{EPS, "eps"},
+		{CR3, "cr3"},
+		{MPO, "mpo"},
 	}
 
 	for _, c := range cases {
@@ -61,6 +91,33 @@ func TestTypeMime(t *testing.T) {
 		{XPM},
 		{XV},
 		{AVIF},
+		{HEIC},
+		{JXL},
+		{ICO},
+		{CUR},
+		{TGA},
+		{APNG},
+		{BPG},
+		{PAM},
+		{SVG},
+		{SVGZ},
+		{PVR},
+		{CR2},
+		{NEF},
+		{ARW},
+		{DNG},
+		{ANI},
+		{PICT},
+		{DPX},
+		{CIN},
+		{IVF},
+		{FITS},
+		{ILBM},
+		{PCD},
+		{TIM},
+		{EPS},
+		{CR3},
+		{MPO},
 	}
 
 	for _, c := range cases {
@@ -76,7 +133,9 @@ func TestGetType(t *testing.T) {
 		Type Type
 	}{
 		{"testdata/letter_T.jpg", JPEG},
+		{"testdata/stereo.mpo", MPO},
 		{"testdata/4.sm.webp", WEBP},
+		{"testdata/spin.webp", WEBP},
 		{"testdata/2_webp_a.webp", WEBP},
 		{"testdata/2_webp_ll.webp", WEBP},
 		{"testdata/4_webp_ll.webp", WEBP},
@@ -94,10 +153,48 @@ func TestGetType(t *testing.T) {
 		{"testdata/468x60.psd", PSD},
 		{"testdata/letter_T.mng", MNG},
 		{"testdata/letter_T.ras", RAS},
+		{"testdata/rle16.rgb", RGB},
+		{"testdata/row.bw", RGB},
 		{"testdata/letter_T.pcx", PCX},
 		{"testdata/bridge.avif", AVIF},
 		{"testdata/cow.avif", AVIF},
 		{"testdata/parrot.avif", AVIF},
+		{"testdata/grid.heic", HEIC},
+		{"testdata/burst.heics", HEIC},
+		{"testdata/bridge.jxl", JXL},
+		{"testdata/landscape.jxl", JXL},
+		{"testdata/icons.ico", ICO},
+		{"testdata/pointer.cur", CUR},
+		{"testdata/rle.tga", TGA},
+		{"testdata/palette.tga", TGA},
+		{"testdata/blink.png", APNG},
+		{"testdata/bridge.bpg", BPG},
+		{"testdata/alpha.pam", PAM},
+		{"testdata/logo.svg", SVG},
+		{"testdata/logo.svgz", SVGZ},
+		{"testdata/texture.pvr", PVR},
+		{"testdata/camera.cr2", CR2},
+		{"testdata/camera.nef", NEF},
+		{"testdata/camera.arw", ARW},
+		{"testdata/camera.dng", DNG},
+		{"testdata/busy.ani", ANI},
+		{"testdata/frame.pict", PICT},
+		{"testdata/headerless.pict", PICT},
+		{"testdata/scan.dpx", DPX},
+		{"testdata/little.dpx", DPX},
+		{"testdata/film.cin", CIN},
+		{"testdata/little.cin", CIN},
+		{"testdata/still.ivf", IVF},
+		{"testdata/m31.fits", FITS},
+		{"testdata/boing.iff", ILBM},
+		{"testdata/deluxe.lbm", ILBM},
+		{"testdata/portrait.pcd", PCD},
+		{"testdata/overview.pcd", PCD},
+		{"testdata/sprite.tim", TIM},
+		{"testdata/rgb24.tim", TIM},
+		{"testdata/page.eps", EPS},
+		{"testdata/preview.eps", EPS},
+		{"testdata/camera.cr3", CR3},
 	}
 
 	for _, c := range cases {
@@ -118,7 +215,9 @@ func TestGetInfo(t *testing.T) {
 		Info Info
 	}{
 		{"testdata/letter_T.jpg", Info{JPEG, 52, 54}},
+		{"testdata/stereo.mpo", Info{MPO, 64, 48}},
 		{"testdata/4.sm.webp", Info{WEBP, 320, 241}},
+		{"testdata/spin.webp", Info{WEBP, 100, 80}},
 		{"testdata/2_webp_a.webp", Info{WEBP, 386, 395}},
 		{"testdata/2_webp_ll.webp", Info{WEBP, 386, 395}},
 		{"testdata/4_webp_ll.webp", Info{WEBP, 421, 163}},
@@ -136,10 +235,50 @@ func TestGetInfo(t *testing.T) {
 		{"testdata/468x60.psd", Info{PSD, 468, 60}},
 		{"testdata/letter_T.mng", Info{MNG, 52, 54}},
 		{"testdata/letter_T.ras", Info{RAS, 52, 54}},
+		{"testdata/rle16.rgb", Info{RGB, 64, 48}},
+		{"testdata/row.bw", Info{RGB, 300, 1}},
 		{"testdata/letter_T.pcx", Info{PCX, 52, 54}},
 		{"testdata/bridge.avif", Info{AVIF, 1000, 666}},
 		{"testdata/cow.avif", Info{AVIF, 500, 300}},
 		{"testdata/parrot.avif", Info{AVIF, 1000, 667}},
+		{"testdata/spinner.avif", Info{AVIF, 480, 270}},
+		{"testdata/grid.heic", Info{HEIC, 1024, 768}},
+		{"testdata/burst.heics", Info{HEIC, 640, 480}},
+		{"testdata/bridge.jxl", Info{JXL, 1000, 666}},
+		{"testdata/landscape.jxl", Info{JXL, 1024, 768}},
+		{"testdata/icons.ico", Info{ICO, 90, 60}},
+		{"testdata/pointer.cur", Info{CUR, 32, 32}},
+		{"testdata/rle.tga", Info{TGA, 40, 30}},
+		{"testdata/palette.tga", Info{TGA, 16, 16}},
+		{"testdata/blink.png", Info{APNG, 24, 16}},
+		{"testdata/bridge.bpg", Info{BPG, 1000, 666}},
+		{"testdata/alpha.pam", Info{PAM, 227, 149}},
+		{"testdata/thumb.xv", Info{XV, 80, 60}},
+		{"testdata/logo.svg", Info{SVG, 120, 80}},
+		{"testdata/logo.svgz", Info{SVGZ, 120, 80}},
+		{"testdata/texture.pvr", Info{PVR, 512, 256}},
+		{"testdata/camera.cr2", Info{CR2, 5184, 3456}},
+		{"testdata/camera.nef", Info{NEF, 6048, 4032}},
+		{"testdata/camera.arw", Info{ARW, 6048, 4024}},
+		{"testdata/camera.dng", Info{DNG, 4000, 2666}},
+		{"testdata/busy.ani", Info{ANI, 32, 32}},
+		{"testdata/frame.pict", Info{PICT, 400, 300}},
+		{"testdata/headerless.pict", Info{PICT, 64, 48}},
+		{"testdata/scan.dpx", Info{DPX, 2048, 1556}},
+		{"testdata/little.dpx", Info{DPX, 1920, 1080}},
+		{"testdata/film.cin", Info{CIN, 2048, 1556}},
+		{"testdata/little.cin", Info{CIN, 1828, 1332}},
+		{"testdata/still.ivf", Info{IVF, 1280, 720}},
+		{"testdata/m31.fits", Info{FITS, 1024, 768}},
+		{"testdata/boing.iff", Info{ILBM, 320, 200}},
+		{"testdata/deluxe.lbm", Info{ILBM, 640, 480}},
+		{"testdata/portrait.pcd", Info{PCD, 512, 768}},
+		{"testdata/overview.pcd", Info{PCD, 768, 512}},
+		{"testdata/sprite.tim", Info{TIM, 64, 32}},
+		{"testdata/rgb24.tim", Info{TIM, 64, 64}},
+		{"testdata/page.eps", Info{EPS, 612, 792}},
+		{"testdata/preview.eps", Info{EPS, 100, 50}},
+		{"testdata/camera.cr3", Info{CR3, 6720, 4480}},
 	}
 
 	for _, c := range cases {
@@ -160,7 +299,9 @@ func TestGetInfoReader(t *testing.T) {
 		Info Info
 	}{
 		{"testdata/letter_T.jpg", Info{JPEG, 52, 54}},
+		{"testdata/stereo.mpo", Info{MPO, 64, 48}},
 		{"testdata/4.sm.webp", Info{WEBP, 320, 241}},
+		{"testdata/spin.webp", Info{WEBP, 100, 80}},
 		{"testdata/2_webp_a.webp", Info{WEBP, 386, 395}},
 		{"testdata/2_webp_ll.webp", Info{WEBP, 386, 395}},
 		{"testdata/4_webp_ll.webp", Info{WEBP, 421, 163}},
@@ -178,10 +319,50 @@ func TestGetInfoReader(t *testing.T) {
 		{"testdata/468x60.psd", Info{PSD, 468, 60}},
 		{"testdata/letter_T.mng", Info{MNG, 52, 54}},
 		{"testdata/letter_T.ras", Info{RAS, 52, 54}},
+		{"testdata/rle16.rgb", Info{RGB, 64, 48}},
+		{"testdata/row.bw", Info{RGB, 300, 1}},
 		{"testdata/letter_T.pcx", Info{PCX, 52, 54}},
 		{"testdata/bridge.avif", Info{AVIF, 1000, 666}},
 		{"testdata/cow.avif", Info{AVIF, 500, 300}},
 		{"testdata/parrot.avif", Info{AVIF, 1000, 667}},
+		{"testdata/spinner.avif", Info{AVIF, 480, 270}},
+		{"testdata/grid.heic", Info{HEIC, 1024, 768}},
+		{"testdata/burst.heics", Info{HEIC, 640, 480}},
+		{"testdata/bridge.jxl", Info{JXL, 1000, 666}},
+		{"testdata/landscape.jxl", Info{JXL, 1024, 768}},
+		{"testdata/icons.ico", Info{ICO, 90, 60}},
+		{"testdata/pointer.cur", Info{CUR, 32, 32}},
+		{"testdata/rle.tga", Info{TGA, 40, 30}},
+		{"testdata/palette.tga", Info{TGA, 16, 16}},
+		{"testdata/blink.png", Info{APNG, 24, 16}},
+		{"testdata/bridge.bpg", Info{BPG, 1000, 666}},
+		{"testdata/alpha.pam", Info{PAM, 227, 149}},
+		{"testdata/thumb.xv", Info{XV, 80, 60}},
+		{"testdata/logo.svg", Info{SVG, 120, 80}},
+		{"testdata/logo.svgz", Info{SVGZ, 120, 80}},
+		{"testdata/texture.pvr", Info{PVR, 512, 256}},
+		{"testdata/camera.cr2", Info{CR2, 5184, 3456}},
+		{"testdata/camera.nef", Info{NEF, 6048, 4032}},
+		{"testdata/camera.arw", Info{ARW, 6048, 4024}},
+		{"testdata/camera.dng", Info{DNG, 4000, 2666}},
+		{"testdata/busy.ani", Info{ANI, 32, 32}},
+		{"testdata/frame.pict", Info{PICT, 400, 300}},
+		{"testdata/headerless.pict", Info{PICT, 64, 48}},
+		{"testdata/scan.dpx", Info{DPX, 2048, 1556}},
+		{"testdata/little.dpx", Info{DPX, 1920, 1080}},
+		{"testdata/film.cin", Info{CIN, 2048, 1556}},
+		{"testdata/little.cin", Info{CIN, 1828, 1332}},
+		{"testdata/still.ivf", Info{IVF, 1280, 720}},
+		{"testdata/m31.fits", Info{FITS, 1024, 768}},
+		{"testdata/boing.iff", Info{ILBM, 320, 200}},
+		{"testdata/deluxe.lbm", Info{ILBM, 640, 480}},
+		{"testdata/portrait.pcd", Info{PCD, 512, 768}},
+		{"testdata/overview.pcd", Info{PCD, 768, 512}},
+		{"testdata/sprite.tim", Info{TIM, 64, 32}},
+		{"testdata/rgb24.tim", Info{TIM, 64, 64}},
+		{"testdata/page.eps", Info{EPS, 612, 792}},
+		{"testdata/preview.eps", Info{EPS, 100, 50}},
+		{"testdata/camera.cr3", Info{CR3, 6720, 4480}},
 	}
 
 	for _, c := range cases {
@@ -202,3 +383,307 @@ func TestGetInfoReader(t *testing.T) {
 		}
 	}
 }
+
+func TestJXLSize(t *testing.T) {
+	cases := []struct {
+		Header        []byte
+		Width, Height uint32
+	}{
+		{[]byte{0x4b, 0x00}, 48, 48}, // small, 1:1
+		{[]byte{0xca, 0x14, 0xe8, 0x7c, 0x00}, 1000, 666},
+		{[]byte{0xca}, 0, 0}, // truncated
+	}
+	for _, c := range cases {
+		if width, height := jxlSize(c.Header); width != c.Width || height != c.Height {
+			t.Errorf("jxlSize(%x) = %dx%d, want %dx%d", c.Header, width, height, c.Width, c.Height)
+		}
+	}
+}
+
+func TestICOLargest(t *testing.T) {
+	entry := func(width, height byte, offset uint32) []byte {
+		e := make([]byte, 16)
+		e[0], e[1] = width, height
+		binary.LittleEndian.PutUint32(e[12:], offset)
+		return e
+	}
+	ihdr := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR\x00\x00\x02\x00\x00\x00\x02\x00")
+
+	cases := []struct {
+		Name    string
+		Entries [][]byte
+		Info    Info
+	}{
+		{"zero means 256", [][]byte{entry(48, 48, 100), entry(0, 0, 100)}, Info{ICO, 256, 256}},
+		{"png header", [][]byte{entry(0, 0, 38), entry(32, 32, 100)}, Info{ICO, 512, 512}},
+	}
+	for _, c := range cases {
+		data := []byte{0, 0, 1, 0, byte(len(c.Entries)), 0}
+		for _, e := range c.Entries {
+			data = append(data, e...)
+		}
+		data = append(data, ihdr...)
+		data = append(data, make([]byte, 80)...)
+		if got := GetInfo(data); got != c.Info {
+			t.Errorf("%s: got %+v, want %+v", c.Name, got, c.Info)
+		}
+	}
+}
+
+func TestHasTGA(t *testing.T) {
+	header := func(mapType, imageType byte, mapLength uint16, mapDepth byte) []byte {
+		b := make([]byte, 80)
+		b[1], b[2], b[7] = mapType, imageType, mapDepth
+		binary.LittleEndian.PutUint16(b[5:], mapLength)
+		binary.LittleEndian.PutUint16(b[12:], 20)
+		binary.LittleEndian.PutUint16(b[14:], 10)
+		b[16] = 24
+		return b
+	}
+	withFooter := func(b []byte) []byte {
+		return append(b, append(make([]byte, 8), "TRUEVISION-XFILE.\x00"...)...)
+	}
+
+	cases := []struct {
+		Name string
+		Data []byte
+		Want bool
+	}{
+		{"true color", header(0, 2, 0, 0), true},
+		{"color mapped", header(1, 1, 256, 24), true},
+		{"color map on true color", header(1, 2, 256, 24), false},
+		{"missing color map", header(0, 9, 0, 0), false},
+		{"stray color map length", header(0, 2, 16, 0), false},
+		{"stray color map length with footer", withFooter(header(0, 2, 16, 0)), true},
+		{"unknown image type", withFooter(header(0, 4, 0, 0)), false},
+	}
+	for _, c := range cases {
+		if got := hasTGA(c.Data); got != c.Want {
+			t.Errorf("%s: hasTGA = %v, want %v", c.Name, got, c.Want)
+		}
+	}
+}
+
+func TestReadUE7(t *testing.T) {
+	cases := []struct {
+		Data []byte
+		Want uint32
+		Next int
+	}{
+		{[]byte{0x05}, 5, 1},
+		{[]byte{0x87, 0x68}, 1000, 2},
+		{[]byte{0x8f, 0xff, 0xff, 0xff, 0x7f}, 1<<32 - 1, 5},
+		{[]byte{0x90, 0x80, 0x80, 0x80, 0x00}, 0, 5}, // over 32 bits
+		{[]byte{0x87}, 0, 1},                         // truncated
+	}
+	for _, c := range cases {
+		if got, next := readUE7(c.Data, 0); got != c.Want || next != c.Next {
+			t.Errorf("readUE7(%x) = %d, %d, want %d, %d", c.Data, got, next, c.Want, c.Next)
+		}
+	}
+}
+
+func TestNetpbmP7(t *testing.T) {
+	pad := string(make([]byte, 80))
+	cases := []struct {
+		Data string
+		Info Info
+	}{
+		{"P7\nWIDTH 3\nHEIGHT 2\nDEPTH 1\nMAXVAL 1\nENDHDR\n" + pad, Info{PAM, 3, 2}},
+		{"P7\r\n#c\r\nDEPTH 3\r\nHEIGHT 20\r\nWIDTH 10\r\nENDHDR\r\n" + pad, Info{PAM, 10, 20}},
+		{"P7\nDEPTH 3\nENDHDR\n" + pad, Info{}},
+		{"P7\nWIDTH\nHEIGHT 1\nENDHDR\n" + string(make([]byte, 300)), Info{}},
+		{"P7\nWIDTH 3\nHEIGHT\nENDHDR\n" + pad, Info{}},
+		{"P7 332\n#END_OF_COMMENTS\n8 6 255\n" + pad, Info{XV, 8, 6}},
+		{"P7 40 30\n255\n" + pad, Info{XV, 40, 30}},
+	}
+	for _, c := range cases {
+		if got := GetInfo([]byte(c.Data)); got != c.Info {
+			t.Errorf("GetInfo(%q) = %+v, want %+v", c.Data[:12], got, c.Info)
+		}
+	}
+}
+
+func TestGetInfoUnterminatedLine(t *testing.T) {
+	for _, header := range []string{
+		"P7\nWIDTH 3",
+		"P7 332\n#",
+		"%!PS-Adobe-3.0 EPSF-3.0\n%%BoundingBox: 0 0 3",
+	} {
+		// No spare capacity, so reading past the end would panic.
+		b := []byte(header + strings.Repeat("4", 80))
+		if got := GetInfo(b[:len(b):len(b)]); got != (Info{}) {
+			t.Errorf("GetInfo(%q...) = %+v, want zero Info", header, got)
+		}
+	}
+}
+
+func TestGetBrand(t *testing.T) {
+	cases := []struct {
+		File  string
+		Brand string
+	}{
+		{"testdata/bridge.avif", "avif"},
+		{"testdata/spinner.avif", "avis"},
+		{"testdata/grid.heic", "heic"},
+		{"testdata/burst.heics", "hevc"}, // over the generic major brand msf1
+		{"testdata/landscape.jxl", "jxl "},
+		{"testdata/camera.cr3", "crx "},
+		{"testdata/bridge.jxl", ""},
+		{"testdata/letter_T.jpg", ""},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile(c.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := GetBrand(data); got != c.Brand {
+			t.Errorf("GetBrand(%s) = %q, want %q", c.File, got, c.Brand)
+		}
+	}
+}
+
+func TestInfoGeometry(t *testing.T) {
+	cases := []struct {
+		Info        Info
+		AspectRatio float64
+		Megapixels  float64
+		Orientation Orientation
+		Fits        bool // within 1920x1080
+	}{
+		{Info{JPEG, 4032, 3024}, 4.0 / 3, 12.192768, Landscape, false},
+		{Info{PNG, 1080, 1920}, 0.5625, 2.0736, Portrait, false},
+		{Info{GIF, 1080, 1080}, 1, 1.1664, Square, true},
+		{Info{WEBP, 1920, 1080}, 16.0 / 9, 2.0736, Landscape, true},
+		{Info{SVG, 0, 0}, 0, 0, OrientationUnknown, false},
+	}
+	for _, c := range cases {
+		if got := c.Info.AspectRatio(); got != c.AspectRatio {
+			t.Errorf("%+v: AspectRatio() = %g, want %g", c.Info, got, c.AspectRatio)
+		}
+		if got := c.Info.Megapixels(); got != c.Megapixels {
+			t.Errorf("%+v: Megapixels() = %g, want %g", c.Info, got, c.Megapixels)
+		}
+		if got := c.Info.Orientation(); got != c.Orientation {
+			t.Errorf("%+v: Orientation() = %v, want %v", c.Info, got, c.Orientation)
+		}
+		if got := c.Info.Fits(1920, 1080); got != c.Fits {
+			t.Errorf("%+v: Fits(1920, 1080) = %v, want %v", c.Info, got, c.Fits)
+		}
+	}
+	for o := Landscape; o <= Square; o++ {
+		if o.String() == "" {
+			t.Errorf("orientation %d has no name", o)
+		}
+	}
+}
+
+func TestGetInfoWithOptions(t *testing.T) {
+	cases := []struct {
+		File    string
+		Options DetectOptions
+		Info    Info
+	}{
+		{"testdata/letter_T_exif.jpg", DetectOptions{}, Info{JPEG, 52, 54}},
+		{"testdata/letter_T_exif.jpg", DetectOptions{ApplyOrientation: true}, Info{JPEG, 54, 52}}, // orientation 6
+		{"testdata/letter_T.jpg", DetectOptions{ApplyOrientation: true}, Info{JPEG, 52, 54}},
+		{"testdata/bexjdic.tif", DetectOptions{ApplyOrientation: true}, Info{TIFF, 35, 32}}, // orientation 1
+		{"testdata/pass-1_s.png", DetectOptions{ApplyOrientation: true}, Info{PNG, 90, 60}},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile(c.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := GetInfoWithOptions(data, c.Options); got != c.Info {
+			t.Errorf("GetInfoWithOptions(%s, %+v) = %+v, want %+v", c.File, c.Options, got, c.Info)
+		}
+		got, err := GetInfoReaderWithOptions(bytes.NewReader(data), c.Options)
+		if err != nil || got != c.Info {
+			t.Errorf("GetInfoReaderWithOptions(%s, %+v) = %+v, %v, want %+v", c.File, c.Options, got, err, c.Info)
+		}
+	}
+}
+
+func TestFITSEmptyValue(t *testing.T) {
+	card := func(s string) string { return s + strings.Repeat(" ", 80-len(s)) }
+	cases := []string{
+		card("SIMPLE  =                    T") + card("NAXIS   = ") + card("END"),
+		card("SIMPLE  =                    T") + card("NAXIS   =                    2") + card("NAXIS1  = / no value") + card("END"),
+	}
+	for _, c := range cases {
+		if got := GetInfo([]byte(c)); got.Width != 0 || got.Height != 0 {
+			t.Errorf("GetInfo(%q) = %+v, want no dimensions", c[80:100], got)
+		}
+	}
+}
+
+func TestXPMBlankLine(t *testing.T) {
+	data := "/* XPM */\nstatic char *x[] = {\n   \n\"4 2 1 1\",\n" + strings.Repeat(" ", 80)
+	if got := GetInfo([]byte(data)); got != (Info{XPM, 4, 2}) {
+		t.Errorf("GetInfo(%q) = %+v, want 4x2 XPM", data[:30], got)
+	}
+}
+
+func TestTIFFEntries(t *testing.T) {
+	type entry struct{ Tag, Type uint16 }
+	type byteOrder interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	// build returns a TIFF whose first IFD, at offset ifd, declares count entries and
+	// holds the given ones with values 300 + their index.
+	build := func(order byteOrder, ifd uint32, count uint16, entries ...entry) []byte {
+		b := []byte("II*\x00")
+		if order == binary.BigEndian {
+			b = []byte("MM\x00*")
+		}
+		b = order.AppendUint32(b, ifd)
+		b = append(b, make([]byte, int(ifd)-len(b))...)
+		b = order.AppendUint16(b, count)
+		for i, e := range entries {
+			value := make([]byte, 4)
+			switch e.Type {
+			case 1:
+				value[0] = byte(100 + i)
+			case 3:
+				order.PutUint16(value, uint16(300+i))
+			default:
+				order.PutUint32(value, uint32(300+i))
+			}
+			b = order.AppendUint16(b, e.Tag)
+			b = order.AppendUint16(b, e.Type)
+			b = order.AppendUint32(b, 1)
+			b = append(b, value...)
+		}
+		return append(b, make([]byte, 64)...)
+	}
+	width, height := entry{256, 3}, entry{257, 4}
+
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		moved := func(ifd uint32) []byte {
+			b := build(order, 8, 2, width, height)
+			order.PutUint32(b[4:], ifd)
+			return b
+		}
+		cases := []struct {
+			Name string
+			Data []byte
+			Info Info
+		}{
+			{"short and long", build(order, 8, 2, width, height), Info{TIFF, 300, 301}},
+			{"IFD further in", build(order, 40, 2, height, width), Info{TIFF, 301, 300}},
+			{"bytes", build(order, 8, 3, entry{254, 4}, entry{256, 1}, entry{257, 1}), Info{TIFF, 101, 102}},
+			{"past the entry count", build(order, 8, 1, width, height), Info{}},
+			{"unknown value type", build(order, 8, 2, entry{256, 5}, height), Info{}},
+			{"IFD inside the header", moved(4), Info{}},
+			{"IFD past the end", moved(1 << 20), Info{}},
+		}
+		for _, c := range cases {
+			// Failed detections may leave a partial size behind, only the type counts.
+			if got := GetInfo(c.Data); got.Type != c.Info.Type || (got.Type != Unknown && got != c.Info) {
+				t.Errorf("%v %s: GetInfo = %+v, want %+v", order, c.Name, got, c.Info)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package fastimagetest provides helpers for testing code that handles images with
+// fastimage: assertions on detected info, a test server for HTTP probing and golden
+// files listing the expected info of a directory of images.
+package fastimagetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+// UpdateEnv is the environment variable that makes AssertGolden rewrite golden
+// files instead of comparing against them, as in UPDATE_GOLDEN=1 go test ./...
+const UpdateEnv = "UPDATE_GOLDEN"
+
+// AssertInfo fails t unless the image file at path is detected as want, both from
+// its bytes with GetInfo and from a reader with GetInfoReader.
+func AssertInfo(t testing.TB, path string, want fastimage.Info) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("fastimagetest: read %s: %v", path, err)
+	}
+	if got := fastimage.GetInfo(data); got != want {
+		t.Errorf("GetInfo(%s) = %+v, want %+v", path, got, want)
+	}
+	got, err := fastimage.GetInfoReader(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("GetInfoReader(%s): %v", path, err)
+	} else if got != want {
+		t.Errorf("GetInfoReader(%s) = %+v, want %+v", path, got, want)
+	}
+}
+
+// Server is a test HTTP server that serves the files of a file system, for
+// exercising HTTP probing against origins with and without range support.
+type Server struct {
+	*httptest.Server
+	requests atomic.Int64
+	bytes    atomic.Int64
+}
+
+// NewServer starts a Server serving the files of fsys at their paths. With ranges
+// set it answers Range requests, including multi-range ones, with 206 responses;
+// otherwise it sends every file whole with 200, like origins that ignore Range.
+// The server is closed when the test ends.
+func NewServer(t testing.TB, fsys fs.FS, ranges bool) *Server {
+	t.Helper()
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		data, err := fs.ReadFile(fsys, path.Clean(r.URL.Path)[1:])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		cw := &countingWriter{ResponseWriter: w, n: &s.bytes}
+		if !ranges {
+			r.Header.Del("Range")
+			w.Header().Set("Accept-Ranges", "none")
+		}
+		http.ServeContent(cw, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Requests returns the number of requests the server has received.
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+// BytesSent returns the number of body bytes the server has sent.
+func (s *Server) BytesSent() int64 {
+	return s.bytes.Load()
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+// goldenEntry is the expected info of one file in a golden file.
+type goldenEntry struct {
+	Type   string `json:"type"`
+	Width  uint32 `json:"width"`
+	Height uint32 `json:"height"`
+}
+
+// Golden returns the golden file content for the images in fsys: a JSON object
+// mapping each file path to its type, width and height. Files that are not images
+// are left out.
+func Golden(fsys fs.FS) ([]byte, error) {
+	entries := make(map[string]goldenEntry)
+	for r := range fastimage.ScanFS(context.Background(), fsys, fastimage.ScanOptions{SkipUnknown: true}) {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		entries[r.Path] = goldenEntry{r.Type.String(), r.Width, r.Height}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// AssertGolden fails t unless the images in fsys match the golden file at golden.
+// The golden file is written instead when it does not exist yet or when the
+// UPDATE_GOLDEN environment variable is set.
+func AssertGolden(t testing.TB, fsys fs.FS, golden string) {
+	t.Helper()
+	got, err := Golden(fsys)
+	if err != nil {
+		t.Fatalf("fastimagetest: scan images: %v", err)
+	}
+	want, err := os.ReadFile(golden)
+	if os.Getenv(UpdateEnv) != "" || errors.Is(err, fs.ErrNotExist) {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatalf("fastimagetest: write golden file: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("fastimagetest: read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("images do not match %s; rerun with %s=1 to update it\ngot:\n%s", golden, UpdateEnv, got)
+	}
+}
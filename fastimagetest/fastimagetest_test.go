@@ -0,0 +1,70 @@
+package fastimagetest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kotylevskiy/fastimage"
+)
+
+func TestAssertInfo(t *testing.T) {
+	AssertInfo(t, "../testdata/letter_T.jpg", fastimage.Info{Type: fastimage.JPEG, Width: 52, Height: 54})
+}
+
+func TestServer(t *testing.T) {
+	for _, ranges := range []bool{true, false} {
+		server := NewServer(t, os.DirFS("../testdata"), ranges)
+		results := fastimage.GetHTTPImageInfo(context.Background(), []string{server.URL + "/pak38.gif", server.URL + "/missing.gif"})
+		if results[0].Error != nil || results[0].Info != (fastimage.Info{Type: fastimage.GIF, Width: 333, Height: 194}) {
+			t.Fatalf("ranges=%v: unexpected result %+v err=%v", ranges, results[0].Info, results[0].Error)
+		}
+		if results[1].Error == nil {
+			t.Fatalf("ranges=%v: missing file was found", ranges)
+		}
+		if server.Requests() != 2 {
+			t.Fatalf("ranges=%v: unexpected request count %d", ranges, server.Requests())
+		}
+		if sent := server.BytesSent(); ranges && sent != 1024 {
+			t.Fatalf("range request sent %d bytes", sent)
+		}
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	gif, err := os.ReadFile("../testdata/test.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	fsys := fstest.MapFS{
+		"a.gif":      {Data: gif},
+		"b/c.gif":    {Data: gif},
+		"readme.txt": {Data: []byte("not an image")},
+	}
+	golden := filepath.Join(t.TempDir(), "images.golden.json")
+	AssertGolden(t, fsys, golden)
+
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("golden file was not written: %v", err)
+	}
+	want := `{
+  "a.gif": {
+    "type": "gif",
+    "width": 60,
+    "height": 40
+  },
+  "b/c.gif": {
+    "type": "gif",
+    "width": 60,
+    "height": 40
+  }
+}
+`
+	if string(data) != want {
+		t.Fatalf("unexpected golden file:\n%s", data)
+	}
+	AssertGolden(t, fsys, golden)
+}
@@ -0,0 +1,171 @@
+package fastimage
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"mime"
+	"strings"
+)
+
+// maxHTMLBytes bounds how much of an HTML page is read while looking for image references.
+const maxHTMLBytes = 512 << 10
+
+func isHTMLContentType(value string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// findHTMLImage returns the image referenced by the page read from r, preferring
+// og:image over twitter:image over <link rel="image_src">. It returns "" when the
+// page head references no image.
+func findHTMLImage(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	var og, twitter, imageSrc string
+	for i := 0; i < len(data); {
+		j := bytes.IndexByte(data[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j + 1
+		if bytes.HasPrefix(data[i:], []byte("!--")) {
+			end := bytes.Index(data[i+3:], []byte("-->"))
+			if end < 0 {
+				break
+			}
+			i += 3 + end + 3
+			continue
+		}
+
+		var name string
+		var attrs map[string]string
+		name, attrs, i = parseHTMLTag(data, i)
+		switch name {
+		case "meta":
+			key := strings.ToLower(attrs["property"])
+			if key == "" {
+				key = strings.ToLower(attrs["name"])
+			}
+			content := strings.TrimSpace(attrs["content"])
+			if content == "" {
+				continue
+			}
+			switch key {
+			case "og:image", "og:image:url", "og:image:secure_url":
+				if og == "" {
+					og = content
+				}
+			case "twitter:image", "twitter:image:src":
+				if twitter == "" {
+					twitter = content
+				}
+			}
+		case "link":
+			href := strings.TrimSpace(attrs["href"])
+			if imageSrc != "" || href == "" {
+				continue
+			}
+			for _, rel := range strings.Fields(attrs["rel"]) {
+				if strings.EqualFold(rel, "image_src") {
+					imageSrc = href
+					break
+				}
+			}
+		case "script", "style":
+			end := bytes.Index(bytes.ToLower(data[i:]), []byte("</"+name))
+			if end < 0 {
+				i = len(data)
+				continue
+			}
+			i += end
+		case "/head", "body":
+			i = len(data)
+		}
+	}
+
+	switch {
+	case og != "":
+		return og, nil
+	case twitter != "":
+		return twitter, nil
+	}
+	return imageSrc, nil
+}
+
+// parseHTMLTag parses the tag starting at b[i], just after its '<'. It returns the
+// lower-cased tag name, its attributes with entities unescaped and the index after
+// the closing '>'.
+func parseHTMLTag(b []byte, i int) (name string, attrs map[string]string, j int) {
+	j = i
+	for j < len(b) && !isHTMLSpace(b[j]) && b[j] != '>' {
+		j++
+	}
+	name = strings.ToLower(strings.TrimSuffix(string(b[i:j]), "/"))
+	attrs = make(map[string]string)
+
+	for j < len(b) {
+		for j < len(b) && (isHTMLSpace(b[j]) || b[j] == '/') {
+			j++
+		}
+		if j >= len(b) {
+			break
+		}
+		if b[j] == '>' {
+			j++
+			break
+		}
+
+		k := j
+		for j < len(b) && !isHTMLSpace(b[j]) && b[j] != '=' && b[j] != '>' && b[j] != '/' {
+			j++
+		}
+		key := strings.ToLower(string(b[k:j]))
+		for j < len(b) && isHTMLSpace(b[j]) {
+			j++
+		}
+		if j >= len(b) || b[j] != '=' {
+			if key != "" {
+				attrs[key] = ""
+			}
+			continue
+		}
+		j++
+		for j < len(b) && isHTMLSpace(b[j]) {
+			j++
+		}
+
+		var value []byte
+		if j < len(b) && (b[j] == '"' || b[j] == '\'') {
+			quote := b[j]
+			end := bytes.IndexByte(b[j+1:], quote)
+			if end < 0 {
+				value = b[j+1:]
+				j = len(b)
+			} else {
+				value = b[j+1 : j+1+end]
+				j += end + 2
+			}
+		} else {
+			k = j
+			for j < len(b) && !isHTMLSpace(b[j]) && b[j] != '>' {
+				j++
+			}
+			value = b[k:j]
+		}
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = html.UnescapeString(string(value))
+		}
+	}
+	return
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f'
+}
@@ -0,0 +1,180 @@
+package fastimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// GetICCProfile reads from r until it finds the embedded ICC profile of the image
+// or can tell there is none, and returns the profile ready for a color management
+// system: the APP2 segments of a JPEG file put back together, the decompressed
+// iCCP chunk of a PNG file, the ICCP chunk of a WebP file, the ICCProfile tag of a
+// TIFF file or the colr box of an AVIF or HEIC file. A nil profile and a nil error
+// mean the image embeds none or is not in one of these formats.
+func GetICCProfile(r io.Reader) ([]byte, error) {
+	buf := make([]byte, 0, 4096)
+	tmp := make([]byte, 4096)
+
+	for {
+		n, err := r.Read(tmp)
+		if n > 0 {
+			buf = append(buf, tmp[:n]...)
+			if profile, done, err := iccProfile(buf); done || err != nil {
+				return profile, err
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				profile, _, err := iccProfile(buf)
+				return profile, err
+			}
+			return nil, err
+		}
+	}
+}
+
+// iccProfile returns the ICC profile of the image b, and whether b held enough to
+// tell.
+func iccProfile(b []byte) (profile []byte, done bool, err error) {
+	switch GetType(b) {
+	case Unknown:
+		return nil, false, nil
+	case JPEG, MPO:
+		return jpegICC(b)
+	case PNG, APNG:
+		return pngICC(b)
+	case WEBP:
+		return webpICC(b)
+	case AVIF, HEIC:
+		return heifICCProfile(b)
+	case TIFF, CR2, NEF, ARW, DNG:
+		if hasTIFFBig(b) {
+			return tiffICC(b, bigEndian)
+		}
+		return tiffICC(b, littleEndian)
+	}
+	return nil, true, nil
+}
+
+// jpegICC reassembles the ICC profile that JPEG files split across APP2 segments,
+// each numbered and carrying the total count, once the frame header is reached.
+func jpegICC(b []byte) ([]byte, bool, error) {
+	var chunks [][]byte
+	for i := 2; i+3 < len(b); {
+		code := b[i+1]
+		length := int(b[i+3]) | int(b[i+2])<<8
+		if b[i] != 0xff || length < 2 {
+			return nil, true, errors.New("fastimage: corrupt JPEG segment")
+		}
+		if code == 0xda || isSOF(code) {
+			return joinICCChunks(chunks)
+		}
+		if i+2+length > len(b) {
+			break
+		}
+		seg := b[i+4 : i+2+length]
+		if code == 0xe2 && len(seg) >= 14 && bytes.HasPrefix(seg, []byte("ICC_PROFILE\x00")) {
+			seq, count := int(seg[12]), int(seg[13])
+			if chunks == nil {
+				chunks = make([][]byte, count)
+			}
+			if seq < 1 || seq > len(chunks) || count != len(chunks) {
+				return nil, true, errors.New("fastimage: corrupt JPEG ICC profile numbering")
+			}
+			chunks[seq-1] = seg[14:]
+		}
+		i += 2 + length
+	}
+	return nil, false, nil
+}
+
+func joinICCChunks(chunks [][]byte) ([]byte, bool, error) {
+	for i, chunk := range chunks {
+		if chunk == nil {
+			return nil, true, fmt.Errorf("fastimage: JPEG ICC profile misses segment %d of %d", i+1, len(chunks))
+		}
+	}
+	if len(chunks) == 0 {
+		return nil, true, nil
+	}
+	return bytes.Join(chunks, nil), true, nil
+}
+
+// pngICC decompresses the profile of the iCCP chunk, which follows the profile name
+// and compression method, and must come before the image data.
+func pngICC(b []byte) ([]byte, bool, error) {
+	for i := 8; i+8 <= len(b); {
+		length := int(bigEndian.Uint32(b[i : i+4]))
+		switch string(b[i+4 : i+8]) {
+		case "IDAT":
+			return nil, true, nil
+		case "iCCP":
+			if i+8+length > len(b) {
+				return nil, false, nil
+			}
+			data := b[i+8 : i+8+length]
+			name := bytes.IndexByte(data, 0)
+			if name < 0 || name+2 > len(data) {
+				return nil, true, errors.New("fastimage: corrupt PNG iCCP chunk")
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(data[name+2:]))
+			if err != nil {
+				return nil, true, fmt.Errorf("fastimage: decompressing PNG iCCP chunk: %w", err)
+			}
+			profile, err := io.ReadAll(zr)
+			if err != nil {
+				return nil, true, fmt.Errorf("fastimage: decompressing PNG iCCP chunk: %w", err)
+			}
+			return profile, true, nil
+		}
+		i += 12 + length
+	}
+	return nil, false, nil
+}
+
+// webpICC returns the ICCP chunk of an extended WebP file whose VP8X header flags
+// one.
+func webpICC(b []byte) ([]byte, bool, error) {
+	if len(b) < 30 || b[15] != 'X' || b[20]&0x20 == 0 {
+		return nil, true, nil
+	}
+	for i := 12; i+8 <= len(b); {
+		size := int(littleEndian.Uint32(b[i+4 : i+8]))
+		if string(b[i:i+4]) == "ICCP" {
+			if i+8+size > len(b) {
+				return nil, false, nil
+			}
+			return b[i+8 : i+8+size], true, nil
+		}
+		i += 8 + size + size&1
+	}
+	return nil, false, nil
+}
+
+// heifICCProfile returns the profile of a HEIF file once its meta box is complete.
+func heifICCProfile(b []byte) ([]byte, bool, error) {
+	if isoBox(b, "meta") == nil {
+		return nil, false, nil
+	}
+	return heifICC(b), true, nil
+}
+
+// tiffICC returns the ICCProfile tag of the first IFD of the TIFF data b, which
+// may point anywhere in the file.
+func tiffICC(b []byte, order byteOrder) ([]byte, bool, error) {
+	if len(b) < 8 {
+		return nil, false, nil
+	}
+	ifd0 := int(order.Uint32(b[4:8]))
+	if ifd0+2 > len(b) || ifd0+2+12*int(order.Uint16(b[ifd0:ifd0+2])) > len(b) {
+		return nil, false, nil
+	}
+	if !tiffHasTag(b, order, ifd0, 34675) {
+		return nil, true, nil
+	}
+	_, value, ok := tiffEntry(b, order, ifd0, 34675)
+	return value, ok, nil
+}
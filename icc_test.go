@@ -0,0 +1,83 @@
+package fastimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+func TestGetICCProfile(t *testing.T) {
+	read := func(name string) []byte {
+		data, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	insert := func(b []byte, at int, s []byte) []byte {
+		return append(append(append([]byte{}, b[:at]...), s...), b[at:]...)
+	}
+	profile := bytes.Repeat([]byte("profile "), 40)
+
+	// A JPEG file with the profile split across two APP2 segments.
+	app2 := func(seq, count byte, data []byte) []byte {
+		seg := append([]byte("\xff\xe2\x00\x00ICC_PROFILE\x00"), seq, count)
+		seg = append(seg, data...)
+		binary.BigEndian.PutUint16(seg[2:], uint16(len(seg)-2))
+		return seg
+	}
+	jpeg := read("letter_T.jpg")
+	jpegICC := insert(jpeg, 2, append(app2(2, 2, profile[100:]), app2(1, 2, profile[:100])...))
+
+	// A PNG file with an iCCP chunk after IHDR.
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(profile)
+	zw.Close()
+	iccp := append([]byte("\x00\x00\x00\x00iCCPsRGB\x00\x00"), z.Bytes()...)
+	binary.BigEndian.PutUint32(iccp, uint32(len(iccp)-8))
+	iccp = binary.BigEndian.AppendUint32(iccp, crc32.ChecksumIEEE(iccp[4:]))
+	png := read("pass-1_s.png")
+	pngICC := insert(png, 33, iccp)
+
+	// A WebP file with an ICCP chunk after VP8X and the flag set.
+	webp := read("spin.webp")
+	chunk := binary.LittleEndian.AppendUint32([]byte("ICCP"), uint32(len(profile)))
+	webpICC := insert(webp, 30, append(chunk, profile...))
+	webpICC[20] |= 0x20
+
+	tiffProfile := append([]byte{0, 0, 0, 128}, make([]byte, 124)...)
+
+	for _, c := range []struct {
+		Name    string
+		Data    []byte
+		Profile []byte
+	}{
+		{"jpeg", jpeg, nil},
+		{"jpeg with profile", jpegICC, profile},
+		{"png", png, nil},
+		{"png with profile", pngICC, profile},
+		{"webp", webp, nil},
+		{"webp with profile", webpICC, profile},
+		{"tiff", read("bexjdic.tif"), nil},
+		{"tiff with profile", read("deep16.tiff"), tiffProfile},
+		{"gif", read("test.gif"), nil},
+	} {
+		got, err := GetICCProfile(bytes.NewReader(c.Data))
+		if err != nil {
+			t.Errorf("%s: %v", c.Name, err)
+			continue
+		}
+		if !bytes.Equal(got, c.Profile) || (got == nil) != (c.Profile == nil) {
+			t.Errorf("%s: got %d bytes, want %d", c.Name, len(got), len(c.Profile))
+		}
+	}
+
+	missing := insert(jpeg, 2, app2(1, 2, profile[:100]))
+	if _, err := GetICCProfile(bytes.NewReader(missing)); err == nil {
+		t.Error("missing JPEG segment: got no error")
+	}
+}
@@ -0,0 +1,290 @@
+package fastimage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// manifestChunkSize is the number of URLs BuildManifest probes as one HTTP batch,
+// which bounds the results held in memory for long source lists.
+const manifestChunkSize = 1024
+
+// ManifestRecord is the entry of one image source in a dataset manifest.
+type ManifestRecord struct {
+	// Source is the file path or the URL of the image.
+	Source string `json:"source"`
+	Info
+	// Bytes is the file size. For URLs it is HTTPImageInfo.ContentLength, zero when
+	// the probe did not learn it.
+	Bytes int64 `json:"bytes"`
+	// Hash is the hex SHA-256 of the file when ManifestOptions.Hash is set, and empty
+	// for URLs.
+	Hash string `json:"sha256,omitempty"`
+	// Err is set when the source could not be read or probed. It is encoded to JSON
+	// as its message.
+	Err error `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes r with Err as a string, which error values would not be.
+func (r ManifestRecord) MarshalJSON() ([]byte, error) {
+	type manifestRecord ManifestRecord
+	return json.Marshal(struct {
+		manifestRecord
+		Err string `json:"error,omitempty"`
+	}{manifestRecord(r), errorMessage(r.Err)})
+}
+
+// ManifestWriter receives the records of BuildManifest. Its methods are never called
+// concurrently.
+type ManifestWriter interface {
+	WriteRecord(r ManifestRecord) error
+	// Flush is called once after the last record, to complete the output.
+	Flush() error
+}
+
+// ManifestOptions controls BuildManifest.
+type ManifestOptions struct {
+	// Writer receives the records. It is required.
+	Writer ManifestWriter
+	// Concurrency is the number of files probed at once. Zero or negative uses the
+	// number of CPUs. URLs are limited by HTTP instead.
+	Concurrency int
+	// Hash reads files to the end to record their SHA-256. Without it only the
+	// header of each file is read.
+	Hash bool
+	// SkipUnknown drops sources that are not images instead of recording them with
+	// Type Unknown.
+	SkipUnknown bool
+	// HTTP controls the probing of URLs.
+	HTTP GetHTTPImageOptions
+}
+
+// BuildManifest probes sources, a mixture of file paths, directories and http or
+// https URLs, and streams a record per image to options.Writer in the order the
+// probes finish. Directories are walked and every regular file below them is
+// probed. Sources that fail are recorded with their error rather than stopping the
+// build, which ends early only when ctx ends or the writer fails; that error is
+// returned and the writer is not flushed.
+func BuildManifest(ctx context.Context, sources []string, options ManifestOptions) error {
+	if options.Writer == nil {
+		return errors.New("fastimage: BuildManifest needs a ManifestOptions.Writer")
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = runtime.NumCPU()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var urls, paths []string
+	for _, source := range sources {
+		if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			urls = append(urls, source)
+		} else {
+			paths = append(paths, source)
+		}
+	}
+
+	records := make(chan ManifestRecord, options.Concurrency)
+	send := func(r ManifestRecord) bool {
+		select {
+		case records <- r:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		manifestFiles(ctx, paths, options, send)
+	}()
+	go func() {
+		defer wg.Done()
+		manifestURLs(ctx, urls, options, send)
+	}()
+	go func() {
+		wg.Wait()
+		close(records)
+	}()
+
+	var err error
+	for r := range records {
+		if err != nil || (options.SkipUnknown && r.Err == nil && r.Type == Unknown) {
+			continue
+		}
+		if err = options.Writer.WriteRecord(r); err != nil {
+			// Stop the probes; the loop drains what they already sent.
+			cancel()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return options.Writer.Flush()
+}
+
+// manifestFiles probes paths, walking directories, on options.Concurrency workers.
+func manifestFiles(ctx context.Context, paths []string, options ManifestOptions, send func(ManifestRecord) bool) {
+	files := make(chan string)
+	var wg sync.WaitGroup
+	for range options.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range files {
+				if !send(manifestFile(path, options.Hash)) {
+					return
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(files)
+		wg.Wait()
+	}()
+
+	queue := func(path string) bool {
+		select {
+		case files <- path:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for _, source := range paths {
+		fi, err := os.Stat(source)
+		if err != nil || !fi.IsDir() {
+			// Errors are reported by manifestFile.
+			if !queue(source) {
+				return
+			}
+			continue
+		}
+		err = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if !send(ManifestRecord{Source: path, Err: err}) {
+					return fs.SkipAll
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && !queue(path) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// manifestFile probes the file at path, hashing all of it when hash is set.
+func manifestFile(path string, hash bool) ManifestRecord {
+	r := ManifestRecord{Source: path}
+	f, err := os.Open(path)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil {
+		r.Bytes = fi.Size()
+	}
+	if !hash {
+		r.Info, r.Err = GetInfoReader(f)
+		return r
+	}
+	h := sha256.New()
+	if r.Info, r.Err = GetInfoReader(io.TeeReader(f, h)); r.Err != nil {
+		return r
+	}
+	if _, r.Err = io.Copy(h, f); r.Err != nil {
+		return r
+	}
+	r.Hash = hex.EncodeToString(h.Sum(nil))
+	return r
+}
+
+// manifestURLs probes urls in HTTP batches of manifestChunkSize.
+func manifestURLs(ctx context.Context, urls []string, options ManifestOptions, send func(ManifestRecord) bool) {
+	for len(urls) > 0 && ctx.Err() == nil {
+		chunk := urls[:min(len(urls), manifestChunkSize)]
+		urls = urls[len(chunk):]
+		batch := StartHTTPImageBatch(ctx, chunk, options.HTTP)
+		for i := range batch.Completed() {
+			result := batch.Result(i)
+			record := ManifestRecord{Source: chunk[i], Info: result.Info, Bytes: result.ContentLength, Err: result.Error}
+			if !send(record) {
+				return
+			}
+		}
+	}
+}
+
+// manifestCSVHeader is the header row written by CSVManifestWriter.
+var manifestCSVHeader = []string{"source", "type", "width", "height", "bytes", "sha256", "error"}
+
+// CSVManifestWriter is a ManifestWriter that writes records as CSV, after a header
+// row with the columns source, type, width, height, bytes, sha256 and error.
+type CSVManifestWriter struct {
+	w      *csv.Writer
+	header bool // the header row was written
+}
+
+// NewCSVManifestWriter returns a CSVManifestWriter writing to w.
+func NewCSVManifestWriter(w io.Writer) *CSVManifestWriter {
+	return &CSVManifestWriter{w: csv.NewWriter(w)}
+}
+
+// WriteRecord writes r as a CSV row.
+func (m *CSVManifestWriter) WriteRecord(r ManifestRecord) error {
+	if err := m.writeHeader(); err != nil {
+		return err
+	}
+	var errText string
+	if r.Err != nil {
+		errText = r.Err.Error()
+	}
+	return m.w.Write([]string{
+		r.Source,
+		r.Type.String(),
+		strconv.FormatUint(uint64(r.Width), 10),
+		strconv.FormatUint(uint64(r.Height), 10),
+		strconv.FormatInt(r.Bytes, 10),
+		r.Hash,
+		errText,
+	})
+}
+
+// Flush writes any buffered rows, and the header row when no record was written.
+func (m *CSVManifestWriter) Flush() error {
+	if err := m.writeHeader(); err != nil {
+		return err
+	}
+	m.w.Flush()
+	return m.w.Error()
+}
+
+func (m *CSVManifestWriter) writeHeader() error {
+	if m.header {
+		return nil
+	}
+	m.header = true
+	return m.w.Write(manifestCSVHeader)
+}
@@ -0,0 +1,163 @@
+package fastimage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordingManifestWriter keeps the records it is given.
+type recordingManifestWriter struct {
+	records []ManifestRecord
+	flushed bool
+	err     error
+}
+
+func (w *recordingManifestWriter) WriteRecord(r ManifestRecord) error {
+	w.records = append(w.records, r)
+	return w.err
+}
+
+func (w *recordingManifestWriter) Flush() error {
+	w.flushed = true
+	return nil
+}
+
+func TestBuildManifest(t *testing.T) {
+	dir := t.TempDir()
+	gif, err := os.ReadFile("testdata/test.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"a.gif":      gif,
+		"sub/b.gif":  gif,
+		"readme.txt": []byte("not an image"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := newTestImageServer(t, true)
+	sum := sha256.Sum256(gif)
+
+	w := &recordingManifestWriter{}
+	sources := []string{dir, "testdata/pass-1_s.png", "testdata/missing.png", server.URL + "/pak38.gif"}
+	if err := BuildManifest(context.Background(), sources, ManifestOptions{Writer: w, Hash: true, SkipUnknown: true}); err != nil {
+		t.Fatalf("BuildManifest: %v", err)
+	}
+	if !w.flushed {
+		t.Fatal("writer was not flushed")
+	}
+
+	got := make(map[string]ManifestRecord)
+	for _, r := range w.records {
+		got[r.Source] = r
+	}
+	if len(got) != 5 {
+		t.Fatalf("unexpected records %+v", w.records)
+	}
+	for _, name := range []string{"a.gif", filepath.Join("sub", "b.gif")} {
+		r := got[filepath.Join(dir, name)]
+		if r.Err != nil || r.Info != (Info{GIF, 60, 40}) || r.Bytes != int64(len(gif)) || r.Hash != hex.EncodeToString(sum[:]) {
+			t.Errorf("unexpected record for %s: %+v", name, r)
+		}
+	}
+	if r := got["testdata/pass-1_s.png"]; r.Err != nil || r.Info != (Info{PNG, 90, 60}) || r.Hash == "" {
+		t.Errorf("unexpected record for png: %+v", r)
+	}
+	if r := got["testdata/missing.png"]; !errors.Is(r.Err, os.ErrNotExist) {
+		t.Errorf("missing file error = %v, want os.ErrNotExist", r.Err)
+	}
+	pak38 := mustReadFile(t, "testdata/pak38.gif")
+	if r := got[server.URL+"/pak38.gif"]; r.Err != nil || r.Info != (Info{GIF, 333, 194}) || r.Bytes != int64(len(pak38)) || r.Hash != "" {
+		t.Errorf("unexpected record for URL: %+v", r)
+	}
+}
+
+func TestBuildManifestWriterError(t *testing.T) {
+	want := errors.New("disk full")
+	w := &recordingManifestWriter{err: want}
+	sources := []string{"testdata/test.gif", "testdata/pass-1_s.png", "testdata/pak38.gif"}
+	err := BuildManifest(context.Background(), sources, ManifestOptions{Writer: w, Concurrency: 1})
+	if !errors.Is(err, want) {
+		t.Fatalf("BuildManifest error = %v, want %v", err, want)
+	}
+	if len(w.records) != 1 || w.flushed {
+		t.Fatalf("writer got %d records after failing, flushed=%v", len(w.records), w.flushed)
+	}
+
+	if err := BuildManifest(context.Background(), sources, ManifestOptions{}); err == nil {
+		t.Fatal("BuildManifest without a writer succeeded")
+	}
+}
+
+func TestCSVManifestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVManifestWriter(&buf)
+	records := []ManifestRecord{
+		{Source: "a.gif", Info: Info{GIF, 60, 40}, Bytes: 1234, Hash: "abcd"},
+		{Source: "https://example.com/b.png", Info: Info{PNG, 90, 60}},
+		{Source: "c,d.jpg", Err: errors.New("broken")},
+	}
+	for _, r := range records {
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatalf("WriteRecord: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	want := [][]string{
+		{"source", "type", "width", "height", "bytes", "sha256", "error"},
+		{"a.gif", "gif", "60", "40", "1234", "abcd", ""},
+		{"https://example.com/b.png", "png", "90", "60", "0", "", ""},
+		{"c,d.jpg", "", "0", "0", "0", "", "broken"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("unexpected rows %q", rows)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if rows[i][j] != want[i][j] {
+				t.Fatalf("row %d = %q, want %q", i, rows[i], want[i])
+			}
+		}
+	}
+
+	buf.Reset()
+	if err := NewCSVManifestWriter(&buf).Flush(); err != nil || buf.String() != "source,type,width,height,bytes,sha256,error\n" {
+		t.Fatalf("empty manifest = %q, %v", buf.String(), err)
+	}
+}
+
+func TestManifestRecordJSON(t *testing.T) {
+	cases := []struct {
+		Record ManifestRecord
+		JSON   string
+	}{
+		{ManifestRecord{Source: "a.gif", Info: Info{GIF, 60, 40}, Bytes: 1234, Hash: "abcd"}, `{"source":"a.gif","type":3,"width":60,"height":40,"bytes":1234,"sha256":"abcd"}`},
+		{ManifestRecord{Source: "b.png", Err: fs.ErrNotExist}, `{"source":"b.png","type":0,"width":0,"height":0,"bytes":0,"error":"file does not exist"}`},
+	}
+	for _, c := range cases {
+		data, err := json.Marshal(c.Record)
+		if err != nil || string(data) != c.JSON {
+			t.Errorf("json.Marshal(%+v) = %s, %v, want %s", c.Record, data, err, c.JSON)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package manifestparquet writes fastimage dataset manifests as Parquet files.
+//
+// It is a separate module so that the fastimage package itself stays free of
+// dependencies.
+package manifestparquet
+
+import (
+	"io"
+
+	"github.com/kotylevskiy/fastimage"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Row is the Parquet row of one manifest record. Its columns match those of
+// fastimage.CSVManifestWriter.
+type Row struct {
+	Source string `parquet:"source"`
+	Type   string `parquet:"type"`
+	Width  uint32 `parquet:"width"`
+	Height uint32 `parquet:"height"`
+	Bytes  int64  `parquet:"bytes"`
+	SHA256 string `parquet:"sha256"`
+	Error  string `parquet:"error"`
+}
+
+// Writer is a fastimage.ManifestWriter that writes records as Parquet rows.
+// The file is complete once Flush has returned.
+type Writer struct {
+	w *parquet.GenericWriter[Row]
+}
+
+// NewWriter returns a Writer writing a Parquet file to w. The options are passed on
+// to parquet.NewGenericWriter, for example to choose a compression codec.
+func NewWriter(w io.Writer, options ...parquet.WriterOption) *Writer {
+	return &Writer{w: parquet.NewGenericWriter[Row](w, options...)}
+}
+
+// WriteRecord writes r as a row.
+func (w *Writer) WriteRecord(r fastimage.ManifestRecord) error {
+	row := Row{
+		Source: r.Source,
+		Type:   r.Type.String(),
+		Width:  r.Width,
+		Height: r.Height,
+		Bytes:  r.Bytes,
+		SHA256: r.Hash,
+	}
+	if r.Err != nil {
+		row.Error = r.Err.Error()
+	}
+	_, err := w.w.Write([]Row{row})
+	return err
+}
+
+// Flush writes the buffered rows and the file footer. No record may be written
+// after it.
+func (w *Writer) Flush() error {
+	return w.w.Close()
+}
@@ -0,0 +1,60 @@
+package manifestparquet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kotylevskiy/fastimage"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	records := []fastimage.ManifestRecord{
+		{Source: "a.gif", Info: fastimage.Info{Type: fastimage.GIF, Width: 60, Height: 40}, Bytes: 1234, Hash: "abcd"},
+		{Source: "c.jpg", Err: errors.New("broken")},
+	}
+	for _, r := range records {
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatalf("WriteRecord: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	rows, err := parquet.Read[Row](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	want := []Row{
+		{Source: "a.gif", Type: "gif", Width: 60, Height: 40, Bytes: 1234, SHA256: "abcd"},
+		{Source: "c.jpg", Error: "broken"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(want))
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestBuildManifest(t *testing.T) {
+	var buf bytes.Buffer
+	err := fastimage.BuildManifest(context.Background(), []string{"../testdata/pass-1_s.png"}, fastimage.ManifestOptions{Writer: NewWriter(&buf)})
+	if err != nil {
+		t.Fatalf("BuildManifest: %v", err)
+	}
+	rows, err := parquet.Read[Row](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Type != "png" || rows[0].Width != 90 || rows[0].Height != 60 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+}
@@ -0,0 +1,365 @@
+package fastimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+)
+
+// GetEXIF returns the EXIF data of the image starting with p, in the TIFF format
+// that starts with a byte-order mark: the APP1 segment of JPEG files, the eXIf
+// chunk of PNG files, the EXIF chunk of WebP files and the Exif item of AVIF and
+// HEIC files, or the file itself for TIFF and camera RAW files. It returns nil
+// when the EXIF data is not within p; the returned bytes stop where p does.
+func GetEXIF(p []byte) []byte {
+	var exif []byte
+	switch GetType(p) {
+	case JPEG, MPO:
+		exif = jpegEXIF(p)
+	case PNG, APNG:
+		exif = pngChunk(p, "eXIf")
+	case WEBP:
+		exif = webpChunk(p, "EXIF")
+		// Some writers keep the JPEG APP1 identifier.
+		exif = bytes.TrimPrefix(exif, []byte("Exif\x00\x00"))
+	case AVIF, HEIC:
+		exif = heifEXIF(p)
+	case TIFF, CR2, NEF, ARW, DNG:
+		exif = p
+	}
+	if !hasTIFFBig(exif) && !hasTIFFLittle(exif) {
+		return nil
+	}
+	return exif
+}
+
+// xmpNamespace identifies the APP1 segment holding the XMP packet of JPEG files.
+const xmpNamespace = "http://ns.adobe.com/xap/1.0/\x00"
+
+// GetXMP returns the raw XMP packet of the image starting with p: the APP1 segment
+// of JPEG files, the XML:com.adobe.xmp iTXt chunk of PNG files, the XMP chunk of
+// WebP files or the XMLPacket tag of TIFF files. It returns nil when the packet is
+// not entirely within p. Packets larger than a JPEG segment continue in extended
+// XMP segments, which are not included.
+func GetXMP(p []byte) []byte {
+	switch GetType(p) {
+	case JPEG, MPO:
+		return jpegXMP(p)
+	case PNG, APNG:
+		return pngXMP(p)
+	case WEBP:
+		return webpXMP(p)
+	case TIFF, CR2, NEF, ARW, DNG:
+		if len(p) < 8 {
+			return nil
+		}
+		order := byteOrder(littleEndian)
+		if hasTIFFBig(p) {
+			order = bigEndian
+		}
+		if _, xmp, ok := tiffEntry(p, order, int(order.Uint32(p[4:8])), 700); ok {
+			return xmp
+		}
+	}
+	return nil
+}
+
+// jpegXMP returns the XMP packet of the APP1 segment that starts with the XMP
+// namespace, which must come before the image data.
+func jpegXMP(b []byte) []byte {
+	for i := 2; i+3 < len(b); {
+		code := b[i+1]
+		length := int(b[i+3]) | int(b[i+2])<<8
+		if b[i] != 0xff || length < 2 || code == 0xda || isSOF(code) || i+2+length > len(b) {
+			return nil
+		}
+		seg := b[i+4 : i+2+length]
+		if code == 0xe1 && bytes.HasPrefix(seg, []byte(xmpNamespace)) {
+			return seg[len(xmpNamespace):]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// pngXMP returns the text of the iTXt chunk with the XMP keyword, after its
+// compression flag and method, language tag and translated keyword.
+func pngXMP(b []byte) (xmp []byte) {
+	const keyword = "XML:com.adobe.xmp\x00"
+	IteratePNGChunks(b, func(typ string, data []byte) bool {
+		if typ != "iTXt" || !bytes.HasPrefix(data, []byte(keyword)) {
+			return true
+		}
+		data = data[len(keyword):]
+		if len(data) < 2 {
+			return false
+		}
+		compressed := data[0] == 1
+		fields := bytes.SplitN(data[2:], []byte{0}, 3) // language, translated keyword, text
+		if len(fields) < 3 {
+			return false
+		}
+		if !compressed {
+			xmp = fields[2]
+			return false
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(fields[2]))
+		if err != nil {
+			return false
+		}
+		if text, err := io.ReadAll(zr); err == nil {
+			xmp = text
+		}
+		return false
+	})
+	return xmp
+}
+
+// webpXMP returns the data of the complete "XMP " chunk of the WebP data b.
+func webpXMP(b []byte) []byte {
+	for i := 12; i+8 <= len(b); {
+		size := int(littleEndian.Uint32(b[i+4 : i+8]))
+		if string(b[i:i+4]) == "XMP " {
+			if i+8+size > len(b) {
+				return nil
+			}
+			return b[i+8 : i+8+size]
+		}
+		i += 8 + size + size&1
+	}
+	return nil
+}
+
+// jpegEXIF returns the TIFF data of the first APP1 Exif segment of the JPEG data b.
+func jpegEXIF(b []byte) []byte {
+	for i := 2; i+3 < len(b); {
+		code := b[i+1]
+		length := int(b[i+3]) | int(b[i+2])<<8
+		if b[i] != 0xff || length < 2 || code == 0xda || isSOF(code) {
+			return nil
+		}
+		seg := b[i+4 : min(i+2+length, len(b))]
+		if code == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// IteratePNGChunks calls fn with the type and data of each chunk of the PNG or APNG
+// data b, such as "gAMA", "sRGB", "tEXt" or "eXIf", in file order. It stops when fn
+// returns false, after the IEND chunk or at the first chunk not entirely within b,
+// so a header prefix yields the chunks before the image data. CRCs are not checked.
+func IteratePNGChunks(b []byte, fn func(typ string, data []byte) bool) {
+	if !hasPNG(b) {
+		return
+	}
+	for i := int64(8); i+8 <= int64(len(b)); {
+		length := int64(bigEndian.Uint32(b[i : i+4]))
+		typ := string(b[i+4 : i+8])
+		if i+8+length > int64(len(b)) || !fn(typ, b[i+8:i+8+length]) || typ == "IEND" {
+			return
+		}
+		i += 12 + length
+	}
+}
+
+// pngChunk returns the data of the first chunk of type typ in the PNG data b, as far
+// as b holds it.
+func pngChunk(b []byte, typ string) []byte {
+	for i := 8; i+8 <= len(b); {
+		length := int(bigEndian.Uint32(b[i : i+4]))
+		if string(b[i+4:i+8]) == typ {
+			return b[i+8 : min(i+8+length, len(b))]
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+// webpChunk returns the data of the first chunk named name in the WebP data b, as
+// far as b holds it.
+func webpChunk(b []byte, name string) []byte {
+	for i := 12; i+8 <= len(b); {
+		size := int(littleEndian.Uint32(b[i+4 : i+8]))
+		if string(b[i:i+4]) == name {
+			return b[i+8 : min(i+8+size, len(b))]
+		}
+		i += 8 + size + size&1
+	}
+	return nil
+}
+
+// heifEXIF returns the TIFF data of the Exif item of a HEIF file, which starts with
+// the offset of the TIFF header within the item.
+func heifEXIF(b []byte) []byte {
+	for _, item := range heifItems(b) {
+		if item.typ != "Exif" {
+			continue
+		}
+		data := item.data(b)
+		if len(data) < 4 {
+			return nil
+		}
+		offset := 4 + int64(bigEndian.Uint32(data[:4]))
+		if offset > int64(len(data)) {
+			return nil
+		}
+		return data[offset:]
+	}
+	return nil
+}
+
+// heifItem is an item of a HEIF file, such as an image, a tile or a metadata
+// block, as listed by the iinf box and located by the iloc box.
+type heifItem struct {
+	id  uint32
+	typ string
+	// offset and length locate the first extent of the item in the file. A zero
+	// length means the item runs to the end of the file, and a negative offset
+	// that it is not stored in the file.
+	offset, length int64
+}
+
+// data returns the bytes of the item as far as b holds them.
+func (item heifItem) data(b []byte) []byte {
+	if item.offset < 0 || item.offset > int64(len(b)) {
+		return nil
+	}
+	end := int64(len(b))
+	if item.length > 0 && item.offset+item.length < end {
+		end = item.offset + item.length
+	}
+	return b[item.offset:end]
+}
+
+// heifItems lists the items of the iinf box of a HEIF file with their location, or
+// nil when the meta box is not complete within b.
+func heifItems(b []byte) []heifItem {
+	meta, entries, _ := heifItemInfo(b)
+	if entries == nil {
+		return nil
+	}
+
+	var items []heifItem
+	for i := 1; ; i++ {
+		infe, name := isoChild(entries, i)
+		if infe == nil {
+			break
+		}
+		if name != "infe" || len(infe) < 4 || infe[0] < 2 {
+			continue
+		}
+		item := heifItem{offset: -1}
+		if infe[0] == 2 {
+			if len(infe) < 12 {
+				continue
+			}
+			item.id = uint32(bigEndian.Uint16(infe[4:6]))
+			item.typ = string(infe[8:12])
+		} else {
+			if len(infe) < 14 {
+				continue
+			}
+			item.id = bigEndian.Uint32(infe[4:8])
+			item.typ = string(infe[10:14])
+		}
+		items = append(items, item)
+	}
+	heifLocate(isoBox(meta, "iloc"), items)
+	return items
+}
+
+// heifItemInfo returns the payload of the meta box of a HEIF file after its version
+// and flags, and the item info entries of its iinf box with their declared count,
+// or nil entries when the meta box is not complete within b.
+func heifItemInfo(b []byte) (meta, entries []byte, count int) {
+	meta = isoBox(b, "meta")
+	if len(meta) < 4 {
+		return nil, nil, 0
+	}
+	meta = meta[4:] // version and flags
+	iinf := isoBox(meta, "iinf")
+	if len(iinf) < 6 {
+		return meta, nil, 0
+	}
+	if iinf[0] == 0 {
+		return meta, iinf[6:], int(bigEndian.Uint16(iinf[4:6]))
+	}
+	if len(iinf) < 8 {
+		return meta, nil, 0
+	}
+	return meta, iinf[8:], int(bigEndian.Uint32(iinf[4:8]))
+}
+
+// heifLocate sets the location of items from the iloc box payload b, for those
+// stored in the file.
+func heifLocate(b []byte, items []heifItem) {
+	if len(b) < 8 {
+		return
+	}
+	version := b[0]
+	offsetSize, lengthSize := int(b[4]>>4), int(b[4]&0x0f)
+	baseOffsetSize, indexSize := int(b[5]>>4), 0
+	if version >= 1 {
+		indexSize = int(b[5] & 0x0f)
+	}
+	r := sizedReader{b: b, pos: 6}
+	count := r.read(2)
+	if version >= 2 {
+		count = r.read(4)
+	}
+	for ; count > 0 && !r.short; count-- {
+		id := r.read(2)
+		if version >= 2 {
+			id = r.read(4)
+		}
+		method := uint64(0)
+		if version >= 1 {
+			method = r.read(2) & 0x0f
+		}
+		r.read(2) // data reference index
+		base := r.read(baseOffsetSize)
+		extents := r.read(2)
+		var offset, length uint64
+		for e := uint64(0); e < extents && !r.short; e++ {
+			if indexSize > 0 {
+				r.read(indexSize)
+			}
+			o, l := r.read(offsetSize), r.read(lengthSize)
+			if e == 0 {
+				offset, length = o, l
+			}
+		}
+		if r.short || method != 0 || base+offset > 1<<62 {
+			continue
+		}
+		for k := range items {
+			if uint64(items[k].id) == id {
+				items[k].offset, items[k].length = int64(base+offset), int64(min(length, 1<<62))
+			}
+		}
+	}
+}
+
+// sizedReader reads big-endian integers of 0, 1, 2, 4 or 8 bytes, as the iloc box
+// declares them, and notes when b is too short.
+type sizedReader struct {
+	b     []byte
+	pos   int
+	short bool
+}
+
+func (r *sizedReader) read(size int) uint64 {
+	if r.pos+size > len(r.b) {
+		r.short = true
+		return 0
+	}
+	var v uint64
+	for _, c := range r.b[r.pos : r.pos+size] {
+		v = v<<8 | uint64(c)
+	}
+	r.pos += size
+	return v
+}
@@ -0,0 +1,172 @@
+package fastimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestGetEXIF(t *testing.T) {
+	read := func(name string) []byte {
+		data, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	insert := func(b []byte, at int, s []byte) []byte {
+		return append(append(append([]byte{}, b[:at]...), s...), b[at:]...)
+	}
+	exif := jpegEXIF(read("gps.jpg"))
+	if !hasTIFFLittle(exif) {
+		t.Fatal("gps.jpg has no EXIF data")
+	}
+
+	exifChunk := binary.BigEndian.AppendUint32(nil, uint32(len(exif)))
+	exifChunk = append(append(append(exifChunk, "eXIf"...), exif...), 0, 0, 0, 0)
+	webpChunk := binary.LittleEndian.AppendUint32([]byte("EXIF"), uint32(len(exif)))
+	webpChunk = append(append(webpChunk, "Exif\x00\x00"...), exif...)
+	binary.LittleEndian.PutUint32(webpChunk[4:], uint32(len(exif)+6))
+	if len(webpChunk)&1 != 0 {
+		webpChunk = append(webpChunk, 0)
+	}
+
+	for _, c := range []struct {
+		Name string
+		Data []byte
+		EXIF []byte
+	}{
+		{"jpeg", read("gps.jpg"), exif},
+		{"jpeg without exif", read("letter_T.jpg"), nil},
+		{"png", insert(read("pass-1_s.png"), 33, exifChunk), exif},
+		{"webp", insert(read("spin.webp"), 30, webpChunk), exif},
+		{"heif", heifWithEXIF(exif), exif},
+		{"tiff", read("bexjdic.tif"), read("bexjdic.tif")},
+		{"gif", read("test.gif"), nil},
+	} {
+		if got := GetEXIF(c.Data); !bytes.Equal(got, c.EXIF) || (got == nil) != (c.EXIF == nil) {
+			t.Errorf("%s: got %d bytes, want %d", c.Name, len(got), len(c.EXIF))
+		}
+	}
+}
+
+// heifWithEXIF returns a HEIC file whose only item is an Exif item holding exif,
+// after a 4-byte header offset of zero.
+func heifWithEXIF(exif []byte) []byte {
+	box := func(name string, payload ...[]byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(8+len(bytes.Join(payload, nil))))
+		return append(append(b, name...), bytes.Join(payload, nil)...)
+	}
+	ftyp := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	infe := box("infe", []byte("\x02\x00\x00\x00\x00\x01\x00\x00Exif"))
+	iinf := box("iinf", []byte("\x00\x00\x00\x00\x00\x01"), infe)
+	iloc := func(offset uint32) []byte {
+		b := []byte("\x00\x00\x00\x00\x44\x00\x00\x01\x00\x01\x00\x00\x00\x01")
+		b = binary.BigEndian.AppendUint32(b, offset)
+		return box("iloc", binary.BigEndian.AppendUint32(b, uint32(4+len(exif))))
+	}
+	meta := func(offset uint32) []byte {
+		return box("meta", []byte("\x00\x00\x00\x00"), iinf, iloc(offset))
+	}
+	// The mdat payload starts after the boxes before it and its own header.
+	offset := uint32(len(ftyp) + len(meta(0)) + 8)
+	return bytes.Join([][]byte{ftyp, meta(offset), box("mdat", []byte{0, 0, 0, 0}, exif)}, nil)
+}
+
+func TestGetXMP(t *testing.T) {
+	read := func(name string) []byte {
+		data, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	insert := func(b []byte, at int, s []byte) []byte {
+		return append(append(append([]byte{}, b[:at]...), s...), b[at:]...)
+	}
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF/></x:xmpmeta>`)
+
+	app1 := append([]byte{0xff, 0xe1, 0, 0}, xmpNamespace...)
+	app1 = append(app1, xmp...)
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(app1)-2))
+	iTXt := func(compressed bool) []byte {
+		text := xmp
+		flag := byte(0)
+		if compressed {
+			var buf bytes.Buffer
+			zw := zlib.NewWriter(&buf)
+			zw.Write(xmp)
+			zw.Close()
+			text, flag = buf.Bytes(), 1
+		}
+		data := append([]byte("XML:com.adobe.xmp\x00"), flag, 0, 0, 0)
+		data = append(data, text...)
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		return append(append(append(chunk, "iTXt"...), data...), 0, 0, 0, 0)
+	}
+	webpChunk := binary.LittleEndian.AppendUint32([]byte("XMP "), uint32(len(xmp)))
+	webpChunk = append(webpChunk, xmp...)
+	if len(webpChunk)&1 != 0 {
+		webpChunk = append(webpChunk, 0)
+	}
+	// A TIFF file whose only IFD entry is the XMLPacket tag.
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00\xbc\x02\x01\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, uint32(len(xmp)))
+	tiff = append(binary.LittleEndian.AppendUint32(tiff, 26), 0, 0, 0, 0)
+	tiff = append(tiff, xmp...)
+
+	for _, c := range []struct {
+		Name string
+		Data []byte
+		XMP  []byte
+	}{
+		{"jpeg", insert(read("letter_T.jpg"), 2, app1), xmp},
+		{"jpeg without xmp", read("gps.jpg"), nil},
+		{"truncated jpeg", insert(read("letter_T.jpg"), 2, app1)[:40], nil},
+		{"png", insert(read("pass-1_s.png"), 33, iTXt(false)), xmp},
+		{"compressed png", insert(read("pass-1_s.png"), 33, iTXt(true)), xmp},
+		{"png without xmp", read("pass-1_s.png"), nil},
+		{"webp", insert(read("spin.webp"), 30, webpChunk), xmp},
+		{"tiff", tiff, xmp},
+		{"tiff without xmp", read("bexjdic.tif"), nil},
+		{"gif", read("test.gif"), nil},
+	} {
+		if got := GetXMP(c.Data); !bytes.Equal(got, c.XMP) {
+			t.Errorf("%s: got %q, want %q", c.Name, got, c.XMP)
+		}
+	}
+}
+
+func TestIteratePNGChunks(t *testing.T) {
+	data, err := os.ReadFile("testdata/pass-1_s.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	walk := func(b []byte, stop string) (types []string) {
+		IteratePNGChunks(b, func(typ string, chunk []byte) bool {
+			types = append(types, fmt.Sprintf("%s:%d", typ, len(chunk)))
+			return typ != stop
+		})
+		return types
+	}
+	for _, c := range []struct {
+		Name  string
+		Data  []byte
+		Stop  string
+		Types []string
+	}{
+		{"whole file", data, "", []string{"IHDR:13", "PLTE:159", "tEXt:56", "IDAT:3450", "IEND:0"}},
+		{"trailing bytes", append(data[:len(data):len(data)], "junk"...), "", []string{"IHDR:13", "PLTE:159", "tEXt:56", "IDAT:3450", "IEND:0"}},
+		{"stopped", data, "PLTE", []string{"IHDR:13", "PLTE:159"}},
+		{"header prefix", data[:300], "", []string{"IHDR:13", "PLTE:159", "tEXt:56"}},
+		{"not png", []byte("GIF89a\x01\x00\x01\x00"), "", nil},
+	} {
+		if got := walk(c.Data, c.Stop); !slices.Equal(got, c.Types) {
+			t.Errorf("%s: got %v, want %v", c.Name, got, c.Types)
+		}
+	}
+}
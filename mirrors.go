@@ -0,0 +1,78 @@
+package fastimage
+
+import (
+	"context"
+	"time"
+)
+
+// fetchFirst probes candidates, a URL followed by its mirrors, and returns the first
+// successful result. The next candidate is started when the previous ones have all
+// failed, or after hedge when it is positive. Each candidate is probed on the worker
+// workerFor returns for its origin. The returned info keeps the first candidate as
+// URL and reports the candidate that answered in ImageURL.
+func fetchFirst(ctx context.Context, candidates []string, workerFor func(origin string) *originWorker, hedge time.Duration, stats *probeStats) (HTTPImageInfo, error) {
+	type outcome struct {
+		rawURL string
+		info   HTTPImageInfo
+		err    error
+		stats  probeStats
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so that cancelled probes never block after a winner returned.
+	outcomes := make(chan outcome, len(candidates))
+	launched, pending := 0, 0
+	var hedgeTimer <-chan time.Time
+	launch := func() {
+		rawURL := candidates[launched]
+		launched++
+		pending++
+		if hedge > 0 && launched < len(candidates) {
+			hedgeTimer = time.After(hedge)
+		} else {
+			hedgeTimer = nil
+		}
+		go func() {
+			var s probeStats
+			origin, err := originOf(rawURL)
+			if err != nil {
+				outcomes <- outcome{rawURL: rawURL, err: err}
+				return
+			}
+			info, err := workerFor(origin).fetchImageInfo(ctx, rawURL, &s)
+			outcomes <- outcome{rawURL: rawURL, info: info, err: err, stats: s}
+		}()
+	}
+
+	launch()
+	var last outcome
+	for pending > 0 {
+		select {
+		case <-hedgeTimer:
+			launch()
+		case o := <-outcomes:
+			pending--
+			stats.attempts += o.stats.attempts
+			stats.requests += o.stats.requests
+			stats.bytes += o.stats.bytes
+			if o.stats.statusCode != 0 {
+				stats.statusCode = o.stats.statusCode
+			}
+			if o.err == nil {
+				info := o.info
+				info.URL = candidates[0]
+				if info.ImageURL == "" && o.rawURL != candidates[0] {
+					info.ImageURL = o.rawURL
+				}
+				return info, nil
+			}
+			last = o
+			if launched < len(candidates) {
+				launch()
+			}
+		}
+	}
+	return HTTPImageInfo{URL: candidates[0]}, last.err
+}
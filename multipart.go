@@ -0,0 +1,128 @@
+package fastimage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// maxPartBytes bounds the decoded bytes of a MIME part read while probing it, so
+// that large parts that are not images are not read to the end.
+const maxPartBytes = 256 << 10
+
+// PartResult is the outcome of probing one part of a MIME message.
+type PartResult struct {
+	// Index is the position of the part among the leaf parts of the message, in the
+	// order they appear, counting from 0.
+	Index int `json:"index"`
+	// FileName is the file name of the part from its Content-Disposition or
+	// Content-Type header, or empty for inline parts without one.
+	FileName string `json:"file_name,omitempty"`
+	// ContentType is the media type the part declares, such as image/png.
+	ContentType string `json:"content_type,omitempty"`
+	// Info is zero, with Type Unknown, for parts that are not images.
+	Info
+	// Err is set when the part could not be read or decoded. It is encoded to JSON
+	// as its message.
+	Err error `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes r with Err as a string, which error values would not be.
+func (r PartResult) MarshalJSON() ([]byte, error) {
+	type partResult PartResult
+	return json.Marshal(struct {
+		partResult
+		Err string `json:"error,omitempty"`
+	}{partResult(r), errorMessage(r.Err)})
+}
+
+// ScanMultipart probes the parts of mr in order, descending into nested multipart
+// parts, and yields a result per leaf part. Base64 and quoted-printable parts are
+// decoded as they are read, and only the first bytes of each part are decoded:
+// enough to find the image info, and at most 256 KB. A part that cannot be read
+// ends the iteration after its result.
+func ScanMultipart(mr *multipart.Reader) iter.Seq[PartResult] {
+	return func(yield func(PartResult) bool) {
+		index := 0
+		scanMultipart(mr, &index, yield)
+	}
+}
+
+// ScanMessage reads an RFC 822 email message from r and probes its parts like
+// ScanMultipart. A message that is not multipart yields one result for its body.
+func ScanMessage(r io.Reader) iter.Seq[PartResult] {
+	return func(yield func(PartResult) bool) {
+		msg, err := mail.ReadMessage(r)
+		if err != nil {
+			yield(PartResult{Err: err})
+			return
+		}
+		header := textproto.MIMEHeader(msg.Header)
+		mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		if strings.HasPrefix(mediaType, "multipart/") {
+			index := 0
+			scanMultipart(multipart.NewReader(msg.Body, params["boundary"]), &index, yield)
+			return
+		}
+		body := msg.Body
+		if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			body = quotedprintable.NewReader(body)
+		}
+		yield(probePart(header, body, 0))
+	}
+}
+
+// scanMultipart yields the leaf parts of mr, numbering them from *index. It reports
+// whether the iteration should go on.
+func scanMultipart(mr *multipart.Reader, index *int, yield func(PartResult) bool) bool {
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return true
+		}
+		if err != nil {
+			yield(PartResult{Index: *index, Err: err})
+			return false
+		}
+		mediaType, params, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if strings.HasPrefix(mediaType, "multipart/") {
+			if !scanMultipart(multipart.NewReader(part, params["boundary"]), index, yield) {
+				return false
+			}
+			continue
+		}
+		// NextPart has already decoded quoted-printable parts.
+		r := probePart(part.Header, part, *index)
+		*index++
+		if !yield(r) {
+			return false
+		}
+	}
+}
+
+// probePart probes the part with the given header and body.
+func probePart(header textproto.MIMEHeader, body io.Reader, index int) PartResult {
+	r := PartResult{Index: index}
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	r.ContentType = mediaType
+	if _, dispositionParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		r.FileName = dispositionParams["filename"]
+	}
+	if r.FileName == "" {
+		r.FileName = params["name"]
+	}
+	if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "base64") {
+		// The decoder skips the line breaks of the encoded body.
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	r.Info, r.Err = GetInfoReader(io.LimitReader(body, maxPartBytes))
+	return r
+}
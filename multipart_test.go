@@ -0,0 +1,138 @@
+package fastimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// buildTestMessage returns an email with a text body, a base64 JPEG attachment, a
+// nested multipart/related part holding a base64 PNG and an attachment that is not
+// an image.
+func buildTestMessage(t *testing.T) []byte {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	addPart := func(mw *multipart.Writer, header textproto.MIMEHeader, data []byte) {
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	encode := func(data []byte) []byte {
+		// Wrap lines at 76 characters, as mail clients do.
+		enc := base64.StdEncoding.EncodeToString(data)
+		var b strings.Builder
+		for len(enc) > 76 {
+			b.WriteString(enc[:76] + "\r\n")
+			enc = enc[76:]
+		}
+		b.WriteString(enc)
+		return []byte(b.String())
+	}
+
+	addPart(mw, textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}, []byte("Hello =E2=80=94 see attached."))
+	addPart(mw, textproto.MIMEHeader{
+		"Content-Type":              {"image/jpeg"},
+		"Content-Disposition":       {`attachment; filename="letter T.jpg"`},
+		"Content-Transfer-Encoding": {"base64"},
+	}, encode(mustReadFile(t, "testdata/letter_T.jpg")))
+
+	var related bytes.Buffer
+	rw := multipart.NewWriter(&related)
+	addPart(rw, textproto.MIMEHeader{
+		"Content-Type":              {`image/png; name="inline.png"`},
+		"Content-Transfer-Encoding": {"base64"},
+	}, encode(mustReadFile(t, "testdata/pass-1_s.png")))
+	rw.Close()
+	addPart(mw, textproto.MIMEHeader{
+		"Content-Type": {"multipart/related; boundary=" + rw.Boundary()},
+	}, related.Bytes())
+
+	addPart(mw, textproto.MIMEHeader{
+		"Content-Type":        {"application/pdf"},
+		"Content-Disposition": {`attachment; filename="report.pdf"`},
+	}, []byte("%PDF-1.4 not really"))
+	mw.Close()
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: a@example.com\r\nTo: b@example.com\r\nSubject: photos\r\nMIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes()
+}
+
+func TestScanMessage(t *testing.T) {
+	var got []PartResult
+	for r := range ScanMessage(bytes.NewReader(buildTestMessage(t))) {
+		got = append(got, r)
+	}
+	want := []PartResult{
+		{Index: 0, ContentType: "text/plain"},
+		{Index: 1, FileName: "letter T.jpg", ContentType: "image/jpeg", Info: Info{JPEG, 52, 54}},
+		{Index: 2, FileName: "inline.png", ContentType: "image/png", Info: Info{PNG, 90, 60}},
+		{Index: 3, FileName: "report.pdf", ContentType: "application/pdf"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d parts, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("part %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScanMessageSinglePart(t *testing.T) {
+	data := base64.StdEncoding.EncodeToString(mustReadFile(t, "testdata/test.gif"))
+	msg := "Content-Type: image/gif\r\nContent-Transfer-Encoding: base64\r\n\r\n" + data
+	var got []PartResult
+	for r := range ScanMessage(strings.NewReader(msg)) {
+		got = append(got, r)
+	}
+	if len(got) != 1 || got[0].Err != nil || got[0].Info != (Info{GIF, 60, 40}) {
+		t.Fatalf("unexpected results %+v", got)
+	}
+}
+
+func TestScanMultipartBreak(t *testing.T) {
+	msg := buildTestMessage(t)
+	_, body, _ := bytes.Cut(msg, []byte("\r\n\r\n"))
+	boundary := string(bytes.TrimPrefix(bytes.SplitN(body, []byte("\r\n"), 2)[0], []byte("--")))
+	n := 0
+	for range ScanMultipart(multipart.NewReader(bytes.NewReader(body), boundary)) {
+		n++
+		if n == 2 {
+			break
+		}
+	}
+	if n != 2 {
+		t.Fatalf("iterated %d parts", n)
+	}
+}
+
+func TestPartResultJSON(t *testing.T) {
+	cases := []struct {
+		Result PartResult
+		JSON   string
+	}{
+		{PartResult{Index: 1, FileName: "a.gif", ContentType: "image/gif", Info: Info{GIF, 60, 40}}, `{"index":1,"file_name":"a.gif","content_type":"image/gif","type":3,"width":60,"height":40}`},
+		{PartResult{Index: 2, Err: errors.New("illegal base64 data at input byte 4")}, `{"index":2,"type":0,"width":0,"height":0,"error":"illegal base64 data at input byte 4"}`},
+	}
+	for _, c := range cases {
+		data, err := json.Marshal(c.Result)
+		if err != nil || string(data) != c.JSON {
+			t.Errorf("json.Marshal(%+v) = %s, %v, want %s", c.Result, data, err, c.JSON)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package fastimage
+
+import "bytes"
+
+// TIFF tags used to tell camera RAW files apart and to find their full-size image.
+const (
+	tiffNewSubfileType = 0xfe
+	tiffMake           = 0x10f
+	tiffSubIFDs        = 0x14a
+	tiffDNGVersion     = 0xc612
+)
+
+// maxRawIFDs bounds the IFDs visited in a RAW file, against loops in corrupt chains.
+const maxRawIFDs = 32
+
+// rawType returns the camera RAW format of the TIFF data b, or Unknown for other
+// TIFF files. DNG files carry a DNGVersion tag, CR2 files a "CR" marker and version
+// after the TIFF header, and NEF and ARW files the Make of their camera and
+// SubIFDs holding the sensor data.
+func rawType(b []byte, order byteOrder) Type {
+	if len(b) < 16 {
+		return Unknown
+	}
+	ifd0 := int(order.Uint32(b[4:8]))
+	if _, _, ok := tiffEntry(b, order, ifd0, tiffDNGVersion); ok {
+		return DNG
+	}
+	if b[0] == 'I' && b[8] == 'C' && b[9] == 'R' && b[10] == 2 {
+		return CR2
+	}
+	if _, _, ok := tiffEntry(b, order, ifd0, tiffSubIFDs); !ok {
+		return Unknown
+	}
+	cameraMake := bytes.ToUpper(tiffString(b, order, ifd0, tiffMake))
+	switch {
+	case bytes.HasPrefix(cameraMake, []byte("NIKON")):
+		return NEF
+	case bytes.HasPrefix(cameraMake, []byte("SONY")):
+		return ARW
+	}
+	return Unknown
+}
+
+// raw reports the largest full-resolution image of a camera RAW file. RAW files
+// keep several images in their IFD chain and SubIFDs, such as thumbnails and
+// previews, which NewSubfileType marks as reduced-resolution; when none is marked
+// full-resolution, the largest image is reported.
+func raw(b []byte, info *Info, order byteOrder, t Type) {
+	var full, largest [2]uint32
+	visit := func(ifd int) {
+		width, _ := tiffIFDTag(b, order, ifd, 256)
+		height, _ := tiffIFDTag(b, order, ifd, 257)
+		if uint64(width)*uint64(height) > uint64(largest[0])*uint64(largest[1]) {
+			largest = [2]uint32{width, height}
+		}
+		if subfile, _ := tiffIFDTag(b, order, ifd, tiffNewSubfileType); subfile&1 == 0 &&
+			uint64(width)*uint64(height) > uint64(full[0])*uint64(full[1]) {
+			full = [2]uint32{width, height}
+		}
+	}
+
+	seen := make(map[int]bool)
+	for ifd := int(order.Uint32(b[4:8])); ifd != 0 && !seen[ifd] && len(seen) < maxRawIFDs; ifd = tiffNextIFD(b, order, ifd) {
+		seen[ifd] = true
+		visit(ifd)
+		for _, sub := range tiffLongs(b, order, ifd, tiffSubIFDs) {
+			if !seen[int(sub)] && len(seen) < maxRawIFDs {
+				seen[int(sub)] = true
+				visit(int(sub))
+			}
+		}
+	}
+
+	size := full
+	if size[0] == 0 || size[1] == 0 {
+		size = largest
+	}
+	if size[0] != 0 && size[1] != 0 {
+		info.Type, info.Width, info.Height = t, size[0], size[1]
+	}
+}
+
+// tiffEntry returns the type and count of tag in the IFD at offset i of the TIFF
+// data b, and its value: the 4-byte field itself, or the bytes it points at when
+// the value is larger. ok is false when the tag or its value is not within b.
+func tiffEntry(b []byte, order byteOrder, i int, tag uint16) (typ uint16, value []byte, ok bool) {
+	if i < 8 || i+2 > len(b) {
+		return 0, nil, false
+	}
+	n := int(order.Uint16(b[i : i+2]))
+	i += 2
+	for ; n > 0 && i+12 <= len(b); i, n = i+12, n-1 {
+		if order.Uint16(b[i:i+2]) != tag {
+			continue
+		}
+		typ = order.Uint16(b[i+2 : i+4])
+		count := int64(order.Uint32(b[i+4 : i+8]))
+		size := count * int64(tiffTypeSize(typ))
+		if size <= 4 {
+			return typ, b[i+8 : i+8+int(size)], true
+		}
+		offset := int64(order.Uint32(b[i+8 : i+12]))
+		if offset+size > int64(len(b)) {
+			return 0, nil, false
+		}
+		return typ, b[offset : offset+size], true
+	}
+	return 0, nil, false
+}
+
+// tiffTypeSize returns the size in bytes of a value of the TIFF field type typ.
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11, 13: // LONG, SLONG, FLOAT, IFD
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+// tiffString returns the ASCII value of tag in the IFD at offset i, without its
+// terminating NUL.
+func tiffString(b []byte, order byteOrder, i int, tag uint16) []byte {
+	typ, value, ok := tiffEntry(b, order, i, tag)
+	if !ok || typ != 2 {
+		return nil
+	}
+	if end := bytes.IndexByte(value, 0); end >= 0 {
+		value = value[:end]
+	}
+	return value
+}
+
+// tiffLongs returns the LONG or IFD values of tag in the IFD at offset i.
+func tiffLongs(b []byte, order byteOrder, i int, tag uint16) []uint32 {
+	typ, value, ok := tiffEntry(b, order, i, tag)
+	if !ok || (typ != 4 && typ != 13) {
+		return nil
+	}
+	longs := make([]uint32, len(value)/4)
+	for k := range longs {
+		longs[k] = order.Uint32(value[4*k:])
+	}
+	return longs
+}
+
+// cr3Dimensions returns the largest image of a Canon CR3 file. Its tracks hold the
+// full-size JPEG preview, a small preview and the sensor data, each described by a
+// CRAW sample entry with the width and height of a VisualSampleEntry.
+func cr3Dimensions(b []byte) (uint32, uint32) {
+	var width, height uint32
+	moov := isoBox(b, "moov")
+	for i := 1; ; i++ {
+		trak, name := isoChild(moov, i)
+		if trak == nil {
+			return width, height
+		}
+		if name != "trak" {
+			continue
+		}
+		stsd := isoBox(isoBox(isoBox(isoBox(trak, "mdia"), "minf"), "stbl"), "stsd")
+		if len(stsd) < 8 {
+			continue
+		}
+		entry, format := isoChild(stsd[8:], 1) // after version, flags and entry count
+		if format != "CRAW" || len(entry) < 28 {
+			continue
+		}
+		w, h := uint32(bigEndian.Uint16(entry[24:26])), uint32(bigEndian.Uint16(entry[26:28]))
+		if uint64(w)*uint64(h) > uint64(width)*uint64(height) {
+			width, height = w, h
+		}
+	}
+}
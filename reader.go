@@ -26,3 +26,32 @@ func GetInfoReader(r io.Reader) (Info, error) {
 		}
 	}
 }
+
+// GetInfoReaderWithOptions reads from r until it can determine the image info,
+// adjusted as options say, or EOF. To apply the EXIF orientation, it reads at least
+// 64 KB, as EXIF data may follow the dimensions.
+func GetInfoReaderWithOptions(r io.Reader, options DetectOptions) (Info, error) {
+	minBytes := 0
+	if options.ApplyOrientation {
+		minBytes = extendedMinBytes
+	}
+	buf := make([]byte, 0, 4096)
+	tmp := make([]byte, 4096)
+
+	for {
+		n, err := r.Read(tmp)
+		if n > 0 {
+			buf = append(buf, tmp[:n]...)
+			info := GetInfo(buf)
+			if info.Type != Unknown && info.Width != 0 && info.Height != 0 && len(buf) >= minBytes {
+				return GetInfoWithOptions(buf, options), nil
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return GetInfoWithOptions(buf, options), nil
+			}
+			return Info{}, err
+		}
+	}
+}
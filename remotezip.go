@@ -0,0 +1,215 @@
+package fastimage
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+const (
+	// remoteZipBlockSize is the size of the aligned blocks ScanRemoteZip requests, so
+	// that the many small reads of the zip package become few requests.
+	remoteZipBlockSize = 64 << 10
+	// remoteZipMaxBlocks bounds the number of blocks kept in memory.
+	remoteZipMaxBlocks = 64
+	// remoteZipMaxMemberBytes bounds the decompressed bytes of a member read while
+	// probing it, so that members that are not images are not downloaded whole.
+	remoteZipMaxMemberBytes = 256 << 10
+)
+
+// RemoteZipOptions controls ScanRemoteZip.
+type RemoteZipOptions struct {
+	ScanOptions
+	// Client sends the requests. Nil uses http.DefaultClient.
+	Client *http.Client
+	// Header holds extra headers sent with every request, such as User-Agent or
+	// Authorization. The Range header is set by the reader.
+	Header http.Header
+}
+
+// ScanRemoteZip probes the members of the ZIP archive at rawURL without downloading
+// it, yielding a result per regular file like ScanArchive. The central directory is
+// read from the end of the file with range requests, and then only the first bytes
+// of each member are fetched, decompressing deflated members as far as needed and
+// reading at most 256 KB of each.
+// Reads are served from aligned 64 KB blocks, so members whose headers are close
+// together share requests. The server must support range requests; when it does
+// not, or the archive cannot be read, a single result with Path set to rawURL and
+// Err set is yielded.
+func ScanRemoteZip(ctx context.Context, rawURL string, options RemoteZipOptions) iter.Seq[ScanResult] {
+	return func(yield func(ScanResult) bool) {
+		r := &httpRangeReader{
+			ctx:    ctx,
+			client: options.Client,
+			url:    rawURL,
+			header: options.Header,
+			blocks: make(map[int64][]byte),
+		}
+		if r.client == nil {
+			r.client = http.DefaultClient
+		}
+		if err := r.init(); err != nil {
+			yield(ScanResult{Path: rawURL, Err: err})
+			return
+		}
+		zr, err := zip.NewReader(r, r.size)
+		if err != nil {
+			yield(ScanResult{Path: rawURL, Err: err})
+			return
+		}
+		for result := range scanFS(ctx, zr, options.ScanOptions, remoteZipMaxMemberBytes) {
+			if !yield(result) {
+				return
+			}
+		}
+	}
+}
+
+// httpRangeReader is an io.ReaderAt over a remote file that fetches aligned blocks
+// with range requests and keeps the latest ones. It is safe for concurrent use.
+type httpRangeReader struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	header http.Header
+	size   int64
+
+	// tail holds the end of the file, from tailOffset on, fetched by init.
+	tail       []byte
+	tailOffset int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte // by block index
+	order  []int64          // block indexes, oldest first
+}
+
+// init fetches the last block of the file, where a ZIP keeps its directory end
+// record, and learns the size of the file from the response.
+func (r *httpRangeReader) init() error {
+	resp, err := r.get(fmt.Sprintf("bytes=-%d", remoteZipBlockSize))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || total < 0 {
+		return &RangeNotSupportedError{URL: r.url}
+	}
+	r.tail, err = io.ReadAll(io.LimitReader(resp.Body, remoteZipBlockSize))
+	if err != nil {
+		return err
+	}
+	// The response must be the requested suffix, up to the end of the file, for
+	// ReadAt to serve the tail from it.
+	if start != max(total-remoteZipBlockSize, 0) || int64(len(r.tail)) != total-start {
+		return fmt.Errorf("fastimage: %s answered the last %d bytes with %d bytes from offset %d of %d: %w",
+			r.url, remoteZipBlockSize, len(r.tail), start, total, io.ErrUnexpectedEOF)
+	}
+	r.size, r.tailOffset = total, start
+	return nil
+}
+
+// get sends a GET request for the byte range rangeSpec and checks that the server
+// answered it with a 206 response.
+func (r *httpRangeReader) get(rangeSpec string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range r.header {
+		req.Header[name] = slices.Clone(values)
+	}
+	req.Header.Set("Range", rangeSpec)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp, nil
+	case http.StatusOK:
+		resp.Body.Close()
+		return nil, &RangeNotSupportedError{URL: r.url}
+	}
+	resp.Body.Close()
+	return nil, &HTTPStatusError{URL: r.url, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+func (r *httpRangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("fastimage: negative offset %d", off)
+	}
+	n := 0
+	for n < len(p) && off+int64(n) < r.size {
+		pos := off + int64(n)
+		if pos >= r.tailOffset && pos-r.tailOffset < int64(len(r.tail)) {
+			n += copy(p[n:], r.tail[pos-r.tailOffset:])
+			continue
+		}
+		index := pos / remoteZipBlockSize
+		block, err := r.block(index)
+		if err != nil {
+			return n, err
+		}
+		if pos < r.tailOffset {
+			// Stop at the tail, which may start inside the last block.
+			block = block[:min(int64(len(block)), r.tailOffset-index*remoteZipBlockSize)]
+		}
+		if pos-index*remoteZipBlockSize >= int64(len(block)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(p[n:], block[pos-index*remoteZipBlockSize:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the block at index, fetching it unless it is kept.
+func (r *httpRangeReader) block(index int64) ([]byte, error) {
+	r.mu.Lock()
+	block, ok := r.blocks[index]
+	r.mu.Unlock()
+	if ok {
+		return block, nil
+	}
+
+	start := index * remoteZipBlockSize
+	end := min(start+remoteZipBlockSize, r.size) - 1
+	resp, err := r.get(fmt.Sprintf("bytes=%d-%d", start, end))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// A response for another part of the file, or of another version of it, would
+	// be kept as this block.
+	if got, total, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || got != start || total != r.size {
+		return nil, fmt.Errorf("fastimage: %s answered bytes %d-%d of %d with Content-Range %q",
+			r.url, start, end, r.size, resp.Header.Get("Content-Range"))
+	}
+	block, err = io.ReadAll(io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(block)) != end-start+1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.blocks[index]; !ok {
+		r.blocks[index] = block
+		r.order = append(r.order, index)
+		if len(r.order) > remoteZipMaxBlocks {
+			delete(r.blocks, r.order[0])
+			r.order = r.order[1:]
+		}
+	}
+	return block, nil
+}
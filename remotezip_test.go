@@ -0,0 +1,173 @@
+package fastimage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScanRemoteZip(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	add := func(name string, method uint16, data []byte) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	// A large incompressible member sits between the images, so that fetching the
+	// whole archive would be noticed.
+	noise := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(noise)
+	add("stored.gif", zip.Store, mustReadFile(t, "testdata/test.gif"))
+	add("noise.bin", zip.Store, noise)
+	add("images/deflated.png", zip.Deflate, mustReadFile(t, "testdata/pass-1_s.png"))
+	add("images/letter.jpg", zip.Deflate, mustReadFile(t, "testdata/letter_T.jpg"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := archive.Bytes()
+
+	var sent atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" || r.URL.Query().Get("ranges") == "no" {
+			sent.Add(int64(len(data)))
+			w.Write(data)
+			return
+		}
+		cw := &countingResponseWriter{ResponseWriter: w, n: &sent}
+		http.ServeContent(cw, r, "archive.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	got := make(map[string]ScanResult)
+	for r := range ScanRemoteZip(context.Background(), server.URL+"/archive.zip", RemoteZipOptions{}) {
+		if r.Err != nil {
+			t.Fatalf("scan %s: %v", r.Path, r.Err)
+		}
+		got[r.Path] = r
+	}
+	want := map[string]Info{
+		"stored.gif":          {GIF, 60, 40},
+		"noise.bin":           {},
+		"images/deflated.png": {PNG, 90, 60},
+		"images/letter.jpg":   {JPEG, 52, 54},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(got), len(want), got)
+	}
+	for path, info := range want {
+		if got[path].Info != info {
+			t.Errorf("%s = %+v, want %+v", path, got[path].Info, info)
+		}
+	}
+	if got["noise.bin"].Size != int64(len(noise)) {
+		t.Errorf("noise.bin size = %d, want %d", got["noise.bin"].Size, len(noise))
+	}
+	if n := sent.Load(); n > int64(len(data))/4 {
+		t.Errorf("fetched %d of %d bytes", n, len(data))
+	}
+
+	var results []ScanResult
+	for r := range ScanRemoteZip(context.Background(), server.URL+"/archive.zip?ranges=no", RemoteZipOptions{}) {
+		results = append(results, r)
+	}
+	var rangeErr *RangeNotSupportedError
+	if len(results) != 1 || !errors.As(results[0].Err, &rangeErr) {
+		t.Fatalf("unexpected results without range support: %+v", results)
+	}
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+func TestScanRemoteZipShortTail(t *testing.T) {
+	data := make([]byte, 200<<10)
+	for _, c := range []struct {
+		Name  string
+		Range func(total int) string
+		Body  int
+	}{
+		{"short body", func(total int) string { return fmt.Sprintf("bytes %d-%d/%d", total-64<<10, total-1, total) }, 4096},
+		{"short range", func(total int) string { return fmt.Sprintf("bytes %d-%d/%d", total-4096, total-1, total) }, 4096},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", c.Range(len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[len(data)-c.Body:])
+		}))
+		var results []ScanResult
+		for r := range ScanRemoteZip(context.Background(), server.URL+"/archive.zip", RemoteZipOptions{}) {
+			results = append(results, r)
+		}
+		server.Close()
+		if len(results) != 1 || !errors.Is(results[0].Err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: unexpected results %+v", c.Name, results)
+		}
+	}
+}
+
+func TestScanRemoteZipBlockRange(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, data := range map[string][]byte{"test.gif": mustReadFile(t, "testdata/test.gif"), "noise.bin": make([]byte, 200<<10)} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := archive.Bytes()
+
+	for _, c := range []struct {
+		Name  string
+		Range func(start, end, total int) string
+	}{
+		{"other start", func(start, end, total int) string { return fmt.Sprintf("bytes %d-%d/%d", start+1, end+1, total) }},
+		{"other total", func(start, end, total int) string { return fmt.Sprintf("bytes %d-%d/%d", start, end, total+1) }},
+		{"missing", func(start, end, total int) string { return "" }},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var start, end int
+			if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+				// The tail request, which is answered correctly.
+				http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(data))
+				return
+			}
+			w.Header().Set("Content-Range", c.Range(start, end, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[start : end+1])
+		}))
+		var failed int
+		for r := range ScanRemoteZip(context.Background(), server.URL+"/archive.zip", RemoteZipOptions{}) {
+			if r.Err != nil {
+				failed++
+			}
+		}
+		server.Close()
+		if failed == 0 {
+			t.Errorf("%s: expected an error", c.Name)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package fastimage
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRobotsBytes bounds the part of a robots.txt file that is read.
+	maxRobotsBytes = 512 << 10
+	// robotsTimeout bounds the robots.txt request, which is shared by every probe of
+	// the origin and so does not end with the probe that started it.
+	robotsTimeout = 10 * time.Second
+)
+
+// robotsRules are the rules of a robots.txt group that apply to the prober.
+type robotsRules struct {
+	allow      []string
+	disallow   []string
+	crawlDelay time.Duration
+}
+
+// allowed reports whether path, including its query, may be fetched. The longest
+// matching rule wins, and Allow wins ties.
+func (r *robotsRules) allowed(path string) bool {
+	best, allow := -1, true
+	for _, pattern := range r.disallow {
+		if len(pattern) > best && matchRobots(pattern, path) {
+			best, allow = len(pattern), false
+		}
+	}
+	for _, pattern := range r.allow {
+		if len(pattern) >= best && matchRobots(pattern, path) {
+			best, allow = len(pattern), true
+		}
+	}
+	return allow
+}
+
+// matchRobots matches path against a robots.txt path pattern, where * matches any
+// sequence of characters and a trailing $ anchors the pattern at the end of path.
+func matchRobots(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path, part)
+		}
+		j := strings.Index(path, part)
+		if j < 0 {
+			return false
+		}
+		path = path[j+len(part):]
+	}
+	return !anchored || path == ""
+}
+
+// parseRobots returns the rules of the group that applies to userAgent: the group
+// naming its product token, or the * group when none does.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	product, _, _ := strings.Cut(userAgent, "/")
+	product = strings.ToLower(strings.TrimSpace(product))
+
+	var specific, wildcard *robotsRules
+	var group []*robotsRules // the groups the current user-agent lines select
+	var agents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+			group = group[:0]
+			for _, agent := range agents {
+				switch {
+				case agent == "*":
+					if wildcard == nil {
+						wildcard = &robotsRules{}
+					}
+					group = append(group, wildcard)
+				case product != "" && agent == product:
+					if specific == nil {
+						specific = &robotsRules{}
+					}
+					group = append(group, specific)
+				}
+			}
+			continue
+		}
+		inRules = true
+		for _, rules := range group {
+			switch key {
+			case "allow":
+				if value != "" {
+					rules.allow = append(rules.allow, value)
+				}
+			case "disallow":
+				if value != "" {
+					rules.disallow = append(rules.disallow, value)
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	switch {
+	case specific != nil:
+		return specific
+	case wildcard != nil:
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// robotsCache fetches the robots.txt of an origin once and keeps its rules.
+type robotsCache struct {
+	once  sync.Once
+	rules *robotsRules
+}
+
+// get returns the rules for the origin of rawURL, fetching them on first use. A
+// robots.txt answered with a server error disallows everything, as the origin may
+// be unable to say what it allows; one that is missing or cannot be fetched allows
+// everything.
+func (c *robotsCache) get(ctx context.Context, w *originWorker, rawURL string) *robotsRules {
+	c.once.Do(func() {
+		c.rules = &robotsRules{}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), robotsTimeout)
+		defer cancel()
+		robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+		req, err := w.newRequest(ctx, robotsURL.String())
+		if err != nil {
+			return
+		}
+		if err := w.pacer.wait(ctx); err != nil {
+			return
+		}
+		resp, err := w.client.Do(req)
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			c.rules = &robotsRules{disallow: []string{"/"}}
+			return
+		}
+		if resp.StatusCode != http.StatusOK {
+			return
+		}
+		userAgent := req.Header.Get("User-Agent")
+		if userAgent == "" {
+			userAgent = "Go-http-client"
+		}
+		c.rules = parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), userAgent)
+		w.pacer.atLeast(c.rules.crawlDelay)
+	})
+	return c.rules
+}
+
+// checkRobots returns a *RobotsDisallowedError when robots.txt forbids rawURL.
+func (w *originWorker) checkRobots(ctx context.Context, rawURL string) error {
+	if !w.options.RespectRobots {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if !w.robots.get(ctx, w, rawURL).allowed(u.RequestURI()) {
+		return &RobotsDisallowedError{URL: rawURL}
+	}
+	return nil
+}
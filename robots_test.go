@@ -0,0 +1,48 @@
+package fastimage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	const robots = `# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public*.png$
+Crawl-delay: 2
+
+User-agent: crawler
+User-agent: other
+Disallow: /
+Allow: /images/
+Crawl-delay: 0.5
+`
+	cases := []struct {
+		UserAgent string
+		Path      string
+		Allowed   bool
+	}{
+		{"Go-http-client/1.1", "/images/a.png", true},
+		{"Go-http-client/1.1", "/private/a.png", false},
+		{"Go-http-client/1.1", "/private/public1.png", true},
+		{"Go-http-client/1.1", "/private/public1.png?x=1", false},
+		{"Crawler/2.0", "/images/a.png", true},
+		{"crawler/2.0", "/private/a.png", false},
+		{"other", "/a.png", false},
+	}
+	for _, c := range cases {
+		rules := parseRobots(strings.NewReader(robots), c.UserAgent)
+		if got := rules.allowed(c.Path); got != c.Allowed {
+			t.Errorf("allowed(%q) for %q = %v, want %v", c.Path, c.UserAgent, got, c.Allowed)
+		}
+	}
+
+	if got := parseRobots(strings.NewReader(robots), "crawler").crawlDelay; got != 500*time.Millisecond {
+		t.Errorf("unexpected crawl delay: %v", got)
+	}
+	if got := parseRobots(strings.NewReader(robots), "anyone").crawlDelay; got != 2*time.Second {
+		t.Errorf("unexpected wildcard crawl delay: %v", got)
+	}
+}
@@ -0,0 +1,149 @@
+package fastimage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// ScanResult is the outcome of probing one file of a directory scan.
+type ScanResult struct {
+	// Path is the slash-separated path of the file relative to the scanned root.
+	Path string `json:"path"`
+	// Size is the file size in bytes.
+	Size int64 `json:"size"`
+	// Info is zero, with Type Unknown, for files that are not images.
+	Info
+	// Err is set when the file or a directory could not be read. It is encoded to
+	// JSON as its message.
+	Err error `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes r with Err as a string, which error values would not be.
+func (r ScanResult) MarshalJSON() ([]byte, error) {
+	type scanResult ScanResult
+	return json.Marshal(struct {
+		scanResult
+		Err string `json:"error,omitempty"`
+	}{scanResult(r), errorMessage(r.Err)})
+}
+
+// ScanOptions controls ScanFS and ScanDir.
+type ScanOptions struct {
+	// Concurrency is the number of files probed at once. Zero or negative uses the
+	// number of CPUs.
+	Concurrency int
+	// SkipUnknown drops files that are not images instead of reporting them with
+	// Type Unknown.
+	SkipUnknown bool
+}
+
+// ScanDir probes every regular file below dir. See ScanFS.
+func ScanDir(ctx context.Context, dir string, options ScanOptions) iter.Seq[ScanResult] {
+	return ScanFS(ctx, os.DirFS(dir), options)
+}
+
+// ScanFS walks fsys and probes its regular files concurrently, yielding a result for
+// each file in the order the probes finish. Directories that cannot be read are
+// yielded with their error. Stopping the iteration, or cancelling ctx, stops the
+// walk and the probes in flight.
+func ScanFS(ctx context.Context, fsys fs.FS, options ScanOptions) iter.Seq[ScanResult] {
+	return scanFS(ctx, fsys, options, 0)
+}
+
+// scanFS is ScanFS reading at most maxBytes of each file when maxBytes is positive.
+func scanFS(ctx context.Context, fsys fs.FS, options ScanOptions, maxBytes int64) iter.Seq[ScanResult] {
+	if options.Concurrency < 1 {
+		options.Concurrency = runtime.NumCPU()
+	}
+	return func(yield func(ScanResult) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		paths := make(chan string)
+		results := make(chan ScanResult)
+		send := func(r ScanResult) bool {
+			select {
+			case results <- r:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var wg sync.WaitGroup
+		for range options.Concurrency {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for path := range paths {
+					r := scanFile(fsys, path, maxBytes)
+					if r.Err == nil && r.Type == Unknown && options.SkipUnknown {
+						continue
+					}
+					if !send(r) {
+						return
+					}
+				}
+			}()
+		}
+		go func() {
+			fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					if !send(ScanResult{Path: path, Err: err}) {
+						return fs.SkipAll
+					}
+					return nil
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				select {
+				case paths <- path:
+					return nil
+				case <-ctx.Done():
+					return fs.SkipAll
+				}
+			})
+			close(paths)
+			wg.Wait()
+			close(results)
+		}()
+
+		for r := range results {
+			if !yield(r) {
+				cancel()
+				// Let the walker and the workers see the cancellation and exit.
+				for range results {
+				}
+				return
+			}
+		}
+	}
+}
+
+// scanFile probes the file at path in fsys, reading at most maxBytes of it when
+// maxBytes is positive.
+func scanFile(fsys fs.FS, path string, maxBytes int64) ScanResult {
+	r := ScanResult{Path: path}
+	f, err := fsys.Open(path)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil {
+		r.Size = fi.Size()
+	}
+	var rd io.Reader = f
+	if maxBytes > 0 {
+		rd = io.LimitReader(f, maxBytes)
+	}
+	r.Info, r.Err = GetInfoReader(rd)
+	return r
+}
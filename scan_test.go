@@ -0,0 +1,96 @@
+package fastimage
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestScanFS(t *testing.T) {
+	gif, err := os.ReadFile("testdata/test.gif")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	png, err := os.ReadFile("testdata/pass-1_s.png")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	fsys := fstest.MapFS{
+		"a.gif":          {Data: gif},
+		"sub/b.png":      {Data: png},
+		"sub/deep/c.txt": {Data: []byte("not an image")},
+		"sub/deep/d.gif": {Data: gif},
+		"sub/deep/empty": {Mode: os.ModeDir},
+	}
+
+	got := make(map[string]ScanResult)
+	for r := range ScanFS(context.Background(), fsys, ScanOptions{Concurrency: 2}) {
+		if r.Err != nil {
+			t.Fatalf("scan %s: %v", r.Path, r.Err)
+		}
+		got[r.Path] = r
+	}
+	want := map[string]Info{
+		"a.gif":          {GIF, 60, 40},
+		"sub/b.png":      {PNG, 90, 60},
+		"sub/deep/c.txt": {},
+		"sub/deep/d.gif": {GIF, 60, 40},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected results: %+v", got)
+	}
+	for path, info := range want {
+		if got[path].Info != info {
+			t.Errorf("%s: got %+v want %+v", path, got[path].Info, info)
+		}
+	}
+	if got["a.gif"].Size != int64(len(gif)) {
+		t.Errorf("unexpected size: %d", got["a.gif"].Size)
+	}
+
+	n := 0
+	for r := range ScanFS(context.Background(), fsys, ScanOptions{SkipUnknown: true}) {
+		if r.Type == Unknown {
+			t.Errorf("non-image %s was not skipped", r.Path)
+		}
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("iteration did not stop")
+	}
+}
+
+func TestScanDir(t *testing.T) {
+	found := false
+	for r := range ScanDir(context.Background(), "testdata", ScanOptions{SkipUnknown: true}) {
+		if r.Err != nil || r.Type == Unknown {
+			t.Errorf("unexpected result for %s: %+v", r.Path, r)
+		}
+		if r.Path == "letter_T.jpg" {
+			found = r.Info == Info{JPEG, 52, 54}
+		}
+	}
+	if !found {
+		t.Fatalf("letter_T.jpg was not scanned")
+	}
+}
+
+func TestScanResultJSON(t *testing.T) {
+	cases := []struct {
+		Result ScanResult
+		JSON   string
+	}{
+		{ScanResult{Path: "a.gif", Size: 10, Info: Info{GIF, 60, 40}}, `{"path":"a.gif","size":10,"type":3,"width":60,"height":40}`},
+		{ScanResult{Path: "b", Err: fs.ErrPermission}, `{"path":"b","size":0,"type":0,"width":0,"height":0,"error":"permission denied"}`},
+	}
+	for _, c := range cases {
+		data, err := json.Marshal(c.Result)
+		if err != nil || string(data) != c.JSON {
+			t.Errorf("json.Marshal(%+v) = %s, %v, want %s", c.Result, data, err, c.JSON)
+		}
+	}
+}
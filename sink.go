@@ -0,0 +1,168 @@
+package fastimage
+
+import (
+	"container/list"
+	"context"
+	"iter"
+	"sync"
+)
+
+// Sink receives the results of ProbeToSink, for example to write them to a
+// database or a message queue.
+type Sink interface {
+	// Put stores one result. It is called from a single goroutine, in the order the
+	// probes finish. An error stops the run.
+	Put(ctx context.Context, result GetHTTPImageResult) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(ctx context.Context, result GetHTTPImageResult) error
+
+// Put calls f(ctx, result).
+func (f SinkFunc) Put(ctx context.Context, result GetHTTPImageResult) error {
+	return f(ctx, result)
+}
+
+// SinkOptions controls ProbeToSink.
+type SinkOptions struct {
+	GetHTTPImageOptions
+	// Buffer is the number of finished results that may wait for the sink. Once it
+	// is full, no new probe starts until the sink catches up. Zero or negative uses
+	// MaxConcurrentConnections.
+	Buffer int
+}
+
+// ProbeToSink probes the URLs yielded by urls and puts each result into sink as soon
+// as it is done, so runs over hundreds of millions of URLs never hold their results
+// in memory. URLs are taken from urls only as probes start: at most
+// MaxConcurrentConnections plus Buffer URLs are being probed or have results waiting
+// for the sink at any time, and a slow sink holds up new probes rather than letting
+// results pile up. Probes behave as with StartHTTPImageBatch. The per-origin
+// state, such as range support, is kept for the 1024 most recently used origins;
+// past that, the state and idle connections of origins with no probe in flight are
+// dropped, so runs over many origins do not grow without bound.
+//
+// ProbeToSink returns the first error of sink, or the error of ctx when it ends,
+// once the probes in flight have stopped. Their results are then discarded, except
+// that results already probed when ctx ends may still reach the sink.
+func ProbeToSink(ctx context.Context, urls iter.Seq[string], sink Sink, options SinkOptions) error {
+	httpOptions := normalizeHTTPImageOptions(options.GetHTTPImageOptions)
+	if options.Buffer < 1 {
+		options.Buffer = httpOptions.MaxConcurrentConnections
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var gate pauseGate
+	global := make(chan struct{}, httpOptions.MaxConcurrentConnections)
+	workers := &sinkWorkers{
+		max:     sinkMaxOrigins,
+		options: httpOptions,
+		global:  global,
+		gate:    &gate,
+		byName:  make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	workerFor := workers.get
+	defer workers.close()
+
+	// A probe holds its slot until the sink takes its result, which is what makes a
+	// slow sink stop the intake of URLs. Sends on results never block.
+	slots := make(chan struct{}, httpOptions.MaxConcurrentConnections+options.Buffer)
+	results := make(chan GetHTTPImageResult, cap(slots))
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(results)
+		}()
+		for rawURL := range urls {
+			if acquire(ctx, slots) != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var result GetHTTPImageResult
+				if origin, err := originOf(rawURL); err != nil {
+					result = GetHTTPImageResult{HTTPImageInfo: HTTPImageInfo{URL: rawURL}, Error: &ProbeError{URL: rawURL, Err: err}}
+				} else {
+					result = probeURL(ctx, rawURL, workerFor(origin), workerFor, httpOptions)
+				}
+				results <- result
+			}()
+		}
+	}()
+
+	var err error
+	for result := range results {
+		release(slots)
+		if err != nil {
+			continue
+		}
+		if err = sink.Put(ctx, result); err != nil {
+			// Stop the probes; the loop drains what they already sent.
+			cancel()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// sinkMaxOrigins is the number of origins whose workers ProbeToSink keeps once
+// they are idle.
+const sinkMaxOrigins = 1024
+
+// sinkWorkers holds the origin workers of a ProbeToSink run, dropping the least
+// recently used idle ones past max.
+type sinkWorkers struct {
+	max     int
+	options GetHTTPImageOptions
+	global  chan struct{}
+	gate    *pauseGate
+
+	mu     sync.Mutex
+	byName map[string]*list.Element // of lru, by origin
+	lru    *list.List               // *sinkWorker values, most recently used first
+}
+
+type sinkWorker struct {
+	origin string
+	worker *originWorker
+}
+
+// get returns the worker of origin, creating it when there is none.
+func (s *sinkWorkers) get(origin string) *originWorker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.byName[origin]; ok {
+		s.lru.MoveToFront(e)
+		return e.Value.(*sinkWorker).worker
+	}
+	w := newOriginWorker(s.options, s.global, s.gate)
+	w.workerFor = s.get
+	s.byName[origin] = s.lru.PushFront(&sinkWorker{origin: origin, worker: w})
+	// Evict from the least recently used end, skipping workers with probes in
+	// flight, which the limit of concurrent probes keeps few.
+	for e := s.lru.Back(); e != nil && s.lru.Len() > s.max; {
+		prev := e.Prev()
+		if sw := e.Value.(*sinkWorker); sw.worker != w && sw.worker.active.Load() == 0 && sw.worker.waiting.Load() == 0 {
+			s.lru.Remove(e)
+			delete(s.byName, sw.origin)
+			sw.worker.client.CloseIdleConnections()
+		}
+		e = prev
+	}
+	return w
+}
+
+// close closes the idle connections of all workers.
+func (s *sinkWorkers) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		e.Value.(*sinkWorker).worker.client.CloseIdleConnections()
+	}
+}
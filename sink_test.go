@@ -0,0 +1,126 @@
+package fastimage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProbeToSink(t *testing.T) {
+	server, _ := newCountingServer(t, mustReadFile(t, "testdata/pass-1_s.png"))
+	defer server.Close()
+
+	urls := []string{server.URL + "/a.png", server.URL + "/b.png", "::not a url", server.URL + "/c.png"}
+	var got []string
+	sink := SinkFunc(func(ctx context.Context, r GetHTTPImageResult) error {
+		switch {
+		case r.Error != nil:
+			var probeErr *ProbeError
+			if !errors.As(r.Error, &probeErr) || probeErr.URL != r.URL {
+				t.Errorf("%s: unexpected error %v", r.URL, r.Error)
+			}
+		case r.Info.Type != PNG:
+			t.Errorf("%s: got %+v", r.URL, r.Info)
+		}
+		got = append(got, r.URL)
+		return nil
+	})
+	if err := ProbeToSink(context.Background(), sliceSeq(urls), sink, SinkOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := append([]string(nil), urls...)
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("sink got %v, want %v", got, want)
+	}
+}
+
+func TestProbeToSinkBackpressure(t *testing.T) {
+	server, _ := newCountingServer(t, mustReadFile(t, "testdata/pass-1_s.png"))
+	defer server.Close()
+
+	var pulled atomic.Int32
+	urls := func(yield func(string) bool) {
+		for i := 0; ; i++ {
+			pulled.Add(1)
+			if !yield(fmt.Sprintf("%s/%d.png", server.URL, i)) {
+				return
+			}
+		}
+	}
+	const limit, buffer, stopAfter = 2, 3, 20
+	var put int
+	sink := SinkFunc(func(ctx context.Context, r GetHTTPImageResult) error {
+		if r.Error != nil {
+			return r.Error
+		}
+		// Every result so far has left the buffer, so at most limit probes plus
+		// the buffer can have been started ahead of the sink.
+		if n := int(pulled.Load()); n > put+1+limit+buffer+1 {
+			t.Errorf("%d URLs pulled with %d results in the sink", n, put+1)
+		}
+		if put++; put == stopAfter {
+			return errStopSink
+		}
+		return nil
+	})
+	options := SinkOptions{GetHTTPImageOptions: GetHTTPImageOptions{MaxConcurrentConnections: limit}, Buffer: buffer}
+	if err := ProbeToSink(context.Background(), urls, sink, options); err != errStopSink {
+		t.Fatalf("got error %v, want the sink error", err)
+	}
+	if put != stopAfter {
+		t.Errorf("sink called %d times after its error, want %d", put, stopAfter)
+	}
+}
+
+func TestProbeToSinkCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink := SinkFunc(func(ctx context.Context, r GetHTTPImageResult) error { return nil })
+	if err := ProbeToSink(ctx, sliceSeq([]string{"http://example.invalid/a.png"}), sink, SinkOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
+
+var errStopSink = errors.New("stop")
+
+func sliceSeq(s []string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, v := range s {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+func TestSinkWorkersEvictIdle(t *testing.T) {
+	workers := &sinkWorkers{
+		max:     2,
+		options: GetHTTPImageOptions{MaxConcurrentConnections: 1, ConcurrentRequestsReusable: 1},
+		global:  make(chan struct{}, 1),
+		gate:    new(pauseGate),
+		byName:  make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	defer workers.close()
+	busy := workers.get("http://a")
+	busy.active.Add(1)
+	idle := workers.get("http://b")
+	workers.get("http://c")
+	if workers.lru.Len() != 2 {
+		t.Fatalf("kept %d workers, want 2", workers.lru.Len())
+	}
+	if workers.get("http://a") != busy {
+		t.Error("busy worker was evicted")
+	}
+	if workers.get("http://b") == idle {
+		t.Error("idle worker was not evicted")
+	}
+}
@@ -0,0 +1,132 @@
+package fastimage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// healthWindow is the number of latest probes OriginState.ErrorRate covers.
+const healthWindow = 100
+
+// BatchSnapshot is a point-in-time view of the state of an HTTPImageBatch.
+type BatchSnapshot struct {
+	// Paused reports whether the batch is paused.
+	Paused bool `json:"paused"`
+	// InFlight is the number of probes holding one of the MaxConcurrentConnections
+	// slots shared by all origins, including probes still waiting for a slot of
+	// their origin.
+	InFlight int `json:"in_flight"`
+	// Limit is MaxConcurrentConnections.
+	Limit int `json:"limit"`
+	// Origins holds the state of each origin, sorted by origin.
+	Origins []OriginState `json:"origins"`
+}
+
+// OriginState is a point-in-time view of how a batch treats one origin, for telling
+// why probes of the origin are slow or throttled.
+type OriginState struct {
+	// Origin is the scheme and host of the origin, such as https://example.com.
+	Origin string `json:"origin"`
+	// RangeSupported reports that the origin answered a range request with a 206
+	// response, which raises Limit from ConcurrentRequestsNonReusable to
+	// ConcurrentRequestsReusable.
+	RangeSupported bool `json:"range_supported"`
+	// Limit is the number of probes of the origin that may currently run at once.
+	Limit int `json:"limit"`
+	// InFlight is the number of probes of the origin holding a connection slot.
+	InFlight int `json:"in_flight"`
+	// Waiting is the number of probes of the origin waiting for a connection slot,
+	// either of the origin or of the global limit.
+	Waiting int `json:"waiting"`
+	// Interval is the minimum time between the starts of two requests to the
+	// origin, from RequestsPerSecondPerOrigin or a robots.txt Crawl-delay, or zero
+	// when requests are not paced.
+	Interval time.Duration `json:"interval"`
+	// Probes and Failures count the finished probes of the origin. Cancelled probes
+	// are not counted.
+	Probes   int64 `json:"probes"`
+	Failures int64 `json:"failures"`
+	// ErrorRate is the share of failures among the latest 100 probes, from 0 to 1.
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// Snapshot returns the current state of the batch and of each of its origins. It is
+// safe to call at any time, for example from an expvar.Func or a debug handler.
+func (b *HTTPImageBatch) Snapshot() BatchSnapshot {
+	snapshot := BatchSnapshot{
+		Paused:   b.gate.isPaused(),
+		InFlight: len(b.global),
+		Limit:    cap(b.global),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	snapshot.Origins = make([]OriginState, 0, len(b.origins))
+	for _, origin := range b.origins {
+		w := b.workers[origin]
+		state := OriginState{
+			Origin:         origin,
+			RangeSupported: w.limiter.rangeSupported.Load(),
+			Limit:          cap(w.limiter.base),
+			InFlight:       len(w.limiter.base) + len(w.limiter.extra),
+			Waiting:        int(w.waiting.Load()),
+			Interval:       w.pacer.currentInterval(),
+		}
+		if state.RangeSupported {
+			state.Limit += cap(w.limiter.extra)
+		}
+		state.Probes, state.Failures, state.ErrorRate = w.health.snapshot()
+		snapshot.Origins = append(snapshot.Origins, state)
+	}
+	slices.SortFunc(snapshot.Origins, func(a, b OriginState) int {
+		return cmp.Compare(a.Origin, b.Origin)
+	})
+	return snapshot
+}
+
+// originHealth keeps the outcomes of the probes of an origin.
+type originHealth struct {
+	mu       sync.Mutex
+	recent   [healthWindow]bool // ring of the latest outcomes, true for failures
+	n        int                // number of outcomes in recent
+	next     int                // index in recent of the next outcome
+	probes   int64
+	failures int64
+}
+
+// record counts the outcome of a probe that ended with err. Cancelled probes, such
+// as hedged mirror probes that lost, are not counted.
+func (h *originHealth) record(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	failed := err != nil
+	h.probes++
+	if failed {
+		h.failures++
+	}
+	h.recent[h.next] = failed
+	h.next = (h.next + 1) % healthWindow
+	h.n = min(h.n+1, healthWindow)
+}
+
+// snapshot returns the probe and failure counts and the recent error rate.
+func (h *originHealth) snapshot() (probes, failures int64, errorRate float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.n > 0 {
+		recentFailures := 0
+		for _, failed := range h.recent[:h.n] {
+			if failed {
+				recentFailures++
+			}
+		}
+		errorRate = float64(recentFailures) / float64(h.n)
+	}
+	return h.probes, h.failures, errorRate
+}
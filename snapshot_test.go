@@ -0,0 +1,84 @@
+package fastimage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPImageBatchSnapshot(t *testing.T) {
+	data := mustReadFile(t, "testdata/pass-1_s.png")
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		if strings.HasSuffix(r.URL.Path, "missing.png") {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "image.png", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/a.png", server.URL + "/b.png", server.URL + "/missing.png"}
+	batch := StartHTTPImageBatch(context.Background(), urls, GetHTTPImageOptions{
+		ConcurrentRequestsNonReusable: 1,
+		ConcurrentRequestsReusable:    4,
+		RequestsPerSecondPerOrigin:    1000,
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	var snapshot BatchSnapshot
+	for {
+		snapshot = batch.Snapshot()
+		if len(snapshot.Origins) == 1 && snapshot.Origins[0].InFlight == 1 && snapshot.Origins[0].Waiting == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("batch did not queue behind the origin limit: %+v", snapshot)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	origin := snapshot.Origins[0]
+	if snapshot.Paused || snapshot.InFlight != 3 || snapshot.Limit != MAX_CONCURRENT_CONNECTIONS_GLOBAL_DEFAULT {
+		t.Errorf("unexpected batch state %+v", snapshot)
+	}
+	if origin.Origin != server.URL || origin.RangeSupported || origin.Limit != 1 || origin.Interval != time.Millisecond {
+		t.Errorf("unexpected origin state before any response %+v", origin)
+	}
+
+	batch.Pause()
+	if !batch.Snapshot().Paused {
+		t.Error("paused batch reported as running")
+	}
+	batch.Resume()
+	close(unblock)
+	batch.Wait()
+
+	origin = batch.Snapshot().Origins[0]
+	if !origin.RangeSupported || origin.Limit != 4 || origin.InFlight != 0 || origin.Waiting != 0 {
+		t.Errorf("unexpected origin state after the batch %+v", origin)
+	}
+	if origin.Probes != 3 || origin.Failures != 1 || origin.ErrorRate < 0.33 || origin.ErrorRate > 0.34 {
+		t.Errorf("unexpected origin counts %+v", origin)
+	}
+}
+
+func TestOriginHealth(t *testing.T) {
+	var h originHealth
+	h.record(context.Canceled)
+	for i := range 150 {
+		var err error
+		if i < 50 {
+			err = context.DeadlineExceeded
+		}
+		h.record(err)
+	}
+	probes, failures, rate := h.snapshot()
+	if probes != 150 || failures != 50 || rate != 0 {
+		t.Fatalf("snapshot() = %d, %d, %v; want the 50 early failures out of the window", probes, failures, rate)
+	}
+}
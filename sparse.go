@@ -0,0 +1,272 @@
+package fastimage
+
+// hintWindow is the number of bytes requested when a format points at an offset
+// but not at the size of the structure found there.
+const hintWindow = 1024
+
+// maxSparseSpan bounds the zero-filled buffer built from non-contiguous chunks.
+const maxSparseSpan = 4 << 20
+
+// sparseFile holds the byte ranges of a file that have been downloaded so far.
+type sparseFile struct {
+	chunks []fileChunk // sorted by offset, neither overlapping nor adjacent
+	size   int64       // total file size, or -1 when unknown
+}
+
+type fileChunk struct {
+	off  int64
+	data []byte
+}
+
+func (c fileChunk) end() int64 {
+	return c.off + int64(len(c.data))
+}
+
+// add records data read at off, merging it with overlapping or adjacent chunks.
+func (f *sparseFile) add(off int64, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	cur := fileChunk{off: off, data: data}
+	chunks := make([]fileChunk, 0, len(f.chunks)+1)
+	for _, c := range f.chunks {
+		if c.end() < cur.off || c.off > cur.end() {
+			chunks = append(chunks, c)
+			continue
+		}
+		start := min(c.off, cur.off)
+		buf := make([]byte, max(c.end(), cur.end())-start)
+		copy(buf[c.off-start:], c.data)
+		copy(buf[cur.off-start:], cur.data)
+		cur = fileChunk{off: start, data: buf}
+	}
+	i := len(chunks)
+	for i > 0 && chunks[i-1].off > cur.off {
+		i--
+	}
+	chunks = append(chunks, fileChunk{})
+	copy(chunks[i+1:], chunks[i:])
+	chunks[i] = cur
+	f.chunks = chunks
+}
+
+// at returns the n bytes at off, or nil when they have not all been downloaded.
+func (f *sparseFile) at(off, n int64) []byte {
+	for _, c := range f.chunks {
+		if off >= c.off && off+n <= c.end() {
+			return c.data[off-c.off : off-c.off+n]
+		}
+	}
+	return nil
+}
+
+// prefix returns the contiguous bytes downloaded from the start of the file.
+func (f *sparseFile) prefix() []byte {
+	if len(f.chunks) == 0 || f.chunks[0].off != 0 {
+		return nil
+	}
+	return f.chunks[0].data
+}
+
+// bytes returns a buffer GetInfo can parse. Chunks after the prefix are laid out at
+// their file offsets with zeroed gaps, except for formats whose parsers can be given
+// the far chunk directly: TIFF gets its first IFD relocated behind the header and
+// ISO-BMFF files keep the top-level boxes that were downloaded whole.
+func (f *sparseFile) bytes() []byte {
+	p := f.prefix()
+	if len(f.chunks) <= 1 || len(p) < 8 {
+		return p
+	}
+
+	switch {
+	case hasTIFFBig(p):
+		return f.tiffBytes(bigEndian)
+	case hasTIFFLittle(p):
+		return f.tiffBytes(littleEndian)
+	case hasISOBMFF(p):
+		return f.isoBMFFBytes()
+	}
+
+	span := f.chunks[len(f.chunks)-1].end()
+	if span > maxSparseSpan {
+		return p
+	}
+	buf := make([]byte, span)
+	for _, c := range f.chunks {
+		copy(buf[c.off:], c.data)
+	}
+	return buf
+}
+
+func (f *sparseFile) tiffBytes(order byteOrder) []byte {
+	p := f.prefix()
+	ifd := int64(order.Uint32(p[4:8]))
+	if ifd < int64(len(p)) {
+		return p
+	}
+	for _, c := range f.chunks[1:] {
+		if ifd < c.off || ifd >= c.end() {
+			continue
+		}
+		buf := make([]byte, 0, len(p)+int(c.end()-ifd))
+		buf = append(buf, p...)
+		buf = append(buf, c.data[ifd-c.off:]...)
+		order.PutUint32(buf[4:8], uint32(len(p)))
+		return buf
+	}
+	return p
+}
+
+// isoBMFFBytes walks the top-level boxes and joins those that were downloaded whole,
+// leaving out the others, such as a skipped mdat, so that the boxes of the result
+// still follow each other. The walk ends with the bytes downloaded from the first
+// box whose header is missing, or that is cut short with nothing known past it.
+func (f *sparseFile) isoBMFFBytes() []byte {
+	var buf []byte
+	for i := int64(0); ; {
+		h := f.at(i, 16)
+		if h == nil {
+			return append(buf, f.from(i)...)
+		}
+		size := int64(bigEndian.Uint32(h[0:4]))
+		if size == 1 {
+			size = int64(readUint64(h[8:16]))
+		}
+		if size < 8 {
+			return append(buf, f.from(i)...)
+		}
+		switch box := f.at(i, size); {
+		case box != nil:
+			buf = append(buf, box...)
+		case f.at(i+size, 8) == nil:
+			// A box cut short with nothing downloaded past it, such as a meta box
+			// larger than what was requested of it.
+			return append(buf, f.from(i)...)
+		}
+		i += size
+	}
+}
+
+// from returns the contiguous bytes downloaded from off on.
+func (f *sparseFile) from(off int64) []byte {
+	for _, c := range f.chunks {
+		if off >= c.off && off < c.end() {
+			return c.data[off-c.off:]
+		}
+	}
+	return nil
+}
+
+// need returns the region of the file that detection needs next, based on the
+// structure of what has been downloaded. It returns ok=false when the format gives
+// no hint, in which case callers fall back to fetching a longer prefix.
+func (f *sparseFile) need() (off, n int64, ok bool) {
+	p := f.prefix()
+	if len(p) < 16 {
+		return 0, 0, false
+	}
+
+	switch {
+	case hasJPEG(p):
+		off, n, ok = f.needJPEG()
+	case hasTIFFBig(p):
+		off, n, ok = f.needTIFF(bigEndian)
+	case hasTIFFLittle(p):
+		off, n, ok = f.needTIFF(littleEndian)
+	case hasISOBMFF(p):
+		off, n, ok = f.needISOBMFF()
+	}
+
+	if ok && f.size >= 0 {
+		if off >= f.size {
+			return 0, 0, false
+		}
+		n = min(n, f.size-off)
+	}
+	return off, n, ok
+}
+
+// needJPEG follows the segment lengths up to the start of frame marker.
+func (f *sparseFile) needJPEG() (int64, int64, bool) {
+	i := int64(2)
+	for {
+		h := f.at(i, 4)
+		if h == nil {
+			return i, hintWindow, true
+		}
+		if h[0] != 0xff {
+			return 0, 0, false
+		}
+		if isSOF(h[1]) {
+			if f.at(i, 9) == nil {
+				return i, hintWindow, true
+			}
+			return 0, 0, false
+		}
+		length := int64(h[2])<<8 | int64(h[3])
+		if length < 2 {
+			return 0, 0, false
+		}
+		i += 2 + length
+	}
+}
+
+// needTIFF asks for the first IFD, wherever it lives in the file.
+func (f *sparseFile) needTIFF(order byteOrder) (int64, int64, bool) {
+	ifd := int64(order.Uint32(f.prefix()[4:8]))
+	if ifd < 8 {
+		return 0, 0, false
+	}
+	h := f.at(ifd, 2)
+	if h == nil {
+		return ifd, hintWindow, true
+	}
+	size := 2 + 12*int64(order.Uint16(h)) + 4
+	if f.at(ifd, size) == nil {
+		return ifd, size, true
+	}
+	return 0, 0, false
+}
+
+// needISOBMFF skips top-level boxes such as mdat to reach the meta box.
+func (f *sparseFile) needISOBMFF() (int64, int64, bool) {
+	const maxMeta = 256 << 10
+
+	i := int64(0)
+	for {
+		h := f.at(i, 8)
+		if h == nil {
+			return i, hintWindow, true
+		}
+		size := int64(bigEndian.Uint32(h[0:4]))
+		header := int64(8)
+		switch size {
+		case 0:
+			return 0, 0, false
+		case 1:
+			h16 := f.at(i, 16)
+			if h16 == nil {
+				return i, hintWindow, true
+			}
+			size = int64(readUint64(h16[8:16]))
+			header = 16
+		}
+		if size < header {
+			return 0, 0, false
+		}
+		if h[4] == 'm' && h[5] == 'e' && h[6] == 't' && h[7] == 'a' {
+			if f.at(i, min(size, maxMeta)) == nil {
+				return i, min(size, maxMeta), true
+			}
+			return 0, 0, false
+		}
+		i += size
+		if f.size >= 0 && i >= f.size {
+			return 0, 0, false
+		}
+	}
+}
+
+func hasISOBMFF(b []byte) bool {
+	return len(b) >= 8 && b[4] == 'f' && b[5] == 't' && b[6] == 'y' && b[7] == 'p'
+}
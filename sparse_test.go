@@ -0,0 +1,70 @@
+package fastimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func TestSparseFileISOBMFF(t *testing.T) {
+	data, err := os.ReadFile("testdata/grid.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GetInfo(data)
+
+	// Move the meta box behind an mdat box, of which only the start is downloaded.
+	ftyp, meta := data[:24], data[24:355]
+	mdat := binary.BigEndian.AppendUint32(nil, 64<<10)
+	mdat = append(append(mdat, "mdat"...), make([]byte, 64<<10-8)...)
+	file := bytes.Join([][]byte{ftyp, mdat, meta}, nil)
+	metaOffset := int64(len(ftyp) + len(mdat))
+
+	f := sparseFile{size: int64(len(file))}
+	f.add(0, file[:1024])
+	if off, _, ok := f.need(); !ok || off != metaOffset {
+		t.Fatalf("need() = %d, %v, want the meta box at %d", off, ok, metaOffset)
+	}
+	f.add(metaOffset, meta)
+	if got := GetInfo(f.bytes()); got != want {
+		t.Errorf("GetInfo(bytes()) = %+v, want %+v", got, want)
+	}
+
+	// A meta box requested only in part ends the bytes.
+	f = sparseFile{size: int64(len(file))}
+	f.add(0, file[:1024])
+	f.add(metaOffset, meta[:100])
+	if got := f.bytes(); !bytes.Equal(got, append(ftyp[:len(ftyp):len(ftyp)], meta[:100]...)) {
+		t.Errorf("bytes() has %d bytes, want the ftyp box and the start of the meta box", len(got))
+	}
+}
+
+func TestSparseFileNeedJPEG(t *testing.T) {
+	for _, c := range []struct {
+		Marker byte
+		Frame  bool
+	}{
+		{0xc0, true},
+		{0xc2, true},
+		{0xc4, false}, // Huffman tables
+		{0xc9, true},
+		{0xcc, false}, // arithmetic coding conditioning
+		{0xcf, true},
+	} {
+		// A segment of the marker, followed by one that was not downloaded.
+		data := []byte{0xff, 0xd8, 0xff, c.Marker, 0x00, 0x11, 0x08, 0x00, 0x20, 0x00, 0x10, 0x03}
+		data = append(data, make([]byte, 0x11-10)...)
+		f := sparseFile{size: -1}
+		f.add(0, data)
+		_, _, ok := f.need()
+		if frame := !ok; frame != c.Frame {
+			t.Errorf("marker %#x: need() ok = %v, want a frame header %v", c.Marker, ok, c.Frame)
+		}
+		if c.Frame {
+			if got, want := GetInfo(append(data, make([]byte, 64)...)), (Info{JPEG, 16, 32}); got != want {
+				t.Errorf("marker %#x: GetInfo = %+v, want %+v", c.Marker, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package fastimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math"
+	"strconv"
+)
+
+// svgzSniffLen is the number of decompressed bytes of an SVGZ file searched for the
+// root element.
+const svgzSniffLen = 16 << 10
+
+// svgUnits maps the CSS units allowed on the root element to pixels.
+var svgUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"pt": 96.0 / 72,
+	"pc": 16,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+}
+
+func hasSVG(b []byte) bool {
+	_, ok := svgRoot(b)
+	return ok
+}
+
+func hasGzip(b []byte) bool {
+	return len(b) >= 3 && b[0] == '\x1f' && b[1] == '\x8b' && b[2] == '\x08'
+}
+
+// hasSVGZ decompresses the start of gzip data b and looks for an SVG root element.
+func hasSVGZ(b []byte) bool {
+	return hasGzip(b) && hasSVG(gunzipPrefix(b))
+}
+
+func svg(b []byte, info *Info) {
+	tag, ok := svgRoot(b)
+	if !ok {
+		return
+	}
+	attrs, complete := xmlAttributes(tag)
+	if !complete {
+		// The tag goes on past b, and an attribute after it may set the size.
+		return
+	}
+	width, wok := svgLength(attrs["width"])
+	height, hok := svgLength(attrs["height"])
+	if !wok || !hok {
+		// Missing or relative sizes fall back to the viewBox, as browsers do.
+		fields := bytes.FieldsFunc(attrs["viewBox"], func(r rune) bool { return r == ' ' || r == ',' })
+		if len(fields) != 4 {
+			return
+		}
+		vw, err1 := strconv.ParseFloat(string(fields[2]), 64)
+		vh, err2 := strconv.ParseFloat(string(fields[3]), 64)
+		if err1 != nil || err2 != nil {
+			return
+		}
+		switch {
+		case !wok && !hok:
+			width, height = vw, vh
+		case !hok && vw > 0:
+			height = width * vh / vw
+		case !wok && vh > 0:
+			width = height * vw / vh
+		}
+	}
+	info.Width, info.Height = svgPixels(width), svgPixels(height)
+	if info.Width != 0 && info.Height != 0 {
+		info.Type = SVG
+	}
+}
+
+func svgz(b []byte, info *Info) {
+	svg(gunzipPrefix(b), info)
+	if info.Type == SVG {
+		info.Type = SVGZ
+	}
+}
+
+// gunzipPrefix returns up to svgzSniffLen bytes decompressed from the gzip data b,
+// which may be truncated.
+func gunzipPrefix(b []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil
+	}
+	out, _ := io.ReadAll(io.LimitReader(zr, svgzSniffLen))
+	return out
+}
+
+// svgRoot returns b from the start of its svg root element, after the XML
+// declaration, comments, processing instructions and doctype.
+func svgRoot(b []byte) ([]byte, bool) {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	for {
+		b = bytes.TrimLeft(b, " \t\r\n")
+		var end []byte
+		switch {
+		case bytes.HasPrefix(b, []byte("<?")):
+			end = []byte("?>")
+		case bytes.HasPrefix(b, []byte("<!--")):
+			end = []byte("-->")
+		case bytes.HasPrefix(b, []byte("<!DOCTYPE")):
+			end = []byte(">")
+			if i := bytes.IndexAny(b, "[>"); i >= 0 && b[i] == '[' {
+				end = []byte("]>")
+			}
+		case bytes.HasPrefix(b, []byte("<svg")) && len(b) > 4 && bytes.IndexByte([]byte(" \t\r\n/>"), b[4]) >= 0:
+			return b, true
+		default:
+			return nil, false
+		}
+		i := bytes.Index(b, end)
+		if i < 0 {
+			return nil, false
+		}
+		b = b[i+len(end):]
+	}
+}
+
+// xmlAttributes parses the attributes of the start tag at the beginning of b.
+// complete is false when b ends before the tag does.
+func xmlAttributes(b []byte) (attrs map[string][]byte, complete bool) {
+	attrs = make(map[string][]byte)
+	i := bytes.IndexAny(b, " \t\r\n/>")
+	for i >= 0 && i < len(b) {
+		i += len(b[i:]) - len(bytes.TrimLeft(b[i:], " \t\r\n"))
+		if i >= len(b) {
+			break
+		}
+		if b[i] == '>' || b[i] == '/' {
+			return attrs, true
+		}
+		eq := bytes.IndexByte(b[i:], '=')
+		if eq < 0 || i+eq+1 >= len(b) {
+			break
+		}
+		name := bytes.TrimSpace(b[i : i+eq])
+		i += eq + 1
+		i += len(b[i:]) - len(bytes.TrimLeft(b[i:], " \t\r\n"))
+		if i >= len(b) || (b[i] != '"' && b[i] != '\'') {
+			break
+		}
+		end := bytes.IndexByte(b[i+1:], b[i])
+		if end < 0 {
+			break
+		}
+		attrs[string(name)] = b[i+1 : i+1+end]
+		i += end + 2
+	}
+	return attrs, false
+}
+
+// svgLength converts an absolute SVG length such as "120", "12.5px" or "2in" to
+// pixels. It fails for percentages, font-relative units and malformed values.
+func svgLength(v []byte) (float64, bool) {
+	v = bytes.TrimSpace(v)
+	n := len(v)
+	for n > 0 && (v[n-1] < '0' || v[n-1] > '9') && v[n-1] != '.' {
+		n--
+	}
+	scale, ok := svgUnits[string(v[n:])]
+	if !ok || n == 0 {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(v[:n]), 64)
+	if err != nil || f <= 0 {
+		return 0, false
+	}
+	return f * scale, true
+}
+
+func svgPixels(f float64) uint32 {
+	if f <= 0 || f >= math.MaxUint32 {
+		return 0
+	}
+	return uint32(math.Ceil(f - 0.5))
+}
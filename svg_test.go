@@ -0,0 +1,32 @@
+package fastimage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSVGSize(t *testing.T) {
+	pad := strings.Repeat(" ", 80)
+	cases := []struct {
+		Name string
+		Data string
+		Info Info
+	}{
+		{"pixels", `<svg width="32" height="16px">`, Info{SVG, 32, 16}},
+		{"units", `<svg width="1in" height="72pt" xmlns="http://www.w3.org/2000/svg">`, Info{SVG, 96, 96}},
+		{"fractions", `<svg width='10.4' height='10.6'/>`, Info{SVG, 10, 11}},
+		{"viewBox", `<svg viewBox="0,0,300,150">`, Info{SVG, 300, 150}},
+		{"percent width", `<svg width="100%" height="50" viewBox="0 0 200 100">`, Info{SVG, 100, 50}},
+		{"em falls back", `<svg width="10em" viewBox="0 0 64 48">`, Info{SVG, 64, 48}},
+		{"no size", `<svg xmlns="http://www.w3.org/2000/svg">`, Info{}},
+		{"unterminated tag", `<svg viewBox="0 0 64 48" width="`, Info{}},
+		{"not svg", `<svgx width="1" height="1">`, Info{}},
+		{"html", `<!DOCTYPE html><html><svg width="1" height="1">`, Info{}},
+		{"internal subset", `<!DOCTYPE svg [<!ENTITY a "b">]><svg width="5" height="6">`, Info{SVG, 5, 6}},
+	}
+	for _, c := range cases {
+		if got := GetInfo([]byte(c.Data + pad)); got != c.Info {
+			t.Errorf("%s: got %+v, want %+v", c.Name, got, c.Info)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package fastimage
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ThumbnailRange is the location of a preview image embedded in an image file.
+type ThumbnailRange struct {
+	// Offset and Length locate the preview in the file.
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+	// Info is the type and size of the preview as detected from its bytes when they
+	// are available, or as recorded by the container otherwise. Either may be zero
+	// when neither says.
+	Info
+}
+
+// HTTPRange returns the value of a Range request header that fetches the preview,
+// such as "bytes=80-1952".
+func (r ThumbnailRange) HTTPRange() string {
+	return fmt.Sprintf("bytes=%d-%d", r.Offset, r.Offset+r.Length-1)
+}
+
+// icnsSizes maps the ICNS element types holding PNG or JPEG 2000 images to their
+// width and height in pixels.
+var icnsSizes = map[string]uint32{
+	"icp4": 16, "icp5": 32, "icp6": 64,
+	"ic04": 16, "ic05": 32,
+	"ic07": 128, "ic08": 256, "ic09": 512, "ic10": 1024,
+	"ic11": 32, "ic12": 64, "ic13": 256, "ic14": 512,
+}
+
+// GetThumbnailRanges returns the byte ranges of the previews embedded in the image
+// file starting with p: the EXIF thumbnail of JPEG and TIFF files, the JPEG
+// thumbnail resource of PSD files, the entries of ICO and CUR files, and the PNG and
+// JPEG 2000 images of ICNS files. A CDN can then
+// serve a preview with a single ranged request against the original file.
+//
+// Only previews listed within p are returned, so more bytes may reveal more. The
+// EXIF thumbnail is listed in the first 64 KB of a JPEG file, PSD image resources
+// follow the header and ICO directories are at the start of the file, but ICNS elements are chained and each one is only found
+// once p reaches it. ICO entries stored as BMP have no BMP file header, as in the ICO
+// file, and are reported with Type BMP.
+func GetThumbnailRanges(p []byte) []ThumbnailRange {
+	switch {
+	case hasJPEG(p):
+		return jpegThumbnails(p)
+	case hasTIFFBig(p):
+		return exifThumbnails(p, 0, bigEndian)
+	case hasTIFFLittle(p):
+		return exifThumbnails(p, 0, littleEndian)
+	case hasPSD(p):
+		return psdThumbnails(p)
+	case hasICNS(p):
+		return icnsThumbnails(p)
+	case hasICODirectory(p):
+		return icoThumbnails(p)
+	}
+	return nil
+}
+
+// jpegThumbnails returns the EXIF thumbnail of the JPEG data b.
+func jpegThumbnails(b []byte) []ThumbnailRange {
+	i := 2
+	for i+3 < len(b) {
+		if b[i] != 0xff {
+			return nil
+		}
+		code := b[i+1]
+		length := int(b[i+3]) | int(b[i+2])<<8
+		if length < 2 || code == 0xda {
+			return nil
+		}
+		if code == 0xe1 && bytes.HasPrefix(b[i+4:min(i+2+length, len(b))], []byte("Exif\x00\x00")) {
+			// EXIF offsets count from the TIFF header that follows the Exif marker,
+			// and the thumbnail is stored inside the APP1 segment.
+			base := i + 10
+			end := min(i+2+length, len(b))
+			if base > end {
+				return nil
+			}
+			switch exif := b[base:end]; {
+			case hasTIFFBig(exif):
+				return exifThumbnails(exif, int64(base), bigEndian)
+			case hasTIFFLittle(exif):
+				return exifThumbnails(exif, int64(base), littleEndian)
+			}
+			return nil
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// exifThumbnails returns the JPEG thumbnail listed in the second IFD of the TIFF data
+// b, which starts at offset base in the file.
+func exifThumbnails(b []byte, base int64, order byteOrder) []ThumbnailRange {
+	if len(b) < 8 {
+		return nil
+	}
+	ifd1 := tiffNextIFD(b, order, int(order.Uint32(b[4:8])))
+	offset, ok := tiffIFDTag(b, order, ifd1, 0x201) // JPEGInterchangeFormat
+	if !ok || offset == 0 {
+		return nil
+	}
+	length, ok := tiffIFDTag(b, order, ifd1, 0x202) // JPEGInterchangeFormatLength
+	if !ok || length == 0 {
+		return nil
+	}
+	r := ThumbnailRange{Offset: base + int64(offset), Length: int64(length)}
+	r.Info = thumbnailInfo(b, int64(offset), r.Length)
+	r.Type = JPEG
+	return []ThumbnailRange{r}
+}
+
+// GetThumbnail returns the bytes of the first preview GetThumbnailRanges finds in
+// p, such as the EXIF thumbnail JPEG, or nil when there is none or it is not
+// entirely within p.
+func GetThumbnail(p []byte) []byte {
+	ranges := GetThumbnailRanges(p)
+	if len(ranges) == 0 || ranges[0].Offset+ranges[0].Length > int64(len(p)) {
+		return nil
+	}
+	return p[ranges[0].Offset : ranges[0].Offset+ranges[0].Length]
+}
+
+// psdThumbnails returns the JPEG thumbnail of the image resource 1036 of the PSD
+// data b. Its data starts with a 28-byte header giving the format, the size and the
+// compressed size. Photoshop 4 files use resource 1033 instead, whose JPEG has its
+// red and blue channels swapped, which is not reported.
+func psdThumbnails(b []byte) []ThumbnailRange {
+	if len(b) < 30 {
+		return nil
+	}
+	i := 30 + int64(bigEndian.Uint32(b[26:30])) // after the color mode data
+	if i+4 > int64(len(b)) {
+		return nil
+	}
+	end := min(i+4+int64(bigEndian.Uint32(b[i:i+4])), int64(len(b)))
+	for i += 4; i+7 <= end && string(b[i:i+4]) == "8BIM"; {
+		id := bigEndian.Uint16(b[i+4 : i+6])
+		i += 6 + (int64(b[i+6])+2)&^1 // the Pascal name, padded to an even size
+		if i+4 > end {
+			return nil
+		}
+		size := int64(bigEndian.Uint32(b[i : i+4]))
+		data := i + 4
+		if id == 1036 && size >= 28 {
+			if data+28 > int64(len(b)) {
+				return nil
+			}
+			header := b[data : data+28]
+			if bigEndian.Uint32(header[0:4]) != 1 { // kJpegRGB
+				return nil
+			}
+			r := ThumbnailRange{Offset: data + 28, Length: min(int64(bigEndian.Uint32(header[20:24])), size-28)}
+			r.Info = thumbnailInfo(b, r.Offset, r.Length)
+			if r.Width == 0 || r.Height == 0 {
+				r.Width, r.Height = bigEndian.Uint32(header[4:8]), bigEndian.Uint32(header[8:12])
+			}
+			r.Type = JPEG
+			return []ThumbnailRange{r}
+		}
+		i = data + (size+1)&^1
+	}
+	return nil
+}
+
+func hasICNS(b []byte) bool {
+	return len(b) >= 8 && string(b[:4]) == "icns"
+}
+
+// icnsThumbnails returns the images among the ICNS elements within b.
+func icnsThumbnails(b []byte) []ThumbnailRange {
+	var ranges []ThumbnailRange
+	total := int64(bigEndian.Uint32(b[4:8]))
+	for i := int64(8); i+8 <= int64(len(b)) && i+8 <= total; {
+		typ := string(b[i : i+4])
+		length := int64(bigEndian.Uint32(b[i+4 : i+8]))
+		if length < 8 {
+			break
+		}
+		if size, ok := icnsSizes[typ]; ok {
+			r := ThumbnailRange{Offset: i + 8, Length: length - 8}
+			r.Info = thumbnailInfo(b, r.Offset, r.Length)
+			if r.Width == 0 || r.Height == 0 {
+				r.Width, r.Height = size, size
+			}
+			ranges = append(ranges, r)
+		}
+		i += length
+	}
+	return ranges
+}
+
+// hasICODirectory reports whether b starts with the directory of an ICO or CUR
+// file: a zero reserved field, type 1 or 2 and at least one entry whose reserved
+// byte is zero and whose data lies after the directory.
+func hasICODirectory(b []byte) bool {
+	if len(b) < 22 || b[0] != 0 || b[1] != 0 || (b[2] != 1 && b[2] != 2) || b[3] != 0 {
+		return false
+	}
+	count := int(littleEndian.Uint16(b[4:6]))
+	if count == 0 {
+		return false
+	}
+	offset := littleEndian.Uint32(b[18:22])
+	return b[9] == 0 && offset >= uint32(6+16*count)
+}
+
+// icoThumbnails returns the entries of the ICO or CUR directory within b.
+func icoThumbnails(b []byte) []ThumbnailRange {
+	var ranges []ThumbnailRange
+	count := int(littleEndian.Uint16(b[4:6]))
+	for i := 6; count > 0 && i+16 <= len(b); i, count = i+16, count-1 {
+		width, height := uint32(b[i]), uint32(b[i+1])
+		if width == 0 {
+			width = 256
+		}
+		if height == 0 {
+			height = 256
+		}
+		r := ThumbnailRange{
+			Offset: int64(littleEndian.Uint32(b[i+12 : i+16])),
+			Length: int64(littleEndian.Uint32(b[i+8 : i+12])),
+		}
+		r.Info = thumbnailInfo(b, r.Offset, r.Length)
+		if r.Type == Unknown && r.Offset+4 <= int64(len(b)) && littleEndian.Uint32(b[r.Offset:r.Offset+4]) == 40 {
+			// A BITMAPINFOHEADER, whose height counts the AND mask too.
+			r.Type = BMP
+		}
+		if r.Width == 0 || r.Height == 0 || r.Type == BMP {
+			r.Width, r.Height = width, height
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// thumbnailInfo detects the preview of length bytes at offset in b, as far as b
+// holds it.
+func thumbnailInfo(b []byte, offset, length int64) Info {
+	if offset < 0 || length <= 0 || offset >= int64(len(b)) {
+		return Info{}
+	}
+	return GetInfo(b[offset:min(offset+length, int64(len(b)))])
+}
@@ -0,0 +1,103 @@
+package fastimage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestGetThumbnailRanges(t *testing.T) {
+	cases := []struct {
+		file string
+		want []ThumbnailRange
+	}{
+		{"letter_T_thumb.jpg", []ThumbnailRange{{Offset: 80, Length: 1873, Info: Info{JPEG, 52, 54}}}},
+		{"icons.ico", []ThumbnailRange{
+			{Offset: 38, Length: 3746, Info: Info{PNG, 90, 60}},
+			{Offset: 3784, Length: 1128, Info: Info{BMP, 16, 16}},
+		}},
+		{"icons.icns", []ThumbnailRange{{Offset: 40, Length: 3746, Info: Info{PNG, 90, 60}}}},
+		{"468x60.psd", []ThumbnailRange{{Offset: 700, Length: 1180, Info: Info{JPEG, 112, 14}}}},
+		{"letter_T.psd", nil},
+		{"letter_T.jpg", nil},
+		{"letter_T_exif.jpg", nil},
+		{"bexjdic.tif", nil},
+		{"pass-1_s.png", nil},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile("testdata/" + c.file)
+		if err != nil {
+			t.Fatalf("read %s: %v", c.file, err)
+		}
+		got := GetThumbnailRanges(data)
+		if len(got) != len(c.want) {
+			t.Errorf("GetThumbnailRanges(%s) = %+v, want %+v", c.file, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("GetThumbnailRanges(%s)[%d] = %+v, want %+v", c.file, i, got[i], c.want[i])
+			}
+		}
+		for _, r := range got {
+			if end := r.Offset + r.Length; end > int64(len(data)) {
+				t.Errorf("%s: range %+v ends past the file size %d", c.file, r, len(data))
+			}
+		}
+	}
+}
+
+func TestGetThumbnailRangesPrefix(t *testing.T) {
+	data, err := os.ReadFile("testdata/letter_T_thumb.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The thumbnail is listed before its bytes, so its range is known from a short
+	// prefix, with the type recorded by EXIF.
+	got := GetThumbnailRanges(data[:80])
+	if len(got) != 1 || got[0] != (ThumbnailRange{Offset: 80, Length: 1873, Info: Info{Type: JPEG}}) {
+		t.Fatalf("GetThumbnailRanges(prefix) = %+v", got)
+	}
+	if got[0].HTTPRange() != "bytes=80-1952" {
+		t.Fatalf("HTTPRange() = %q", got[0].HTTPRange())
+	}
+	for n := range 80 {
+		GetThumbnailRanges(data[:n])
+	}
+}
+
+func TestGetThumbnail(t *testing.T) {
+	cases := []struct {
+		file   string
+		offset int
+		length int
+	}{
+		{"letter_T_thumb.jpg", 80, 1873},
+		{"468x60.psd", 700, 1180},
+		{"letter_T.jpg", 0, 0},
+		{"bexjdic.tif", 0, 0},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile("testdata/" + c.file)
+		if err != nil {
+			t.Fatalf("read %s: %v", c.file, err)
+		}
+		got := GetThumbnail(data)
+		if want := data[c.offset : c.offset+c.length]; !bytes.Equal(got, want) || (got == nil) != (c.length == 0) {
+			t.Errorf("GetThumbnail(%s) = %d bytes, want %d", c.file, len(got), c.length)
+		}
+		if c.length == 0 {
+			continue
+		}
+		if got := GetInfo(got); got.Type != JPEG || got.Width == 0 {
+			t.Errorf("GetThumbnail(%s) is not a JPEG: %+v", c.file, got)
+		}
+		// A prefix that ends within the thumbnail only gives its range.
+		if got := GetThumbnail(data[:c.offset+c.length-1]); got != nil {
+			t.Errorf("GetThumbnail(%s prefix) = %d bytes, want nil", c.file, len(got))
+		}
+		for n := range c.offset {
+			GetThumbnail(data[:n])
+		}
+	}
+}
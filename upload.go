@@ -0,0 +1,132 @@
+package fastimage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// UploadOptions controls GateUploads.
+type UploadOptions struct {
+	// Types lists the image types accepted. Empty accepts every type.
+	Types []Type
+	// MaxWidth and MaxHeight, when positive, bound the dimensions of accepted images.
+	MaxWidth  uint32
+	MaxHeight uint32
+	// MaxPixels, when positive, bounds the pixel count, width times height, of
+	// accepted images. It stops decompression bombs whose sides are each plausible.
+	MaxPixels uint64
+	// MaxBytes is the number of body bytes read while detecting. Bodies whose image
+	// info is not found within it are rejected. Zero or negative uses 256 KB, which
+	// leaves room for the EXIF, ICC and XMP segments a JPEG may carry before its
+	// dimensions.
+	MaxBytes int
+	// OnReject, when set, writes the response for rejected requests instead of a
+	// plain text error with the StatusCode of err. err is an *UploadRejectedError,
+	// or the error that reading the body failed with.
+	OnReject func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type uploadInfoKey struct{}
+
+// UploadInfo returns the image info GateUploads detected in the body of r, for
+// handlers behind it.
+func UploadInfo(r *http.Request) (Info, bool) {
+	info, ok := r.Context().Value(uploadInfoKey{}).(Info)
+	return info, ok
+}
+
+// GateUploads returns a handler that checks request bodies claiming an image/*
+// Content-Type before passing them on to next. Only the first bytes of the body are
+// read: enough to find the image info, and at most MaxBytes. Bodies that are not an
+// image of an accepted type are rejected with 415 Unsupported Media Type, and images
+// exceeding the dimension limits with 413 Request Entity Too Large, before the rest
+// of the body is received. Accepted requests reach next with the body intact and
+// the detected info available from UploadInfo. Other requests pass through
+// unchecked.
+func GateUploads(next http.Handler, options UploadOptions) http.Handler {
+	if options.MaxBytes <= 0 {
+		options.MaxBytes = 256 << 10
+	}
+	if options.OnReject == nil {
+		options.OnReject = rejectUpload
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if r.Body == nil || r.Body == http.NoBody || !strings.HasPrefix(mediaType, "image/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		head, info, err := sniffUpload(r.Body, options)
+		if err != nil {
+			options.OnReject(w, r, err)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), uploadInfoKey{}, info))
+		r.Body = &uploadBody{Reader: io.MultiReader(bytes.NewReader(head), r.Body), Closer: r.Body}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uploadBody replays the sniffed bytes before the rest of the original body.
+type uploadBody struct {
+	io.Reader
+	io.Closer
+}
+
+// sniffUpload reads from body until the image info is found, and checks it against
+// options.
+func sniffUpload(body io.Reader, options UploadOptions) ([]byte, Info, error) {
+	buf := make([]byte, 0, 4096)
+	tmp := make([]byte, 4096)
+	for {
+		n, err := body.Read(tmp[:min(len(tmp), options.MaxBytes-len(buf))])
+		buf = append(buf, tmp[:n]...)
+		if t := GetType(buf); t != Unknown && len(options.Types) > 0 && !slices.Contains(options.Types, t) {
+			// Refuse disallowed formats without waiting for their dimensions.
+			return nil, Info{}, &UploadRejectedError{Info: Info{Type: t}, StatusCode: http.StatusUnsupportedMediaType, Reason: t.String() + " images are not accepted"}
+		}
+		info := GetInfo(buf)
+		if info.Type != Unknown && info.Width != 0 && info.Height != 0 {
+			return buf, info, checkUpload(info, options)
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, Info{}, err
+		}
+		if err != nil || len(buf) >= options.MaxBytes {
+			return nil, Info{}, &UploadRejectedError{Info: Info{Type: GetType(buf)}, StatusCode: http.StatusUnsupportedMediaType, Reason: "no image dimensions found"}
+		}
+	}
+}
+
+// checkUpload checks the dimensions of info against the limits of options.
+func checkUpload(info Info, options UploadOptions) error {
+	switch {
+	case options.MaxWidth > 0 && info.Width > options.MaxWidth:
+		return &UploadRejectedError{Info: info, StatusCode: http.StatusRequestEntityTooLarge, Reason: "image is too wide"}
+	case options.MaxHeight > 0 && info.Height > options.MaxHeight:
+		return &UploadRejectedError{Info: info, StatusCode: http.StatusRequestEntityTooLarge, Reason: "image is too tall"}
+	case options.MaxPixels > 0 && uint64(info.Width)*uint64(info.Height) > options.MaxPixels:
+		return &UploadRejectedError{Info: info, StatusCode: http.StatusRequestEntityTooLarge, Reason: "image has too many pixels"}
+	}
+	return nil
+}
+
+// rejectUpload is the default UploadOptions.OnReject.
+func rejectUpload(w http.ResponseWriter, r *http.Request, err error) {
+	var rejected *UploadRejectedError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &rejected):
+		http.Error(w, rejected.Error(), rejected.StatusCode)
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, "fastimage: reading upload: "+err.Error(), http.StatusBadRequest)
+	}
+}
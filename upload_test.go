@@ -0,0 +1,105 @@
+package fastimage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGateUploads(t *testing.T) {
+	jpeg := mustReadFile(t, "testdata/letter_T.jpg")
+	png := mustReadFile(t, "testdata/pass-1_s.png")
+	// Two full APP2 segments, as large ICC profiles are, push the SOF past 128 KB.
+	app := append([]byte{0xFF, 0xE2, 0xFF, 0xFF}, make([]byte, 0xFFFF-2)...)
+	bigJPEG := slices.Concat(jpeg[:2], app, app, jpeg[2:])
+
+	var received []byte
+	var seen Info
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		seen, _ = UploadInfo(r)
+	})
+	handler := GateUploads(next, UploadOptions{Types: []Type{JPEG, PNG}, MaxWidth: 60, MaxPixels: 3000})
+
+	cases := []struct {
+		name        string
+		contentType string
+		body        []byte
+		status      int
+		info        Info
+	}{
+		{"jpeg", "image/jpeg", jpeg, http.StatusOK, Info{JPEG, 52, 54}},
+		{"jpeg with large APP segments", "image/jpeg", bigJPEG, http.StatusOK, Info{JPEG, 52, 54}},
+		{"too many pixels", "image/png", png, http.StatusRequestEntityTooLarge, Info{}},
+		{"gif", "image/gif", mustReadFile(t, "testdata/test.gif"), http.StatusUnsupportedMediaType, Info{}},
+		{"not an image", "image/png", bytes.Repeat([]byte("x"), 1000), http.StatusUnsupportedMediaType, Info{}},
+		{"text", "text/plain; charset=utf-8", []byte("hello"), http.StatusOK, Info{}},
+	}
+	for _, c := range cases {
+		received, seen = nil, Info{}
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.status {
+			t.Errorf("%s: status %d, want %d: %s", c.name, rec.Code, c.status, rec.Body)
+			continue
+		}
+		if c.status == http.StatusOK && !bytes.Equal(received, c.body) {
+			t.Errorf("%s: next received %d bytes, want the %d byte body", c.name, len(received), len(c.body))
+		}
+		if seen != c.info {
+			t.Errorf("%s: UploadInfo = %+v, want %+v", c.name, seen, c.info)
+		}
+	}
+}
+
+func TestGateUploadsEarlyReject(t *testing.T) {
+	png := mustReadFile(t, "testdata/pass-1_s.png")
+	pr, pw := io.Pipe()
+	go func() {
+		// Send the header and then stall, as a client streaming a huge body would.
+		pw.Write(png[:100])
+	}()
+	defer pw.Close()
+
+	var rejected error
+	handler := GateUploads(http.NotFoundHandler(), UploadOptions{
+		MaxWidth: 10,
+		OnReject: func(w http.ResponseWriter, r *http.Request, err error) {
+			rejected = err
+			w.WriteHeader(http.StatusTeapot)
+		},
+	})
+	req := httptest.NewRequest(http.MethodPut, "/upload", pr)
+	req.Header.Set("Content-Type", "image/png")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var uploadErr *UploadRejectedError
+	if rec.Code != http.StatusTeapot || !errors.As(rejected, &uploadErr) {
+		t.Fatalf("status %d, OnReject got %v", rec.Code, rejected)
+	}
+	if uploadErr.Info != (Info{PNG, 90, 60}) || uploadErr.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected rejection %+v", uploadErr)
+	}
+	if !strings.Contains(uploadErr.Error(), "too wide") {
+		t.Fatalf("unexpected message %q", uploadErr.Error())
+	}
+}
+
+func mustReadFile(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	return data
+}